@@ -0,0 +1,1011 @@
+// JSON API for scripts and other clients, served under /api/v1.
+//
+// Resources are encoded as JSON objects. Money amounts are integer cents,
+// and quantities checked out are in twelfths of a unit. Errors are returned
+// as a JSON object with "error" and "status" fields.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/buxtronix/syndicate"
+	"github.com/gorilla/mux"
+)
+
+func registerAPIHandlers(r *mux.Router) {
+	r.Path("/users").Handler(apiMethods{
+		"GET":  apiListUsers,
+		"POST": apiAddUser,
+	})
+	r.Path("/users/{id:[0-9]+}").Handler(apiMethods{
+		"GET":   apiGetUser,
+		"PATCH": requireAdminAPI(apiEditUser),
+	})
+
+	r.Path("/beers").Handler(apiMethods{
+		"GET":  apiListBeers,
+		"POST": apiAddBeer,
+	})
+	r.Path("/beers/{id:[0-9]+}").Handler(apiMethods{
+		"GET":    apiGetBeer,
+		"PATCH":  requireAdminAPI(apiEditBeer),
+		"DELETE": requireAdminAPI(apiDeleteBeer),
+	})
+	r.Path("/beers/{id:[0-9]+}/merge").Handler(apiMethods{
+		"POST": requireAdminAPI(apiMergeBeer),
+	})
+
+	r.Path("/contributions").Handler(apiMethods{
+		"GET":  apiListContributions,
+		"POST": apiAddContribution,
+	})
+	r.Path("/contributions/{id:[0-9]+}").Handler(apiMethods{
+		"GET":    apiGetContribution,
+		"PATCH":  requireAdminAPI(apiEditContribution),
+		"DELETE": requireAdminAPI(apiDeleteContribution),
+	})
+
+	r.Path("/checkouts").Handler(apiMethods{
+		"GET":  apiListCheckouts,
+		"POST": apiAddCheckouts,
+	})
+	r.Path("/checkouts/{id:[0-9]+}").Handler(apiMethods{
+		"GET":    apiGetCheckout,
+		"PATCH":  requireAdminAPI(apiEditCheckout),
+		"DELETE": requireAdminAPI(apiDeleteCheckout),
+	})
+
+	r.Path("/debitcredits").Handler(apiMethods{
+		"GET":  apiListDebitCredits,
+		"POST": requireAdminAPI(apiAddDebitCredit),
+	})
+	r.Path("/debitcredits/{id:[0-9]+}").Handler(apiMethods{
+		"GET":    apiGetDebitCredit,
+		"PATCH":  requireAdminAPI(apiEditDebitCredit),
+		"DELETE": requireAdminAPI(apiDeleteDebitCredit),
+	})
+
+	r.NotFoundHandler = apiHandler(func(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+		return nil, &appError{Message: "no such API resource", Code: http.StatusNotFound}
+	})
+}
+
+// apiMethods dispatches requests for a resource by HTTP method.
+type apiMethods map[string]apiHandler
+
+func (m apiMethods) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if fn, ok := m[r.Method]; ok {
+		fn.ServeHTTP(w, r)
+		return
+	}
+	var allowed []string
+	for method := range m {
+		allowed = append(allowed, method)
+	}
+	sort.Strings(allowed)
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	apiHandler(func(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+		return nil, &appError{Message: r.Method + " not supported on this resource", Code: http.StatusMethodNotAllowed}
+	}).ServeHTTP(w, r)
+}
+
+// apiHandler is a handler returning a value to be encoded as the JSON
+// response body.
+type apiHandler func(http.ResponseWriter, *http.Request) (interface{}, *appError)
+
+type apiError struct {
+	Error  string `json:"error"`
+	Status int    `json:"status"`
+}
+
+func (fn apiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r = withSession(r)
+	var (
+		v interface{}
+		e *appError
+	)
+	if needsLogin(r) {
+		e = errNeedsLogin
+	} else {
+		v, e = fn(w, r)
+	}
+	if e != nil {
+		log.Printf("API error: status code: %d, message: %s, underlying err: %#v",
+			e.Code, e.Message, e.Error)
+		writeJSON(w, e.Code, &apiError{Error: e.Message, Status: e.Code})
+		return
+	}
+	switch {
+	case v == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "POST":
+		writeJSON(w, http.StatusCreated, v)
+	default:
+		writeJSON(w, http.StatusOK, v)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding JSON response: %v", err)
+	}
+}
+
+// badRequestf returns an appError for invalid client input.
+func badRequestf(err error, format string, v ...interface{}) *appError {
+	e := appErrorf(err, format, v...)
+	e.Code = http.StatusBadRequest
+	return e
+}
+
+// decodeJSON decodes the request body into v.
+func decodeJSON(r *http.Request, v interface{}) *appError {
+	return decodeJSONFrom(r.Body, v)
+}
+
+// decodeJSONFrom decodes JSON from body into v, rejecting unknown fields.
+func decodeJSONFrom(body io.Reader, v interface{}) *appError {
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return badRequestf(err, "invalid JSON body: %v", err)
+	}
+	return nil
+}
+
+// apiID returns the id in the request path.
+func apiID(r *http.Request) (int64, *appError) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return 0, badRequestf(err, "invalid id: %v", err)
+	}
+	return id, nil
+}
+
+// checkRef verifies that a record referenced from a request body exists.
+func checkRef(what string, id int64, get func(int64) error) *appError {
+	if err := get(id); errors.Is(err, syndicate.ErrNotFound) {
+		return badRequestf(err, "no such %s: %d", what, id)
+	} else if errors.Is(err, errRetired) {
+		return appErrorf(err, "%v", err)
+	} else if err != nil {
+		return appErrorf(err, "could not fetch %s: %v", what, err)
+	}
+	return nil
+}
+
+func userExists(id int64) error {
+	_, err := syndicate.DB.GetUser(id)
+	return err
+}
+
+func beerExists(id int64) error {
+	_, err := syndicate.DB.GetBeer(id)
+	return err
+}
+
+type apiUser struct {
+	ID          int64           `json:"id"`
+	Name        string          `json:"name"`
+	UntappdID   string          `json:"untappd_id"`
+	SeedFund    syndicate.Money `json:"seed_fund"`
+	Retired     bool            `json:"retired"`
+	Added       syndicate.Money `json:"added"`
+	Taken       syndicate.Money `json:"taken"`
+	DebitCredit syndicate.Money `json:"debit_credit"`
+	NetPosition syndicate.Money `json:"net_position"`
+}
+
+func newAPIUser(u *syndicate.User, b *syndicate.Balance) *apiUser {
+	au := &apiUser{
+		ID:        u.ID,
+		Name:      u.Name,
+		UntappdID: u.UntappdID,
+		SeedFund:  u.SeedFund,
+		Retired:   u.Retired,
+	}
+	if b != nil {
+		au.Added = b.Added
+		au.Taken = b.Taken
+		au.DebitCredit = b.DebitCredit
+		au.NetPosition = b.NetPosition()
+	}
+	return au
+}
+
+func apiListUsers(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+	users, err := syndicate.DB.ListUsers()
+	if err != nil {
+		return nil, appErrorf(err, "could not fetch user list: %v", err)
+	}
+	balances, err := syndicate.DB.ListBalances()
+	if err != nil {
+		return nil, appErrorf(err, "could not fetch balances: %v", err)
+	}
+	byUser := map[int64]*syndicate.Balance{}
+	for _, b := range balances {
+		byUser[b.User] = b
+	}
+	ret := []*apiUser{}
+	for _, u := range users {
+		ret = append(ret, newAPIUser(u, byUser[u.ID]))
+	}
+	return ret, nil
+}
+
+func getAPIUser(id int64) (*apiUser, *appError) {
+	user, err := syndicate.DB.GetUser(id)
+	if err != nil {
+		return nil, appErrorf(err, "could not get user: %v", err)
+	}
+	bal, err := syndicate.DB.GetBalance(id)
+	if err != nil {
+		return nil, appErrorf(err, "could not get balance: %v", err)
+	}
+	return newAPIUser(user, bal), nil
+}
+
+func apiGetUser(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+	id, e := apiID(r)
+	if e != nil {
+		return nil, e
+	}
+	return getAPIUser(id)
+}
+
+func apiAddUser(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+	var req struct {
+		Name      string          `json:"name"`
+		UntappdID string          `json:"untappd_id"`
+		SeedFund  syndicate.Money `json:"seed_fund"`
+	}
+	if e := decodeJSON(r, &req); e != nil {
+		return nil, e
+	}
+	if req.Name == "" {
+		return nil, badRequestf(nil, "missing user name")
+	}
+	if e := checkUserName(0, req.Name); e != nil {
+		return nil, e
+	}
+	id, err := auditDB(r).AddUser(&syndicate.User{
+		Name:      req.Name,
+		UntappdID: req.UntappdID,
+		SeedFund:  req.SeedFund,
+	})
+	if err != nil {
+		return nil, appErrorf(err, "error adding user: %v", err)
+	}
+	return getAPIUser(id)
+}
+
+// checkUserName verifies that no user other than id has the given name.
+func checkUserName(id int64, name string) *appError {
+	users, err := syndicate.DB.ListUsers()
+	if err != nil {
+		return appErrorf(err, "error querying existing users: %v", err)
+	}
+	for _, u := range users {
+		if u.Name == name && u.ID != id {
+			return &appError{Message: "user " + name + " already exists", Code: http.StatusConflict}
+		}
+	}
+	return nil
+}
+
+// apiEditUser changes the fields of a user that are present in the request.
+func apiEditUser(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+	id, e := apiID(r)
+	if e != nil {
+		return nil, e
+	}
+	var req struct {
+		Name      *string          `json:"name"`
+		UntappdID *string          `json:"untappd_id"`
+		SeedFund  *syndicate.Money `json:"seed_fund"`
+		Retired   *bool            `json:"retired"`
+	}
+	if e := decodeJSON(r, &req); e != nil {
+		return nil, e
+	}
+	user, err := syndicate.DB.GetUser(id)
+	if err != nil {
+		return nil, appErrorf(err, "could not get user: %v", err)
+	}
+	if req.Name != nil {
+		if *req.Name == "" {
+			return nil, badRequestf(nil, "missing user name")
+		}
+		if e := checkUserName(id, *req.Name); e != nil {
+			return nil, e
+		}
+		user.Name = *req.Name
+	}
+	if req.UntappdID != nil {
+		user.UntappdID = *req.UntappdID
+	}
+	if req.SeedFund != nil {
+		user.SeedFund = *req.SeedFund
+	}
+	if req.Retired != nil {
+		user.Retired = *req.Retired
+	}
+	if err := auditDB(r).EditUser(user); err != nil {
+		return nil, appErrorf(err, "could not edit user: %v", err)
+	}
+	return getAPIUser(id)
+}
+
+type apiBeer struct {
+	ID                int64   `json:"id"`
+	Brewery           string  `json:"brewery"`
+	Name              string  `json:"name"`
+	UntappdID         int64   `json:"untappd_id"`
+	UntappdRating     float64 `json:"untappd_rating"`
+	BreweryID         int64   `json:"brewery_id"`
+	LabelURL          string  `json:"label_url"`
+	Available         float64 `json:"available"`
+	AvailableTwelfths int64   `json:"available_twelfths"`
+}
+
+func newAPIBeer(b *syndicate.Beer, available int64) *apiBeer {
+	return &apiBeer{
+		ID:                b.ID,
+		Brewery:           b.Brewery,
+		Name:              b.Name,
+		UntappdID:         b.UntappdID,
+		UntappdRating:     b.UntappdRating,
+		BreweryID:         b.BreweryID,
+		LabelURL:          b.LabelURL,
+		Available:         float64(available) / 12,
+		AvailableTwelfths: available,
+	}
+}
+
+func apiListBeers(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+	beers, err := syndicate.DB.ListBeers()
+	if err != nil {
+		return nil, appErrorf(err, "could not fetch beer list: %v", err)
+	}
+	available, err := syndicate.DB.ListBeersRemaining()
+	if err != nil {
+		return nil, appErrorf(err, "could not get available quantities: %v", err)
+	}
+	ret := []*apiBeer{}
+	for _, b := range beers {
+		ret = append(ret, newAPIBeer(b, available[b.ID]))
+	}
+	return ret, nil
+}
+
+func getAPIBeer(id int64) (*apiBeer, *appError) {
+	beer, err := syndicate.DB.GetBeer(id)
+	if err != nil {
+		return nil, appErrorf(err, "could not get beer: %v", err)
+	}
+	available, err := syndicate.DB.BeerRemaining(id)
+	if err != nil {
+		return nil, appErrorf(err, "could not get available quantity: %v", err)
+	}
+	return newAPIBeer(beer, available), nil
+}
+
+func apiGetBeer(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+	id, e := apiID(r)
+	if e != nil {
+		return nil, e
+	}
+	return getAPIBeer(id)
+}
+
+// apiAddBeer adds a beer. If only an Untappd ID is given, the remaining
+// details are fetched from the beer catalog.
+func apiAddBeer(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+	var req struct {
+		Brewery       string  `json:"brewery"`
+		Name          string  `json:"name"`
+		UntappdID     int64   `json:"untappd_id"`
+		UntappdRating float64 `json:"untappd_rating"`
+		BreweryID     int64   `json:"brewery_id"`
+		LabelURL      string  `json:"label_url"`
+	}
+	if e := decodeJSON(r, &req); e != nil {
+		return nil, e
+	}
+	if req.Name == "" && req.UntappdID <= 0 {
+		return nil, badRequestf(nil, "must provide a name or untappd_id")
+	}
+	if req.UntappdID > 0 {
+		beers, err := syndicate.DB.ListBeers()
+		if err != nil {
+			return nil, appErrorf(err, "error querying existing beers: %v", err)
+		}
+		for _, b := range beers {
+			if b.UntappdID == req.UntappdID {
+				return nil, &appError{Message: "already have a beer with that untappd id", Code: http.StatusConflict}
+			}
+		}
+	}
+	beer := &syndicate.Beer{
+		Brewery:       req.Brewery,
+		Name:          req.Name,
+		UntappdID:     req.UntappdID,
+		UntappdRating: req.UntappdRating,
+		BreweryID:     req.BreweryID,
+		LabelURL:      req.LabelURL,
+	}
+	if beer.Name == "" {
+		info, err := syndicate.Catalog.Lookup(req.UntappdID)
+		if err != nil {
+			return nil, appErrorf(err, "error querying beer catalog: %v", err)
+		}
+		beer = info.Beer()
+	}
+	id, err := auditDB(r).AddBeer(beer)
+	if err != nil {
+		return nil, appErrorf(err, "error adding beer: %v", err)
+	}
+	return getAPIBeer(id)
+}
+
+// apiEditBeer changes the fields of a beer that are present in the request.
+func apiEditBeer(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+	id, e := apiID(r)
+	if e != nil {
+		return nil, e
+	}
+	var req struct {
+		Brewery       *string  `json:"brewery"`
+		Name          *string  `json:"name"`
+		UntappdID     *int64   `json:"untappd_id"`
+		UntappdRating *float64 `json:"untappd_rating"`
+		BreweryID     *int64   `json:"brewery_id"`
+		LabelURL      *string  `json:"label_url"`
+	}
+	if e := decodeJSON(r, &req); e != nil {
+		return nil, e
+	}
+	beer, err := syndicate.DB.GetBeer(id)
+	if err != nil {
+		return nil, appErrorf(err, "could not get beer: %v", err)
+	}
+	if req.Name != nil {
+		if *req.Name == "" {
+			return nil, badRequestf(nil, "missing beer name")
+		}
+		beer.Name = *req.Name
+	}
+	if req.Brewery != nil {
+		beer.Brewery = *req.Brewery
+	}
+	if req.UntappdID != nil && *req.UntappdID != beer.UntappdID {
+		beers, err := syndicate.DB.ListBeers()
+		if err != nil {
+			return nil, appErrorf(err, "error querying existing beers: %v", err)
+		}
+		for _, b := range beers {
+			if *req.UntappdID > 0 && b.UntappdID == *req.UntappdID {
+				return nil, &appError{Message: "already have a beer with that untappd id", Code: http.StatusConflict}
+			}
+		}
+		beer.UntappdID = *req.UntappdID
+	}
+	if req.UntappdRating != nil {
+		beer.UntappdRating = *req.UntappdRating
+	}
+	if req.BreweryID != nil {
+		beer.BreweryID = *req.BreweryID
+	}
+	if req.LabelURL != nil {
+		beer.LabelURL = *req.LabelURL
+	}
+	if err := auditDB(r).EditBeer(beer); err != nil {
+		return nil, appErrorf(err, "could not edit beer: %v", err)
+	}
+	return getAPIBeer(id)
+}
+
+// apiDeleteBeer deletes a beer, provided it has no contributions.
+func apiDeleteBeer(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+	id, e := apiID(r)
+	if e != nil {
+		return nil, e
+	}
+	if err := auditDB(r).DeleteBeer(id); err != nil {
+		return nil, appErrorf(err, "could not delete beer: %v", err)
+	}
+	return nil, nil
+}
+
+// apiMergeBeer merges the beer into the one given by "into", moving all its
+// contributions.
+func apiMergeBeer(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+	id, e := apiID(r)
+	if e != nil {
+		return nil, e
+	}
+	var req struct {
+		Into int64 `json:"into"`
+	}
+	if e := decodeJSON(r, &req); e != nil {
+		return nil, e
+	}
+	if req.Into == id {
+		return nil, badRequestf(nil, "cannot merge a beer into itself")
+	}
+	if e := checkRef("beer", req.Into, beerExists); e != nil {
+		return nil, e
+	}
+	if err := auditDB(r).MergeBeers(id, req.Into); err != nil {
+		return nil, appErrorf(err, "could not merge beer: %v", err)
+	}
+	return nil, nil
+}
+
+type apiContribution struct {
+	ID                int64           `json:"id"`
+	User              int64           `json:"user"`
+	Beer              int64           `json:"beer"`
+	Quantity          int64           `json:"quantity"`
+	Date              time.Time       `json:"date"`
+	UnitPrice         syndicate.Money `json:"unit_price"`
+	Comment           string          `json:"comment"`
+	Remaining         float64         `json:"remaining"`
+	RemainingTwelfths int64           `json:"remaining_twelfths"`
+}
+
+func newAPIContribution(c *syndicate.Contribution, remaining int64) *apiContribution {
+	return &apiContribution{
+		ID:                c.ID,
+		User:              c.User,
+		Beer:              c.Beer,
+		Quantity:          c.Quantity,
+		Date:              c.Date,
+		UnitPrice:         c.UnitPrice,
+		Comment:           c.Comment,
+		Remaining:         float64(remaining) / 12,
+		RemainingTwelfths: remaining,
+	}
+}
+
+func apiListContributions(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+	conts, err := syndicate.DB.ListContributions()
+	if err != nil {
+		return nil, appErrorf(err, "could not fetch contribution list: %v", err)
+	}
+	remaining, err := syndicate.DB.ListContributionsRemaining()
+	if err != nil {
+		return nil, appErrorf(err, "could not get remaining quantities: %v", err)
+	}
+	ret := []*apiContribution{}
+	for _, c := range conts {
+		ret = append(ret, newAPIContribution(c, remaining[c.ID]))
+	}
+	return ret, nil
+}
+
+func getAPIContribution(id int64) (*apiContribution, *appError) {
+	cont, err := syndicate.DB.GetContribution(id)
+	if err != nil {
+		return nil, appErrorf(err, "could not get contribution: %v", err)
+	}
+	remaining, err := syndicate.DB.ContributionRemaining(id)
+	if err != nil {
+		return nil, appErrorf(err, "could not get remaining quantity: %v", err)
+	}
+	return newAPIContribution(cont, remaining), nil
+}
+
+func apiGetContribution(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+	id, e := apiID(r)
+	if e != nil {
+		return nil, e
+	}
+	return getAPIContribution(id)
+}
+
+// apiAddContribution adds a contribution, priced by exactly one of
+// unit_price or total_price.
+func apiAddContribution(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+	var req struct {
+		User       int64            `json:"user"`
+		Beer       int64            `json:"beer"`
+		Quantity   int64            `json:"quantity"`
+		UnitPrice  *syndicate.Money `json:"unit_price"`
+		TotalPrice *syndicate.Money `json:"total_price"`
+		Comment    string           `json:"comment"`
+	}
+	if e := decodeJSON(r, &req); e != nil {
+		return nil, e
+	}
+	if e := checkRef("user", req.User, activeUserExists); e != nil {
+		return nil, e
+	}
+	if !canActAs(sessionFrom(r), req.User) {
+		return nil, &appError{Message: "you can only contribute beer for yourself", Code: http.StatusForbidden}
+	}
+	if e := checkRef("beer", req.Beer, beerExists); e != nil {
+		return nil, e
+	}
+	if req.Quantity <= 0 {
+		return nil, badRequestf(nil, "quantity must be positive")
+	}
+	var unitPrice syndicate.Money
+	switch {
+	case (req.UnitPrice == nil) == (req.TotalPrice == nil):
+		return nil, badRequestf(nil, "must provide only one of unit_price or total_price")
+	case req.UnitPrice != nil:
+		unitPrice = *req.UnitPrice
+	default:
+		unitPrice = req.TotalPrice.Div(req.Quantity)
+	}
+	id, err := auditDB(r).AddContribution(&syndicate.Contribution{
+		User:      req.User,
+		Beer:      req.Beer,
+		Quantity:  req.Quantity,
+		UnitPrice: unitPrice,
+		Date:      time.Now(),
+		Comment:   req.Comment,
+	})
+	if err != nil {
+		return nil, appErrorf(err, "error adding contribution: %v", err)
+	}
+	return getAPIContribution(id)
+}
+
+func apiEditContribution(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+	id, e := apiID(r)
+	if e != nil {
+		return nil, e
+	}
+	var req struct {
+		Quantity  *int64           `json:"quantity"`
+		UnitPrice *syndicate.Money `json:"unit_price"`
+		Comment   *string          `json:"comment"`
+	}
+	if e := decodeJSON(r, &req); e != nil {
+		return nil, e
+	}
+	cont, err := syndicate.DB.GetContribution(id)
+	if err != nil {
+		return nil, appErrorf(err, "could not get contribution: %v", err)
+	}
+	if req.Quantity != nil {
+		if *req.Quantity <= 0 {
+			return nil, badRequestf(nil, "quantity must be positive")
+		}
+		cont.Quantity = *req.Quantity
+	}
+	if req.UnitPrice != nil {
+		cont.UnitPrice = *req.UnitPrice
+	}
+	if req.Comment != nil {
+		cont.Comment = *req.Comment
+	}
+	if err := auditDB(r).EditContribution(cont); err != nil {
+		var stockErr *syndicate.InsufficientStockError
+		if errors.As(err, &stockErr) {
+			return nil, &appError{Error: err, Message: overdrawnMessage(stockErr), Code: http.StatusConflict}
+		}
+		return nil, appErrorf(err, "could not edit contribution: %v", err)
+	}
+	return getAPIContribution(id)
+}
+
+// apiDeleteContribution moves a contribution to the trash along with its
+// checkouts, as deleting it on the web does.
+func apiDeleteContribution(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+	id, e := apiID(r)
+	if e != nil {
+		return nil, e
+	}
+	if err := auditDB(r).DeleteContribution(id); err != nil {
+		return nil, appErrorf(err, "error removing contribution: %v", err)
+	}
+	return nil, nil
+}
+
+type apiCheckout struct {
+	ID           int64     `json:"id"`
+	User         int64     `json:"user"`
+	Contribution int64     `json:"contribution"`
+	Twelfths     int64     `json:"twelfths"`
+	Quantity     float64   `json:"quantity"`
+	Date         time.Time `json:"date"`
+}
+
+func newAPICheckout(c *syndicate.Checkout) *apiCheckout {
+	return &apiCheckout{
+		ID:           c.ID,
+		User:         c.User,
+		Contribution: c.Contribution,
+		Twelfths:     c.Twelfths,
+		Quantity:     float64(c.Twelfths) / 12,
+		Date:         c.Date,
+	}
+}
+
+func apiListCheckouts(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+	couts, err := syndicate.DB.ListCheckouts()
+	if err != nil {
+		return nil, appErrorf(err, "could not fetch checkout list: %v", err)
+	}
+	ret := []*apiCheckout{}
+	for _, c := range couts {
+		ret = append(ret, newAPICheckout(c))
+	}
+	return ret, nil
+}
+
+func apiGetCheckout(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+	id, e := apiID(r)
+	if e != nil {
+		return nil, e
+	}
+	cout, err := syndicate.DB.GetCheckout(id)
+	if err != nil {
+		return nil, appErrorf(err, "could not get checkout: %v", err)
+	}
+	return newAPICheckout(cout), nil
+}
+
+// apiAddCheckouts adds a single checkout, or an array of checkouts which are
+// recorded atomically, such as a split bottle.
+func apiAddCheckouts(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+	type checkoutReq struct {
+		User         int64 `json:"user"`
+		Contribution int64 `json:"contribution"`
+		Twelfths     int64 `json:"twelfths"`
+	}
+	var raw json.RawMessage
+	if e := decodeJSON(r, &raw); e != nil {
+		return nil, e
+	}
+	var reqs []*checkoutReq
+	isArray := strings.HasPrefix(strings.TrimSpace(string(raw)), "[")
+	if isArray {
+		if e := decodeJSONFrom(bytes.NewReader(raw), &reqs); e != nil {
+			return nil, e
+		}
+	} else {
+		req := &checkoutReq{}
+		if e := decodeJSONFrom(bytes.NewReader(raw), req); e != nil {
+			return nil, e
+		}
+		reqs = append(reqs, req)
+	}
+	if len(reqs) == 0 {
+		return nil, badRequestf(nil, "no checkouts given")
+	}
+
+	var checkouts []*syndicate.Checkout
+	for _, req := range reqs {
+		if e := checkRef("user", req.User, activeUserExists); e != nil {
+			return nil, e
+		}
+		if !canActAs(sessionFrom(r), req.User) {
+			return nil, &appError{Message: "you can only check out beer for yourself", Code: http.StatusForbidden}
+		}
+		if req.Twelfths <= 0 {
+			return nil, badRequestf(nil, "twelfths must be positive")
+		}
+		checkouts = append(checkouts, &syndicate.Checkout{
+			User:         req.User,
+			Contribution: req.Contribution,
+			Twelfths:     req.Twelfths,
+			Date:         time.Now(),
+		})
+	}
+	ids, err := auditDB(r).AddCheckouts(checkouts)
+	if err != nil {
+		var stockErr *syndicate.InsufficientStockError
+		switch {
+		case errors.As(err, &stockErr):
+			return nil, &appError{Error: err, Message: stockErr.Error(), Code: http.StatusConflict}
+		case errors.Is(err, syndicate.ErrNotFound):
+			return nil, badRequestf(err, "%v", err)
+		}
+		return nil, appErrorf(err, "error adding checkout: %v", err)
+	}
+
+	ret := []*apiCheckout{}
+	for i, c := range checkouts {
+		c.ID = ids[i]
+		ret = append(ret, newAPICheckout(c))
+	}
+	if !isArray {
+		return ret[0], nil
+	}
+	return ret, nil
+}
+
+func apiEditCheckout(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+	id, e := apiID(r)
+	if e != nil {
+		return nil, e
+	}
+	var req struct {
+		User     *int64 `json:"user"`
+		Twelfths *int64 `json:"twelfths"`
+	}
+	if e := decodeJSON(r, &req); e != nil {
+		return nil, e
+	}
+	cout, err := syndicate.DB.GetCheckout(id)
+	if err != nil {
+		return nil, appErrorf(err, "could not get checkout: %v", err)
+	}
+	if req.User != nil && *req.User != cout.User {
+		if e := checkRef("user", *req.User, activeUserExists); e != nil {
+			return nil, e
+		}
+		cout.User = *req.User
+	}
+	if req.Twelfths != nil {
+		if *req.Twelfths <= 0 {
+			return nil, badRequestf(nil, "twelfths must be positive")
+		}
+		cout.Twelfths = *req.Twelfths
+	}
+	if err := auditDB(r).EditCheckout(cout); err != nil {
+		var stockErr *syndicate.InsufficientStockError
+		if errors.As(err, &stockErr) {
+			return nil, &appError{Error: err, Message: stockErr.Error(), Code: http.StatusConflict}
+		}
+		return nil, appErrorf(err, "could not edit checkout: %v", err)
+	}
+	return newAPICheckout(cout), nil
+}
+
+func apiDeleteCheckout(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+	id, e := apiID(r)
+	if e != nil {
+		return nil, e
+	}
+	if _, err := syndicate.DB.GetCheckout(id); err != nil {
+		return nil, appErrorf(err, "could not get checkout: %v", err)
+	}
+	if err := auditDB(r).DeleteCheckout(id); err != nil {
+		return nil, appErrorf(err, "error removing checkout: %v", err)
+	}
+	return nil, nil
+}
+
+type apiDebitCredit struct {
+	ID      int64           `json:"id"`
+	User    int64           `json:"user"`
+	Amount  syndicate.Money `json:"amount"`
+	Date    time.Time       `json:"date"`
+	Comment string          `json:"comment"`
+}
+
+func newAPIDebitCredit(dc *syndicate.DebitCredit) *apiDebitCredit {
+	return &apiDebitCredit{
+		ID:      dc.ID,
+		User:    dc.User,
+		Amount:  dc.Amount,
+		Date:    dc.Date,
+		Comment: dc.Comment,
+	}
+}
+
+// apiListDebitCredits lists debits and credits, optionally only those for
+// the user given in the "user" query parameter.
+func apiListDebitCredits(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+	var user int64
+	if u := r.FormValue("user"); u != "" {
+		var err error
+		if user, err = strconv.ParseInt(u, 10, 64); err != nil {
+			return nil, badRequestf(err, "invalid user: %v", err)
+		}
+	}
+	dcs, err := syndicate.DB.ListDebitCredits()
+	if err != nil {
+		return nil, appErrorf(err, "could not fetch debit/credit list: %v", err)
+	}
+	ret := []*apiDebitCredit{}
+	for _, dc := range dcs {
+		if user == 0 || dc.User == user {
+			ret = append(ret, newAPIDebitCredit(dc))
+		}
+	}
+	return ret, nil
+}
+
+func apiGetDebitCredit(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+	id, e := apiID(r)
+	if e != nil {
+		return nil, e
+	}
+	dc, err := syndicate.DB.GetDebitCredit(id)
+	if err != nil {
+		return nil, appErrorf(err, "could not get debit/credit: %v", err)
+	}
+	return newAPIDebitCredit(dc), nil
+}
+
+// apiAddDebitCredit adds a debit or credit; debits have a negative amount.
+func apiAddDebitCredit(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+	var req struct {
+		User    int64           `json:"user"`
+		Amount  syndicate.Money `json:"amount"`
+		Comment string          `json:"comment"`
+	}
+	if e := decodeJSON(r, &req); e != nil {
+		return nil, e
+	}
+	if e := checkRef("user", req.User, userExists); e != nil {
+		return nil, e
+	}
+	if req.Amount == 0 {
+		return nil, badRequestf(nil, "amount must be non-zero")
+	}
+	dc := &syndicate.DebitCredit{
+		User:    req.User,
+		Amount:  req.Amount,
+		Comment: req.Comment,
+		Date:    time.Now(),
+	}
+	id, err := auditDB(r).AddDebitCredit(dc)
+	if err != nil {
+		return nil, appErrorf(err, "error adding debit/credit: %v", err)
+	}
+	dc.ID = id
+	return newAPIDebitCredit(dc), nil
+}
+
+func apiEditDebitCredit(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+	id, e := apiID(r)
+	if e != nil {
+		return nil, e
+	}
+	var req struct {
+		Amount  *syndicate.Money `json:"amount"`
+		Comment *string          `json:"comment"`
+	}
+	if e := decodeJSON(r, &req); e != nil {
+		return nil, e
+	}
+	dc, err := syndicate.DB.GetDebitCredit(id)
+	if err != nil {
+		return nil, appErrorf(err, "could not get debit/credit: %v", err)
+	}
+	if req.Amount != nil {
+		if *req.Amount == 0 {
+			return nil, badRequestf(nil, "amount must be non-zero")
+		}
+		dc.Amount = *req.Amount
+	}
+	if req.Comment != nil {
+		dc.Comment = *req.Comment
+	}
+	if err := auditDB(r).EditDebitCredit(dc); err != nil {
+		return nil, appErrorf(err, "could not edit debit/credit: %v", err)
+	}
+	return newAPIDebitCredit(dc), nil
+}
+
+func apiDeleteDebitCredit(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+	id, e := apiID(r)
+	if e != nil {
+		return nil, e
+	}
+	if _, err := syndicate.DB.GetDebitCredit(id); err != nil {
+		return nil, appErrorf(err, "could not get debit/credit: %v", err)
+	}
+	if err := auditDB(r).DeleteDebitCredit(id); err != nil {
+		return nil, appErrorf(err, "error removing debit/credit: %v", err)
+	}
+	return nil, nil
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/buxtronix/syndicate"
+	"github.com/gorilla/mux"
+)
+
+// apiTest is a request to the API and the response expected.
+type apiTest struct {
+	method, path, body string
+	// admin sends the admin passphrase as a bearer token.
+	admin bool
+	// user logs the request in as the user.
+	user int64
+	code int
+	// want are fields of the response object, or of the object in a
+	// response list with the same id.
+	want map[string]interface{}
+}
+
+// setupAPI serves the API from a fresh in-memory database holding:
+//
+//	users 1 alice (seed fund $10), 2 bob, and 3 carol who is retired;
+//	beers 1 Pale Ale and 2 Stout;
+//	contribution 1 of two Pale Ales at $10 each by alice;
+//	checkout 1 of one and a half of them by bob;
+//	debit/credit 1 of -$2 for bob.
+//
+// The admin role needs the passphrase "secret".
+func setupAPI(t *testing.T) http.Handler {
+	t.Helper()
+	oldDB, oldPassphrase := syndicate.DB, *adminPassphrase
+	t.Cleanup(func() { syndicate.DB, *adminPassphrase = oldDB, oldPassphrase })
+	if err := syndicate.OpenDatabase(":memory:"); err != nil {
+		t.Fatalf("OpenDatabase: %v", err)
+	}
+	*adminPassphrase = "secret"
+
+	d := syndicate.DB
+	var ids []int64
+	add := func(id int64, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("setting up: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	add(d.AddUser(&syndicate.User{Name: "alice", SeedFund: 1000}))
+	add(d.AddUser(&syndicate.User{Name: "bob"}))
+	add(d.AddUser(&syndicate.User{Name: "carol"}))
+	if err := d.EditUser(&syndicate.User{ID: 3, Name: "carol", Retired: true}); err != nil {
+		t.Fatalf("EditUser: %v", err)
+	}
+	add(d.AddBeer(&syndicate.Beer{Name: "Pale Ale", Brewery: "Brewery"}))
+	add(d.AddBeer(&syndicate.Beer{Name: "Stout"}))
+	add(d.AddContribution(&syndicate.Contribution{User: 1, Beer: 1, Quantity: 2, UnitPrice: 1000}))
+	add(d.AddCheckout(&syndicate.Checkout{User: 2, Contribution: 1, Twelfths: 18}))
+	add(d.AddDebitCredit(&syndicate.DebitCredit{User: 2, Amount: -200, Comment: "glasses"}))
+	if got := fmt.Sprint(ids); got != "[1 2 3 1 2 1 1 1]" {
+		t.Fatalf("setting up got ids %s, want [1 2 3 1 2 1 1 1]", got)
+	}
+
+	r := mux.NewRouter()
+	registerAPIHandlers(r.PathPrefix("/api/v1").Subrouter())
+	return r
+}
+
+// runAPITests makes each request in turn to a fresh API, checking the
+// responses.
+func runAPITests(t *testing.T, tests []apiTest) {
+	serveAPITests(t, setupAPI(t), tests)
+}
+
+// serveAPITests makes each request in turn to the API, checking the
+// responses.
+func serveAPITests(t *testing.T, h http.Handler, tests []apiTest) {
+	t.Helper()
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/api/v1"+tt.path, strings.NewReader(tt.body))
+		if tt.admin {
+			req.Header.Set("Authorization", "Bearer secret")
+		}
+		if tt.user != 0 {
+			token, err := syndicate.Login(syndicate.DB, tt.user, time.Hour)
+			if err != nil {
+				t.Fatalf("Login: %v", err)
+			}
+			req.AddCookie(&http.Cookie{Name: loginCookie, Value: token})
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		call := fmt.Sprintf("%s %s %s", tt.method, tt.path, tt.body)
+		if tt.admin {
+			call += " as admin"
+		}
+		if tt.user != 0 {
+			call += fmt.Sprintf(" as user %d", tt.user)
+		}
+
+		if rec.Code != tt.code {
+			t.Errorf("%s: got status %d, want %d; body %s", call, rec.Code, tt.code, rec.Body)
+			continue
+		}
+		if rec.Code == http.StatusNoContent {
+			continue
+		}
+		var got interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Errorf("%s: invalid JSON response %q: %v", call, rec.Body, err)
+			continue
+		}
+		if rec.Code >= 400 {
+			if e, ok := got.(map[string]interface{}); !ok || e["error"] == "" || fmt.Sprint(e["status"]) != fmt.Sprint(rec.Code) {
+				t.Errorf("%s: got error %s, want error and status %d", call, rec.Body, rec.Code)
+			}
+			continue
+		}
+		if list, ok := got.([]interface{}); ok {
+			got = nil
+			for _, v := range list {
+				if o, ok := v.(map[string]interface{}); ok && fmt.Sprint(o["id"]) == fmt.Sprint(tt.want["id"]) {
+					got = o
+				}
+			}
+		}
+		obj, _ := got.(map[string]interface{})
+		for k, want := range tt.want {
+			if fmt.Sprint(obj[k]) != fmt.Sprint(want) {
+				t.Errorf("%s: got %s %v, want %v; body %s", call, k, obj[k], want, rec.Body)
+			}
+		}
+	}
+}
+
+func TestAPIUsers(t *testing.T) {
+	runAPITests(t, []apiTest{
+		{method: "GET", path: "/users/1", code: 200,
+			want: map[string]interface{}{"name": "alice", "added": 2000, "taken": 0, "net_position": 3000}},
+		{method: "GET", path: "/users", code: 200,
+			want: map[string]interface{}{"id": 2, "taken": 1500, "debit_credit": -200, "net_position": -1700}},
+		{method: "GET", path: "/users/99", code: 404},
+		{method: "GET", path: "/users/bob", code: 404},
+		{method: "DELETE", path: "/users/1", code: 405},
+
+		{method: "POST", path: "/users", body: `{"name":"dave","seed_fund":500}`, code: 201,
+			want: map[string]interface{}{"id": 4, "name": "dave", "net_position": 500}},
+		{method: "POST", path: "/users", body: `{"name":"alice"}`, code: 409},
+		{method: "POST", path: "/users", body: `{}`, code: 400},
+		{method: "POST", path: "/users", body: `{"nmae":"eve"}`, code: 400},
+		{method: "POST", path: "/users", body: `{"name":`, code: 400},
+
+		{method: "PATCH", path: "/users/2", body: `{"retired":true}`, code: 403},
+		{method: "PATCH", path: "/users/2", body: `{"retired":true}`, admin: true, code: 200,
+			want: map[string]interface{}{"retired": true, "net_position": -1700}},
+		{method: "PATCH", path: "/users/2", body: `{"name":"alice"}`, admin: true, code: 409},
+		{method: "PATCH", path: "/users/2", body: `{"name":""}`, admin: true, code: 400},
+		{method: "PATCH", path: "/users/99", body: `{"name":"zed"}`, admin: true, code: 404},
+	})
+}
+
+func TestAPIBeers(t *testing.T) {
+	runAPITests(t, []apiTest{
+		{method: "GET", path: "/beers/1", code: 200,
+			want: map[string]interface{}{"name": "Pale Ale", "available": 0.5, "available_twelfths": 6}},
+		{method: "GET", path: "/beers", code: 200,
+			want: map[string]interface{}{"id": 2, "name": "Stout", "available": 0, "available_twelfths": 0}},
+		{method: "GET", path: "/beers/99", code: 404},
+
+		{method: "POST", path: "/beers", body: `{"name":"IPA","untappd_id":5}`, code: 201,
+			want: map[string]interface{}{"id": 3, "untappd_id": 5, "available_twelfths": 0}},
+		{method: "POST", path: "/beers", body: `{"name":"Another IPA","untappd_id":5}`, code: 409},
+		{method: "POST", path: "/beers", body: `{}`, code: 400},
+
+		{method: "PATCH", path: "/beers/1", body: `{"name":"Best Ale"}`, code: 403},
+		{method: "PATCH", path: "/beers/1", body: `{"name":""}`, admin: true, code: 400},
+		{method: "PATCH", path: "/beers/1", body: `{"untappd_id":5}`, admin: true, code: 409},
+		{method: "PATCH", path: "/beers/1", body: `{"name":"Best Ale"}`, admin: true, code: 200,
+			want: map[string]interface{}{"name": "Best Ale", "brewery": "Brewery", "available_twelfths": 6}},
+		{method: "PATCH", path: "/beers/99", body: `{"name":"Best Ale"}`, admin: true, code: 404},
+
+		{method: "DELETE", path: "/beers/3", code: 403},
+		{method: "DELETE", path: "/beers/1", admin: true, code: 409},
+		{method: "DELETE", path: "/beers/3", admin: true, code: 204},
+		{method: "GET", path: "/beers/3", code: 404},
+
+		{method: "POST", path: "/beers/1/merge", body: `{"into":2}`, code: 403},
+		{method: "POST", path: "/beers/1/merge", body: `{"into":1}`, admin: true, code: 400},
+		{method: "POST", path: "/beers/1/merge", body: `{"into":99}`, admin: true, code: 400},
+		{method: "POST", path: "/beers/1/merge", body: `{"into":2}`, admin: true, code: 204},
+		{method: "GET", path: "/beers/1", code: 404},
+		{method: "GET", path: "/beers/2", code: 200,
+			want: map[string]interface{}{"name": "Stout", "available_twelfths": 6}},
+	})
+}
+
+func TestAPIContributions(t *testing.T) {
+	runAPITests(t, []apiTest{
+		{method: "GET", path: "/contributions/1", code: 200,
+			want: map[string]interface{}{"user": 1, "beer": 1, "unit_price": 1000, "remaining": 0.5, "remaining_twelfths": 6}},
+		{method: "GET", path: "/contributions", code: 200,
+			want: map[string]interface{}{"id": 1, "remaining_twelfths": 6}},
+		{method: "GET", path: "/contributions/99", code: 404},
+
+		{method: "POST", path: "/contributions", body: `{"user":2,"beer":2,"quantity":4,"total_price":2000}`, code: 201,
+			want: map[string]interface{}{"id": 2, "unit_price": 500, "remaining": 4, "remaining_twelfths": 48}},
+		{method: "POST", path: "/contributions", body: `{"user":2,"beer":2,"quantity":4,"unit_price":500,"total_price":2000}`, code: 400},
+		{method: "POST", path: "/contributions", body: `{"user":2,"beer":2,"quantity":4}`, code: 400},
+		{method: "POST", path: "/contributions", body: `{"user":2,"beer":2,"quantity":0,"unit_price":500}`, code: 400},
+		{method: "POST", path: "/contributions", body: `{"user":99,"beer":2,"quantity":1,"unit_price":500}`, code: 400},
+		{method: "POST", path: "/contributions", body: `{"user":2,"beer":99,"quantity":1,"unit_price":500}`, code: 400},
+		{method: "POST", path: "/contributions", body: `{"user":3,"beer":2,"quantity":1,"unit_price":500}`, code: 409},
+
+		{method: "PATCH", path: "/contributions/1", body: `{"quantity":3}`, code: 403},
+		{method: "PATCH", path: "/contributions/1", body: `{"quantity":0}`, admin: true, code: 400},
+		{method: "PATCH", path: "/contributions/1", body: `{"quantity":1}`, admin: true, code: 409},
+		{method: "PATCH", path: "/contributions/1", body: `{"quantity":3,"comment":"found another"}`, admin: true, code: 200,
+			want: map[string]interface{}{"quantity": 3, "comment": "found another", "remaining_twelfths": 18}},
+		{method: "PATCH", path: "/contributions/99", body: `{"quantity":3}`, admin: true, code: 404},
+
+		{method: "DELETE", path: "/contributions/2", code: 403},
+		{method: "DELETE", path: "/contributions/2", admin: true, code: 204},
+		{method: "DELETE", path: "/contributions/2", admin: true, code: 404},
+	})
+}
+
+func TestAPIDeleteContributionWithCheckouts(t *testing.T) {
+	h := setupAPI(t)
+	serveAPITests(t, h, []apiTest{
+		{method: "DELETE", path: "/contributions/1", admin: true, code: 204},
+		{method: "GET", path: "/contributions/1", code: 404},
+		{method: "GET", path: "/checkouts/1", code: 404},
+		{method: "GET", path: "/users/2", code: 200,
+			want: map[string]interface{}{"taken": 0, "net_position": -200}},
+	})
+	if err := syndicate.DB.UndeleteContribution(1); err != nil {
+		t.Fatalf("UndeleteContribution: %v", err)
+	}
+	serveAPITests(t, h, []apiTest{
+		{method: "GET", path: "/contributions/1", code: 200,
+			want: map[string]interface{}{"remaining_twelfths": 6}},
+		{method: "GET", path: "/checkouts/1", code: 200,
+			want: map[string]interface{}{"user": 2, "twelfths": 18}},
+		{method: "GET", path: "/users/2", code: 200,
+			want: map[string]interface{}{"taken": 1500, "net_position": -1700}},
+	})
+}
+
+func TestAPICheckouts(t *testing.T) {
+	runAPITests(t, []apiTest{
+		{method: "GET", path: "/checkouts/1", code: 200,
+			want: map[string]interface{}{"user": 2, "contribution": 1, "twelfths": 18, "quantity": 1.5}},
+		{method: "GET", path: "/checkouts", code: 200,
+			want: map[string]interface{}{"id": 1, "twelfths": 18}},
+		{method: "GET", path: "/checkouts/99", code: 404},
+
+		{method: "POST", path: "/checkouts", body: `{"user":1,"contribution":1,"twelfths":4}`, code: 201,
+			want: map[string]interface{}{"id": 2, "twelfths": 4, "quantity": 0.3333333333333333}},
+		{method: "POST", path: "/checkouts", body: `[{"user":1,"contribution":1,"twelfths":1},{"user":2,"contribution":1,"twelfths":2}]`, code: 409},
+		{method: "POST", path: "/checkouts", body: `{"user":1,"contribution":1,"twelfths":0}`, code: 400},
+		{method: "POST", path: "/checkouts", body: `{"user":1,"contribution":1,"twelfths":1,"twelfth":1}`, code: 400},
+		{method: "POST", path: "/checkouts", body: `[{"user":1,"contribution":1,"twelfths":1,"twelfth":1}]`, code: 400},
+		{method: "POST", path: "/checkouts", body: `{"user":1,"contribution":99,"twelfths":1}`, code: 400},
+		{method: "POST", path: "/checkouts", body: `{"user":99,"contribution":1,"twelfths":1}`, code: 400},
+		{method: "POST", path: "/checkouts", body: `{"user":3,"contribution":1,"twelfths":1}`, code: 409},
+		{method: "GET", path: "/contributions/1", code: 200,
+			want: map[string]interface{}{"remaining_twelfths": 2}},
+
+		{method: "PATCH", path: "/checkouts/1", body: `{"twelfths":12}`, code: 403},
+		{method: "PATCH", path: "/checkouts/1", body: `{"twelfths":21}`, admin: true, code: 409},
+		{method: "PATCH", path: "/checkouts/1", body: `{"user":99}`, admin: true, code: 400},
+		{method: "PATCH", path: "/checkouts/1", body: `{"twelfths":12}`, admin: true, code: 200,
+			want: map[string]interface{}{"twelfths": 12, "quantity": 1}},
+		{method: "PATCH", path: "/checkouts/99", body: `{"twelfths":12}`, admin: true, code: 404},
+		{method: "GET", path: "/beers/1", code: 200,
+			want: map[string]interface{}{"available_twelfths": 8}},
+
+		{method: "DELETE", path: "/checkouts/1", code: 403},
+		{method: "DELETE", path: "/checkouts/1", admin: true, code: 204},
+		{method: "DELETE", path: "/checkouts/1", admin: true, code: 404},
+		{method: "GET", path: "/users/2", code: 200,
+			want: map[string]interface{}{"taken": 0, "net_position": -200}},
+	})
+}
+
+func TestAPIActAsOthers(t *testing.T) {
+	h := setupAPI(t)
+	t.Cleanup(func() { *authEnabled = false })
+	*authEnabled = true
+	serveAPITests(t, h, []apiTest{
+		{method: "POST", path: "/contributions", body: `{"user":1,"beer":2,"quantity":1,"unit_price":500}`, user: 2, code: 403},
+		{method: "POST", path: "/contributions", body: `{"user":1,"beer":2,"quantity":1,"unit_price":500}`, code: 401},
+		{method: "POST", path: "/contributions", body: `{"user":2,"beer":2,"quantity":1,"unit_price":500}`, user: 2, code: 201,
+			want: map[string]interface{}{"id": 2, "user": 2}},
+		{method: "POST", path: "/contributions", body: `{"user":1,"beer":2,"quantity":1,"unit_price":500}`, admin: true, code: 201,
+			want: map[string]interface{}{"id": 3, "user": 1}},
+
+		{method: "POST", path: "/checkouts", body: `{"user":1,"contribution":1,"twelfths":1}`, user: 2, code: 403},
+		{method: "POST", path: "/checkouts", body: `[{"user":2,"contribution":1,"twelfths":1},{"user":1,"contribution":1,"twelfths":1}]`, user: 2, code: 403},
+		{method: "POST", path: "/checkouts", body: `{"user":2,"contribution":1,"twelfths":1}`, code: 401},
+		{method: "POST", path: "/checkouts", body: `{"user":2,"contribution":1,"twelfths":1}`, user: 2, code: 201,
+			want: map[string]interface{}{"id": 2, "user": 2}},
+		{method: "POST", path: "/checkouts", body: `{"user":1,"contribution":1,"twelfths":1}`, admin: true, code: 201,
+			want: map[string]interface{}{"id": 3, "user": 1}},
+		{method: "GET", path: "/contributions/1", user: 2, code: 200,
+			want: map[string]interface{}{"remaining_twelfths": 4}},
+	})
+}
+
+func TestAPIDebitCredits(t *testing.T) {
+	runAPITests(t, []apiTest{
+		{method: "GET", path: "/debitcredits?user=2", code: 200,
+			want: map[string]interface{}{"id": 1, "user": 2, "amount": -200, "comment": "glasses"}},
+		{method: "GET", path: "/debitcredits?user=bob", code: 400},
+		{method: "GET", path: "/debitcredits/1", code: 200,
+			want: map[string]interface{}{"amount": -200}},
+		{method: "GET", path: "/debitcredits/99", code: 404},
+
+		{method: "POST", path: "/debitcredits", body: `{"user":1,"amount":300}`, code: 403},
+		{method: "POST", path: "/debitcredits", body: `{"user":1,"amount":0}`, admin: true, code: 400},
+		{method: "POST", path: "/debitcredits", body: `{"user":99,"amount":300}`, admin: true, code: 400},
+		{method: "POST", path: "/debitcredits", body: `{"user":1,"amount":300,"comment":"refund"}`, admin: true, code: 201,
+			want: map[string]interface{}{"id": 2, "user": 1, "amount": 300, "comment": "refund"}},
+		{method: "GET", path: "/users/1", code: 200,
+			want: map[string]interface{}{"debit_credit": 300, "net_position": 3300}},
+
+		{method: "PATCH", path: "/debitcredits/1", body: `{"amount":-250}`, code: 403},
+		{method: "PATCH", path: "/debitcredits/1", body: `{"amount":0}`, admin: true, code: 400},
+		{method: "PATCH", path: "/debitcredits/1", body: `{"amount":-250}`, admin: true, code: 200,
+			want: map[string]interface{}{"amount": -250, "comment": "glasses"}},
+		{method: "PATCH", path: "/debitcredits/99", body: `{"amount":-250}`, admin: true, code: 404},
+
+		{method: "DELETE", path: "/debitcredits/1", code: 403},
+		{method: "DELETE", path: "/debitcredits/1", admin: true, code: 204},
+		{method: "GET", path: "/debitcredits/1", code: 404},
+		{method: "DELETE", path: "/debitcredits/1", admin: true, code: 404},
+	})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/buxtronix/syndicate"
+)
+
+var (
+	catalogName = flag.String("catalog", "untappd", `Beer catalog to add beers from: "untappd", which needs -untappd_id and -untappd_secret, or "local", filled with the catalog command`)
+	catalogFile = flag.String("catalog_file", "", "SQLite file of the local beer catalog, by default catalog.db beside -dbfile")
+)
+
+// localCatalogPath returns the path of the local catalog file.
+func localCatalogPath() string {
+	if *catalogFile != "" {
+		return *catalogFile
+	}
+	return filepath.Join(filepath.Dir(*dbFile), "catalog.db")
+}
+
+// openCatalog sets the beer catalog chosen by -catalog.
+func openCatalog() error {
+	switch *catalogName {
+	case "untappd":
+		if syndicate.Untappd == nil {
+			return errors.New(`the untappd catalog needs -untappd_id and -untappd_secret; use -catalog=local without them`)
+		}
+		syndicate.Catalog = syndicate.Untappd
+	case "local":
+		c, err := syndicate.OpenLocalCatalog(localCatalogPath())
+		if err != nil {
+			return err
+		}
+		syndicate.Catalog = c
+	default:
+		return fmt.Errorf("unknown -catalog %q", *catalogName)
+	}
+	return nil
+}
+
+// catalogCommand adds the beers in CSV or JSON files, as read by
+// syndicate.ReadCatalogFile, to the local catalog, and returns the exit
+// status.
+func catalogCommand(args []string) int {
+	fs := flag.NewFlagSet("catalog", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		log.Printf("Give the CSV or JSON files of beers to add to the catalog")
+		return 2
+	}
+	c, err := syndicate.OpenLocalCatalog(localCatalogPath())
+	if err != nil {
+		log.Printf("Could not open catalog: %v", err)
+		return 1
+	}
+	defer c.Close()
+	for _, path := range fs.Args() {
+		beers, err := syndicate.ReadCatalogFile(path)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		if err := c.Put(beers); err != nil {
+			log.Printf("Could not add beers from %s: %v", path, err)
+			return 1
+		}
+		fmt.Printf("Added %d beers from %s to %s\n", len(beers), path, localCatalogPath())
+	}
+	return 0
+}
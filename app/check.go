@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/buxtronix/syndicate"
+)
+
+// logIntegrity logs any integrity problems in the database, without
+// repairing them.
+func logIntegrity() {
+	problems, err := syndicate.CheckIntegrity(syndicate.DB, false)
+	if err != nil {
+		log.Printf("Integrity check failed: %v", err)
+		return
+	}
+	for _, p := range problems {
+		log.Printf("Integrity problem: %v", p)
+	}
+	if len(problems) > 0 {
+		log.Printf("Found %d integrity problems; run with the check -repair command to repair them", len(problems))
+	}
+}
+
+// checkCommand checks the database for integrity problems, optionally
+// repairing them, and returns the exit status: 1 if problems remain.
+func checkCommand(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	repair := fs.Bool("repair", false, "Repair the problems found")
+	fs.Parse(args)
+
+	if err := openDatabase(); err != nil {
+		log.Fatal(err)
+	}
+	db := syndicate.DB
+	if *repair {
+		db = syndicate.Audited(db, syndicate.Actor{RemoteAddr: "integrity repair"})
+	}
+	problems, err := syndicate.CheckIntegrity(db, *repair)
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(problems) == 0 {
+		fmt.Println("No integrity problems found.")
+		return 0
+	}
+	if *repair {
+		fmt.Printf("Repaired %d problems.\n", len(problems))
+		return 0
+	}
+	fmt.Printf("Found %d problems; run with -repair to repair them.\n", len(problems))
+	return 1
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/buxtronix/syndicate"
+)
+
+var untappdFixtures = flag.String("untappd_fixtures", "", "For development, serve a stand-in for Untappd from this JSON fixture file and use it instead of the real API")
+
+// startFakeUntappd serves a stand-in for Untappd from -untappd_fixtures on
+// a local port, and points the Untappd flags at it.
+func startFakeUntappd() error {
+	fake, err := syndicate.LoadFakeUntappd(*untappdFixtures)
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	go func() {
+		log.Fatal(http.Serve(l, fake))
+	}()
+	base := "http://" + l.Addr().String()
+	*untappdURL, *shortURLBase = base+"/v4", base
+	if *untappdID == "" {
+		*untappdID = "fake"
+	}
+	if *untappdSecret == "" {
+		*untappdSecret = "fake"
+	}
+	log.Printf("Serving stand-in Untappd from %s at %s", *untappdFixtures, base)
+	return nil
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buxtronix/syndicate"
+)
+
+var authEnabled = flag.Bool("auth", false, "Require users to log in with their PIN or password")
+
+const (
+	// loginSessionTTL is how long a browser stays logged in.
+	loginSessionTTL = 30 * 24 * time.Hour
+	// maxLoginFailures is how many wrong PINs or passwords lock a user
+	// out for loginLockout, to slow down guessing a PIN, and
+	// maxAddrLoginFailures how many from one address lock it out, to slow
+	// down guessing the PINs of every user.
+	maxLoginFailures     = 5
+	maxAddrLoginFailures = 20
+	loginLockout         = time.Minute
+	// loginFailureWindow is how long a failed login counts towards a
+	// lockout.
+	loginFailureWindow = 15 * time.Minute
+)
+
+// loginFailure counts the recent failed logins of a user or address.
+type loginFailure struct {
+	count  int
+	last   time.Time
+	locked time.Time
+}
+
+// loginFailures are the recent failed logins, by loginUserKey or
+// loginAddrKey.
+var loginFailures = struct {
+	sync.Mutex
+	m map[string]*loginFailure
+}{m: map[string]*loginFailure{}}
+
+// loginUserKey returns the key counting failed logins as the user.
+func loginUserKey(user int64) string {
+	return fmt.Sprintf("user %d", user)
+}
+
+// loginAddrKey returns the key counting failed logins from the request's
+// address.
+func loginAddrKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr " + host
+}
+
+// loginLocked returns true if the user or the request's address is locked
+// out after failed logins.
+func loginLocked(r *http.Request, user int64) bool {
+	loginFailures.Lock()
+	defer loginFailures.Unlock()
+	now := time.Now()
+	for _, key := range []string{loginUserKey(user), loginAddrKey(r)} {
+		if f := loginFailures.m[key]; f != nil && now.Before(f.locked) {
+			return true
+		}
+	}
+	return false
+}
+
+// loginFailed records a failed login from the request's address, and as the
+// user unless it is 0, locking either out after too many. Failures older
+// than loginFailureWindow are forgotten.
+func loginFailed(r *http.Request, user int64) {
+	loginFailures.Lock()
+	defer loginFailures.Unlock()
+	now := time.Now()
+	for key, f := range loginFailures.m {
+		if now.Sub(f.last) > loginFailureWindow && !now.Before(f.locked) {
+			delete(loginFailures.m, key)
+		}
+	}
+	count := func(key string, max int) {
+		f := loginFailures.m[key]
+		if f == nil {
+			f = &loginFailure{}
+			loginFailures.m[key] = f
+		}
+		f.count++
+		f.last = now
+		if f.count >= max {
+			f.count = 0
+			f.locked = now.Add(loginLockout)
+		}
+	}
+	count(loginAddrKey(r), maxAddrLoginFailures)
+	if user != 0 {
+		count(loginUserKey(user), maxLoginFailures)
+	}
+}
+
+// loginSucceeded forgets a user's failed logins. Those from the address are
+// kept, so that logging in as one user does not allow more guesses at
+// another's PIN.
+func loginSucceeded(user int64) {
+	loginFailures.Lock()
+	defer loginFailures.Unlock()
+	delete(loginFailures.m, loginUserKey(user))
+}
+
+// loginExempt are the paths which can be used without logging in, so that
+// users and admins can log in. Browsers subscribe to notifications on the
+// login page, and the subscriptions are claimed when they log in.
+var loginExempt = map[string]bool{
+	"/login":        true,
+	"/logout":       true,
+	"/admin":        true,
+	"/admin/logout": true,
+	"/subscribe":    true,
+	"/unsubscribe":  true,
+	"/vapid/public": true,
+}
+
+// needsLogin returns true if auth is enabled and the request needs a logged
+// in user but has none. Admins need not log in as a user too.
+func needsLogin(r *http.Request) bool {
+	s := sessionFrom(r)
+	if !*authEnabled || s.User != nil || loginExempt[r.URL.Path] {
+		return false
+	}
+	return !(s.Admin && adminEnabled())
+}
+
+// errNeedsLogin is the error for a request which needs a logged in user.
+var errNeedsLogin = &appError{Message: "log in at /login first", Code: http.StatusUnauthorized}
+
+// localRedirect returns the redirect form value if it is a path on this
+// site, or "/".
+func localRedirect(r *http.Request) string {
+	to := r.FormValue("redirect")
+	if !strings.HasPrefix(to, "/") || strings.HasPrefix(to, "//") || strings.HasPrefix(to, "/\\") {
+		return "/"
+	}
+	return to
+}
+
+// loginFormHandler shows the login form, offering the users who have a PIN
+// or password.
+func loginFormHandler(w http.ResponseWriter, r *http.Request) *appError {
+	users, err := syndicate.DB.ListUsers()
+	if err != nil {
+		return appErrorf(err, "could not fetch user list: %v", err)
+	}
+	data := struct {
+		Users    []*syndicate.User
+		Redirect string
+	}{Redirect: localRedirect(r)}
+	for _, u := range users {
+		if u.HasPassword && !u.Retired {
+			data.Users = append(data.Users, u)
+		}
+	}
+	return loginTmpl.Execute(w, r, data)
+}
+
+// loginHandler logs the browser in as a user given their PIN or password.
+func loginHandler(w http.ResponseWriter, r *http.Request) *appError {
+	user, err := strconv.ParseInt(r.FormValue("user"), 10, 64)
+	if err != nil {
+		return &appError{Error: err, Message: "select a user", Code: http.StatusBadRequest}
+	}
+	if loginLocked(r, user) {
+		return &appError{Message: "too many wrong PINs or passwords, try again in a minute", Code: http.StatusTooManyRequests}
+	}
+	if err := syndicate.CheckPassword(syndicate.DB, user, r.FormValue("password")); errors.Is(err, syndicate.ErrBadLogin) {
+		// Only users who exist are counted, so that made up ids
+		// cannot fill the memory.
+		if _, err := syndicate.DB.GetUser(user); err != nil {
+			user = 0
+		}
+		loginFailed(r, user)
+		return &appError{Error: err, Message: "wrong PIN or password", Code: http.StatusForbidden}
+	} else if err != nil {
+		return appErrorf(err, "could not check password: %v", err)
+	}
+	loginSucceeded(user)
+	if e := startLoginSession(w, r, user); e != nil {
+		return e
+	}
+	http.Redirect(w, r, localRedirect(r), http.StatusFound)
+	return nil
+}
+
+// startLoginSession logs the browser in as the user, replacing any session
+// it already has.
+func startLoginSession(w http.ResponseWriter, r *http.Request, user int64) *appError {
+	if s := sessionFrom(r); s.token != "" {
+		if err := syndicate.Logout(syndicate.DB, s.token); err != nil {
+			return appErrorf(err, "could not end old session: %v", err)
+		}
+	}
+	token, err := syndicate.Login(syndicate.DB, user, loginSessionTTL)
+	if err != nil {
+		return appErrorf(err, "could not log in: %v", err)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginCookie,
+		Value:    token,
+		Expires:  time.Now().Add(loginSessionTTL),
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   secureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	// Notifications to this browser are now for the user logging in.
+	if s := sessionFrom(r); s.Cookie != "" {
+		if _, err := syndicate.DB.ClaimSubscriptions(s.Cookie, user); err != nil {
+			return appErrorf(err, "could not claim subscriptions: %v", err)
+		}
+	}
+	return nil
+}
+
+// logoutHandler ends the browser's login session.
+func logoutHandler(w http.ResponseWriter, r *http.Request) *appError {
+	if s := sessionFrom(r); s.token != "" {
+		if err := syndicate.Logout(syndicate.DB, s.token); err != nil {
+			return appErrorf(err, "could not log out: %v", err)
+		}
+	}
+	http.SetCookie(w, &http.Cookie{Name: loginCookie, Path: "/", MaxAge: -1})
+	to := localRedirect(r)
+	if *authEnabled {
+		to = "/login?redirect=" + url.QueryEscape(to)
+	}
+	http.Redirect(w, r, to, http.StatusFound)
+	return nil
+}
+
+// passwordFormHandler shows the form for logged in users to change their
+// PIN or password.
+func passwordFormHandler(w http.ResponseWriter, r *http.Request) *appError {
+	u := sessionFrom(r).User
+	if u == nil {
+		http.Redirect(w, r, "/login?redirect=/password", http.StatusFound)
+		return nil
+	}
+	return passwordTmpl.Execute(w, r, u)
+}
+
+// passwordHandler changes the logged in user's PIN or password.
+func passwordHandler(w http.ResponseWriter, r *http.Request) *appError {
+	u := sessionFrom(r).User
+	if u == nil {
+		return &appError{Message: "log in first", Code: http.StatusUnauthorized}
+	}
+	if loginLocked(r, u.ID) {
+		return &appError{Message: "too many wrong PINs or passwords, try again in a minute", Code: http.StatusTooManyRequests}
+	}
+	if err := syndicate.CheckPassword(syndicate.DB, u.ID, r.FormValue("current")); errors.Is(err, syndicate.ErrBadLogin) {
+		loginFailed(r, u.ID)
+		return &appError{Error: err, Message: "wrong current PIN or password", Code: http.StatusForbidden}
+	} else if err != nil {
+		return appErrorf(err, "could not check password: %v", err)
+	}
+	loginSucceeded(u.ID)
+	password := r.FormValue("password")
+	if password != r.FormValue("confirm") {
+		return &appError{Message: "the new PINs or passwords do not match", Code: http.StatusBadRequest}
+	}
+	if len(password) < syndicate.MinPasswordLength {
+		return &appError{Message: fmt.Sprintf("PIN or password must be at least %d characters", syndicate.MinPasswordLength), Code: http.StatusBadRequest}
+	}
+	if err := syndicate.SetPassword(auditDB(r), u.ID, password); err != nil {
+		return appErrorf(err, "could not set password: %v", err)
+	}
+	// Changing the password ended every session, so log this one back in.
+	if e := startLoginSession(w, r, u.ID); e != nil {
+		return e
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
+	return nil
+}
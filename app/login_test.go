@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLoginThrottle(t *testing.T) {
+	t.Cleanup(func() { loginFailures.m = map[string]*loginFailure{} })
+	loginFailures.m = map[string]*loginFailure{}
+
+	r := httptest.NewRequest("POST", "/login", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	for i := 0; i < maxLoginFailures; i++ {
+		if loginLocked(r, 1) {
+			t.Fatalf("locked after %d failures, want %d", i, maxLoginFailures)
+		}
+		loginFailed(r, 1)
+	}
+	if !loginLocked(r, 1) {
+		t.Errorf("user not locked after %d failures", maxLoginFailures)
+	}
+	other := httptest.NewRequest("POST", "/login", nil)
+	other.RemoteAddr = "192.0.2.2:1234"
+	if !loginLocked(other, 1) {
+		t.Errorf("user not locked from another address")
+	}
+	if loginLocked(r, 2) {
+		t.Errorf("another user locked before the address reached %d failures", maxAddrLoginFailures)
+	}
+
+	// Unknown users are counted against the address only.
+	for i := maxLoginFailures; i < maxAddrLoginFailures; i++ {
+		loginFailed(r, 0)
+	}
+	if !loginLocked(r, 2) {
+		t.Errorf("address not locked after %d failures", maxAddrLoginFailures)
+	}
+	if _, ok := loginFailures.m[loginUserKey(0)]; ok {
+		t.Errorf("failures counted for user 0")
+	}
+
+	// Stale failures are forgotten on the next failure.
+	loginFailures.m[loginUserKey(3)] = &loginFailure{count: 1, last: time.Now().Add(-2 * loginFailureWindow)}
+	loginFailed(other, 0)
+	if _, ok := loginFailures.m[loginUserKey(3)]; ok {
+		t.Errorf("stale failures of user 3 kept")
+	}
+}
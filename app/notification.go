@@ -2,18 +2,21 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"strconv"
 
 	webpush "github.com/SherClockHolmes/webpush-go"
 	"github.com/buxtronix/syndicate"
 )
 
 var (
-	vapidPublic  = flag.String("vapid_public", "", "VAPID public key")
-	vapidPrivate = flag.String("vapid_private", "", "VAPID private key")
+	vapidPublic  = flag.String("vapid_public", "", "VAPID public key, instead of the one made by the vapid command")
+	vapidPrivate = flag.String("vapid_private", "", "VAPID private key, instead of the one made by the vapid command")
 )
 
 func addSubHandler(w http.ResponseWriter, r *http.Request) *appError {
@@ -44,6 +47,9 @@ func addSubHandler(w http.ResponseWriter, r *http.Request) *appError {
 		Host:      r.Header.Get("X-Forwarded-For"),
 		Cookie:    cookie.Value,
 	}
+	if u := sessionFrom(r).User; u != nil {
+		sub.User = u.ID
+	}
 	if _, err := syndicate.DB.AddSubscription(sub); err != nil {
 		return appErrorf(err, "error adding subscription: %v", err)
 	}
@@ -85,52 +91,176 @@ type subMessage struct {
 	Message, URI string
 }
 
-func sendAllSubscribers(msg subMessage, uuid string) error {
+// errGone is returned by sendPush when the push service no longer has the
+// subscription.
+var errGone = errors.New("subscription gone")
+
+// sendPush sends the message to a subscription.
+func sendPush(sub *syndicate.Subscription, msg subMessage) error {
 	data, err := json.Marshal(msg)
 	if err != nil {
 		return err
 	}
-	subs, err := syndicate.DB.ListSubscriptions()
+	s := &webpush.Subscription{
+		Endpoint: sub.Endpoint,
+		Keys: webpush.Keys{
+			Auth:   sub.Auth,
+			P256dh: sub.Key,
+		},
+	}
+	resp, err := webpush.SendNotification(data, s, &webpush.Options{
+		TTL:             20 * 60 * 60,
+		VAPIDPublicKey:  *vapidPublic,
+		VAPIDPrivateKey: *vapidPrivate,
+	})
 	if err != nil {
 		return err
 	}
-	for _, sub := range subs {
-		if sub.Cookie == uuid {
-			continue
-		}
-		s := &webpush.Subscription{
-			Endpoint: sub.Endpoint,
-			Keys: webpush.Keys{
-				Auth:   sub.Auth,
-				P256dh: sub.Key,
-			},
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusGone || resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%w: %s: %s", errGone, resp.Status, b)
+	case resp.StatusCode == http.StatusForbidden:
+		// The subscription was made with other VAPID keys, so it is kept
+		// and retried once the configuration is fixed.
+		return fmt.Errorf("configuration error, push service refused the VAPID keys (check -vapid_public and -vapid_private): %s: %s", resp.Status, b)
+	}
+	return fmt.Errorf("push service replied %s: %s", resp.Status, b)
+}
+
+// notificationsHandler shows the browser's push subscriptions and who has
+// claimed them, with a form to claim them.
+func notificationsHandler(w http.ResponseWriter, r *http.Request) *appError {
+	s := sessionFrom(r)
+	subs, err := browserSubscriptions(s)
+	if err != nil {
+		return appErrorf(err, "could not list subscriptions: %v", err)
+	}
+	users, err := syndicate.DB.ListUsers()
+	if err != nil {
+		return appErrorf(err, "could not fetch user list: %v", err)
+	}
+	type eventPref struct {
+		Type        syndicate.EventType
+		Description string
+		ForUser     bool
+		On          bool
+	}
+	data := struct {
+		Subscriptions []*syndicate.Subscription
+		Claimed       *syndicate.User
+		Users         []*syndicate.User
+		Events        []eventPref
+	}{Subscriptions: subs}
+	if len(subs) > 0 && subs[0].User != 0 {
+		if data.Claimed, err = syndicate.DB.GetUser(subs[0].User); err != nil {
+			return appErrorf(err, "could not get user: %v", err)
 		}
-		log.Printf("Send to endpoint: %s\n", sub.Endpoint)
-		resp, err := webpush.SendNotification(data, s, &webpush.Options{
-			TTL:             20 * 60 * 60,
-			VAPIDPublicKey:  *vapidPublic,
-			VAPIDPrivateKey: *vapidPrivate,
+	}
+	for _, t := range syndicate.EventTypes {
+		data.Events = append(data.Events, eventPref{
+			Type:        t,
+			Description: t.Description(),
+			ForUser:     t.ForUser(),
+			On:          len(subs) > 0 && !subs[0].Mutes(t),
 		})
-		if err != nil {
-			log.Printf("Error sending notification: %v", err)
-			continue
+	}
+	for _, u := range users {
+		if !u.Retired && canActAs(s, u.ID) {
+			data.Users = append(data.Users, u)
 		}
-		b, _ := ioutil.ReadAll(resp.Body)
-		switch resp.StatusCode {
-		case http.StatusCreated: // 201
-			log.Printf(" Sent: %s", string(b))
-		case http.StatusGone, http.StatusForbidden: // 410, no more endpoint.
-			log.Printf(" Gone: %s", string(b))
-			if err := syndicate.DB.DeleteSubscription(sub.ID); err != nil {
-				log.Printf("Error removing subscription: %v", err)
-			} else {
-				log.Printf("  Deleted subscription.")
-			}
-		default:
-			log.Printf(" Unknown response code: %s", resp.Status)
-			log.Printf("  Message: %s", string(b))
+	}
+	return notificationsTmpl.Execute(w, r, data)
+}
+
+// canActAs returns true if the browser may act for the user, such as
+// recording their checkouts and contributions, claiming its subscriptions or
+// answering their check-in suggestions. When
+// users log in they can only act for themselves, unless they are admins.
+func canActAs(s *session, user int64) bool {
+	if !*authEnabled || (s.Admin && adminEnabled()) {
+		return true
+	}
+	return s.User != nil && s.User.ID == user
+}
+
+// claimHandler claims the browser's push subscriptions for a user, so they
+// get the notifications addressed to that user. User 0 unclaims them.
+func claimHandler(w http.ResponseWriter, r *http.Request) *appError {
+	s := sessionFrom(r)
+	user, err := strconv.ParseInt(r.FormValue("userid"), 10, 64)
+	if err != nil {
+		return appErrorf(err, "error parsing user id: %v", err)
+	}
+	if user != 0 {
+		if err := activeUserExists(user); err != nil {
+			return appErrorf(err, "invalid user id %d: %v", user, err)
+		}
+		if !canActAs(s, user) {
+			return &appError{Message: "you can only claim this browser for yourself", Code: http.StatusForbidden}
+		}
+	}
+	n, err := syndicate.DB.ClaimSubscriptions(s.Cookie, user)
+	if err != nil {
+		return appErrorf(err, "could not claim subscriptions: %v", err)
+	}
+	if n == 0 {
+		return &appError{Message: "this browser has not subscribed to notifications", Code: http.StatusBadRequest}
+	}
+	http.Redirect(w, r, "/notifications", http.StatusFound)
+	return nil
+}
+
+// browserSubscriptions returns the push subscriptions of the session's
+// browser.
+func browserSubscriptions(s *session) ([]*syndicate.Subscription, error) {
+	if s.Cookie == "" {
+		return nil, nil
+	}
+	subs, err := syndicate.DB.ListSubscriptions()
+	if err != nil {
+		return nil, err
+	}
+	var mine []*syndicate.Subscription
+	for _, sub := range subs {
+		if sub.Cookie == s.Cookie {
+			mine = append(mine, sub)
+		}
+	}
+	return mine, nil
+}
+
+// notificationEventsHandler sets which events the browser's push
+// subscriptions receive, from the checked event types.
+func notificationEventsHandler(w http.ResponseWriter, r *http.Request) *appError {
+	subs, err := browserSubscriptions(sessionFrom(r))
+	if err != nil {
+		return appErrorf(err, "could not list subscriptions: %v", err)
+	}
+	if len(subs) == 0 {
+		return &appError{Message: "this browser has not subscribed to notifications", Code: http.StatusBadRequest}
+	}
+	if err := r.ParseForm(); err != nil {
+		return &appError{Error: err, Message: "could not parse form", Code: http.StatusBadRequest}
+	}
+	on := map[syndicate.EventType]bool{}
+	for _, t := range r.Form["event"] {
+		on[syndicate.EventType(t)] = true
+	}
+	var muted []syndicate.EventType
+	for _, t := range syndicate.EventTypes {
+		if !on[t] {
+			muted = append(muted, t)
+		}
+	}
+	for _, sub := range subs {
+		if err := syndicate.DB.SetSubscriptionMuted(sub.ID, muted); err != nil {
+			return appErrorf(err, "could not set notification events: %v", err)
 		}
-		resp.Body.Close()
 	}
+	http.Redirect(w, r, "/notifications", http.StatusFound)
 	return nil
 }
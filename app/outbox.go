@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/buxtronix/syndicate"
+	"github.com/gorilla/mux"
+)
+
+var (
+	outboxInterval      = flag.Duration("outbox_interval", 5*time.Second, "How often to send notifications waiting in the outbox")
+	maxDeliveryAttempts = flag.Int("max_delivery_attempts", 10, "Number of failed attempts to send a notification after which it is given up on")
+)
+
+const (
+	// minRetryDelay is how long to wait after a first failed attempt to
+	// send a notification. It doubles with each further failure, up to
+	// maxRetryDelay.
+	minRetryDelay = 30 * time.Second
+	maxRetryDelay = 6 * time.Hour
+	// outboxBatch is the most notifications sent at once.
+	outboxBatch = 100
+)
+
+// retryDelay returns how long to wait before retrying a notification after
+// the given number of failed attempts.
+func retryDelay(attempts int) time.Duration {
+	d := minRetryDelay
+	for i := 1; i < attempts && d < maxRetryDelay; i++ {
+		d *= 2
+	}
+	if d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	return d
+}
+
+// runOutbox sends notifications from the outbox as they become due.
+func runOutbox() {
+	for range time.Tick(*outboxInterval) {
+		if err := sendOutbox(); err != nil {
+			log.Printf("Could not send notifications: %v", err)
+		}
+	}
+}
+
+// sendOutbox sends the notifications in the outbox that are due.
+func sendOutbox() error {
+	dls, err := syndicate.DB.DueDeliveries(time.Now(), outboxBatch)
+	if err != nil || len(dls) == 0 {
+		return err
+	}
+	subs, err := syndicate.DB.ListSubscriptions()
+	if err != nil {
+		return err
+	}
+	byID := map[int64]*syndicate.Subscription{}
+	for _, sub := range subs {
+		byID[sub.ID] = sub
+	}
+	gone := map[int64]bool{}
+	for _, dl := range dls {
+		if !gone[dl.Subscription] {
+			gone[dl.Subscription] = sendDelivery(dl, byID[dl.Subscription])
+		}
+	}
+	return nil
+}
+
+// sendDelivery sends a notification from the outbox, removing it once sent
+// and otherwise scheduling a retry. It returns true if the subscription no
+// longer exists, which removes the rest of its notifications.
+func sendDelivery(dl *syndicate.Delivery, sub *syndicate.Subscription) (gone bool) {
+	if sub == nil {
+		return true
+	}
+	message, uri, err := dl.Event.Notification(syndicate.DB)
+	if errors.Is(err, syndicate.ErrNotFound) {
+		// The change has been deleted since, so there is nothing to tell.
+		deleteDelivery(dl)
+		return false
+	}
+	if err == nil {
+		err = sendPush(sub, subMessage{Message: message, URI: uri})
+	}
+	switch {
+	case err == nil:
+		deleteDelivery(dl)
+	case errors.Is(err, errGone):
+		log.Printf("Removing subscription %d: %v", sub.ID, err)
+		if err := syndicate.DB.DeleteSubscription(sub.ID); err != nil {
+			log.Printf("Could not remove subscription %d: %v", sub.ID, err)
+		}
+		return true
+	default:
+		attempts := dl.Attempts + 1
+		dead := attempts >= *maxDeliveryAttempts
+		log.Printf("Could not send %s notification %d to subscription %d, attempt %d: %v", dl.Event.Type, dl.ID, sub.ID, attempts, err)
+		if err := syndicate.DB.FailDelivery(dl.ID, err.Error(), time.Now().Add(retryDelay(attempts)), dead); err != nil {
+			log.Printf("Could not record failed notification %d: %v", dl.ID, err)
+		}
+	}
+	return false
+}
+
+func deleteDelivery(dl *syndicate.Delivery) {
+	if err := syndicate.DB.DeleteDelivery(dl.ID); err != nil {
+		log.Printf("Could not remove notification %d from outbox: %v", dl.ID, err)
+	}
+}
+
+// outboxRow is a notification shown in the outbox.
+type outboxRow struct {
+	*syndicate.Delivery
+	// To is the user who claimed the subscription, or empty.
+	To string
+	// UserAgent is the subscriber's user agent.
+	UserAgent string
+}
+
+// outboxHandler lists the notifications waiting to be sent and those given
+// up on.
+func outboxHandler(w http.ResponseWriter, r *http.Request) *appError {
+	dls, err := syndicate.DB.ListDeliveries()
+	if err != nil {
+		return appErrorf(err, "could not list outbox: %v", err)
+	}
+	subs, err := syndicate.DB.ListSubscriptions()
+	if err != nil {
+		return appErrorf(err, "could not list subscriptions: %v", err)
+	}
+	users, err := syndicate.DB.ListUsers()
+	if err != nil {
+		return appErrorf(err, "could not fetch user list: %v", err)
+	}
+	userNames := map[int64]string{}
+	for _, u := range users {
+		userNames[u.ID] = u.Name
+	}
+	bySub := map[int64]*syndicate.Subscription{}
+	for _, sub := range subs {
+		bySub[sub.ID] = sub
+	}
+	data := struct {
+		Pending, Failed []outboxRow
+		MaxAttempts     int
+	}{MaxAttempts: *maxDeliveryAttempts}
+	for _, dl := range dls {
+		row := outboxRow{Delivery: dl}
+		if sub := bySub[dl.Subscription]; sub != nil {
+			row.To = userNames[sub.User]
+			row.UserAgent = sub.UserAgent
+		}
+		if dl.Failed {
+			data.Failed = append(data.Failed, row)
+		} else {
+			data.Pending = append(data.Pending, row)
+		}
+	}
+	return outboxTmpl.Execute(w, r, data)
+}
+
+// outboxRetryHandler makes a notification due to be sent now. One given up
+// on gets a single further attempt.
+func outboxRetryHandler(w http.ResponseWriter, r *http.Request) *appError {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return appErrorf(err, "could not parse notification id: %v", err)
+	}
+	if err := syndicate.DB.RetryDelivery(id); err != nil {
+		return appErrorf(err, "could not retry notification: %v", err)
+	}
+	http.Redirect(w, r, "/outbox", http.StatusFound)
+	return nil
+}
+
+// outboxDeleteHandler removes a notification from the outbox unsent.
+func outboxDeleteHandler(w http.ResponseWriter, r *http.Request) *appError {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return appErrorf(err, "could not parse notification id: %v", err)
+	}
+	if err := syndicate.DB.DeleteDelivery(id); err != nil {
+		return appErrorf(err, "could not remove notification: %v", err)
+	}
+	http.Redirect(w, r, "/outbox", http.StatusFound)
+	return nil
+}
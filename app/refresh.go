@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/buxtronix/syndicate"
+	"github.com/gorilla/mux"
+)
+
+var (
+	refreshAge     = flag.Duration("refresh_age", 7*24*time.Hour, "How old beers' details get before they are refreshed from the beer catalog, or 0 to never")
+	refreshPerHour = flag.Int("refresh_per_hour", 20, "Most beers refreshed from the beer catalog per hour, to keep within Untappd's API rate limit")
+)
+
+// runRefresher refreshes the stalest beer's details from the catalog,
+// spreading the refreshes evenly over each hour.
+func runRefresher() {
+	db := syndicate.Audited(syndicate.DB, syndicate.Actor{RemoteAddr: "catalog refresh"})
+	for range time.Tick(time.Hour / time.Duration(*refreshPerHour)) {
+		b, err := syndicate.RefreshStalestBeer(db, syndicate.Catalog, time.Now().Add(-*refreshAge))
+		if err != nil {
+			log.Printf("Could not refresh beer details: %v", err)
+		} else if b != nil {
+			log.Printf("Refreshed details of beer %d, %s", b.ID, b.Name)
+		}
+	}
+}
+
+// beerRefreshHandler refreshes a beer's details from the catalog now.
+func beerRefreshHandler(w http.ResponseWriter, r *http.Request) *appError {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return appErrorf(err, "could not parse id: %v", err)
+	}
+	beer, err := syndicate.DB.GetBeer(id)
+	if err != nil {
+		return appErrorf(err, "could not get beer: %v", err)
+	}
+	if beer.UntappdID == 0 {
+		return &appError{Message: "beer has no Untappd ID to refresh it with", Code: http.StatusBadRequest}
+	}
+	if _, err := syndicate.RefreshFromCatalog(auditDB(r), syndicate.Catalog, beer); err != nil {
+		return appErrorf(err, "could not refresh beer: %v", err)
+	}
+	http.Redirect(w, r, "/beers/edit/"+strconv.FormatInt(id, 10), http.StatusFound)
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/buxtronix/syndicate"
+)
+
+var adminPassphrase = flag.String("admin_passphrase", "", "Passphrase granting the admin role. If unset, everyone is an admin")
+
+// adminCookie holds proof that the browser was given the admin passphrase.
+const adminCookie = "beersyndicate-admin"
+
+// loginCookie holds the token of the browser's login session.
+const loginCookie = "beersyndicate-session"
+
+// session is what is known about who is making a request.
+type session struct {
+	// Cookie is the browser's syndicate cookie, or empty for API clients
+	// without one.
+	Cookie string
+	// Admin is true if the request may delete and edit records and enter
+	// debits/credits.
+	Admin bool
+	// User is the user logged in to the browser, or nil.
+	User *syndicate.User
+	// token is the login session token.
+	token string
+}
+
+type sessionKey struct{}
+
+// newSession works out the session of a request.
+func newSession(r *http.Request) *session {
+	s := &session{}
+	if c, err := r.Cookie(syndicateCookie); err == nil {
+		s.Cookie = c.Value
+	}
+	s.Admin = isAdmin(r, s.Cookie)
+	if c, err := r.Cookie(loginCookie); err == nil && c.Value != "" {
+		s.token = c.Value
+		if u, err := syndicate.SessionUser(syndicate.DB, c.Value); err == nil {
+			s.User = u
+		} else if !errors.Is(err, syndicate.ErrNotFound) {
+			log.Printf("Could not get login session: %v", err)
+		}
+	}
+	return s
+}
+
+// withSession returns the request with its session added to the context.
+func withSession(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), sessionKey{}, newSession(r)))
+}
+
+// sessionFrom returns the session added to the request by withSession.
+func sessionFrom(r *http.Request) *session {
+	if s, ok := r.Context().Value(sessionKey{}).(*session); ok {
+		return s
+	}
+	return newSession(r)
+}
+
+// adminEnabled returns true if the admin role is restricted to some users.
+func adminEnabled() bool {
+	return *adminPassphrase != ""
+}
+
+// isAdmin returns true if the request has the admin role: its browser has
+// logged in with the passphrase and holds the signed admin cookie, or an API
+// client gave the passphrase as a bearer token.
+func isAdmin(r *http.Request, cookie string) bool {
+	if !adminEnabled() {
+		return true
+	}
+	if c, err := r.Cookie(adminCookie); err == nil && cookie != "" {
+		if hmac.Equal([]byte(c.Value), []byte(adminToken(cookie))) {
+			return true
+		}
+	}
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return checkPassphrase(strings.TrimPrefix(h, "Bearer "))
+	}
+	return false
+}
+
+// checkPassphrase returns true if p is the admin passphrase.
+func checkPassphrase(p string) bool {
+	return *adminPassphrase != "" && subtle.ConstantTimeCompare([]byte(p), []byte(*adminPassphrase)) == 1
+}
+
+// adminToken returns the admin cookie value for a browser's syndicate
+// cookie. Only someone knowing the passphrase can make it, and changing the
+// passphrase logs out every admin.
+func adminToken(cookie string) string {
+	m := hmac.New(sha256.New, []byte(*adminPassphrase))
+	m.Write([]byte(cookie))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// secureRequest returns true if the request was made over HTTPS, directly or
+// through a proxy, so cookies set in reply can be marked secure.
+func secureRequest(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+// errNotAdmin is the error for a request which needs the admin role.
+var errNotAdmin = &appError{Message: "this requires the admin role, see /admin", Code: http.StatusForbidden}
+
+// requireAdmin returns a handler which only runs fn for admins.
+func requireAdmin(fn appHandler) appHandler {
+	return func(w http.ResponseWriter, r *http.Request) *appError {
+		if !sessionFrom(r).Admin {
+			return errNotAdmin
+		}
+		return fn(w, r)
+	}
+}
+
+// requireAdminAPI returns an API handler which only runs fn for admins.
+func requireAdminAPI(fn apiHandler) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) (interface{}, *appError) {
+		if !sessionFrom(r).Admin {
+			return nil, errNotAdmin
+		}
+		return fn(w, r)
+	}
+}
+
+// adminHandler shows whether the browser has the admin role, with a form to
+// log in with the passphrase.
+func adminHandler(w http.ResponseWriter, r *http.Request) *appError {
+	data := struct {
+		Enabled bool
+		Admin   bool
+	}{
+		Enabled: adminEnabled(),
+		Admin:   sessionFrom(r).Admin,
+	}
+	return adminTmpl.Execute(w, r, data)
+}
+
+// adminLoginHandler gives the browser the admin role if it sent the
+// passphrase.
+func adminLoginHandler(w http.ResponseWriter, r *http.Request) *appError {
+	s := sessionFrom(r)
+	if !checkPassphrase(r.FormValue("passphrase")) {
+		return &appError{Message: "wrong passphrase", Code: http.StatusForbidden}
+	}
+	if s.Cookie == "" {
+		return &appError{Message: fmt.Sprintf("missing %s cookie", syndicateCookie), Code: http.StatusBadRequest}
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     adminCookie,
+		Value:    adminToken(s.Cookie),
+		Expires:  time.Now().Add(24 * time.Hour * 30),
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   secureRequest(r),
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, "/admin", http.StatusFound)
+	return nil
+}
+
+// adminLogoutHandler drops the browser's admin role.
+func adminLogoutHandler(w http.ResponseWriter, r *http.Request) *appError {
+	http.SetCookie(w, &http.Cookie{Name: adminCookie, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/admin", http.StatusFound)
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsAdmin(t *testing.T) {
+	old := *adminPassphrase
+	t.Cleanup(func() { *adminPassphrase = old })
+	*adminPassphrase = "secret"
+
+	for _, tt := range []struct {
+		name   string
+		cookie string
+		admin  string
+		bearer string
+		want   bool
+	}{
+		{name: "no cookies"},
+		{name: "syndicate cookie only", cookie: "browser"},
+		{name: "signed admin cookie", cookie: "browser", admin: adminToken("browser"), want: true},
+		{name: "admin cookie of another browser", cookie: "other", admin: adminToken("browser")},
+		{name: "forged admin cookie", cookie: "browser", admin: "browser"},
+		{name: "admin cookie without syndicate cookie", admin: adminToken("")},
+		{name: "bearer passphrase", bearer: "secret", want: true},
+		{name: "wrong bearer passphrase", bearer: "guess"},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: syndicateCookie, Value: tt.cookie})
+		}
+		if tt.admin != "" {
+			r.AddCookie(&http.Cookie{Name: adminCookie, Value: tt.admin})
+		}
+		if tt.bearer != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.bearer)
+		}
+		if got := isAdmin(r, tt.cookie); got != tt.want {
+			t.Errorf("%s: isAdmin = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	*adminPassphrase = ""
+	if !isAdmin(httptest.NewRequest("GET", "/", nil), "") {
+		t.Errorf("isAdmin without a passphrase = false, want everyone an admin")
+	}
+}
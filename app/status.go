@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"time"
+
+	"github.com/buxtronix/syndicate"
+)
+
+var (
+	untappdInfoTTL   = flag.Duration("untappd_info_ttl", 6*time.Hour, "How long beer details from Untappd are cached for")
+	untappdSearchTTL = flag.Duration("untappd_search_ttl", time.Hour, "How long Untappd search results are cached for")
+	untappdReserve   = flag.Int("untappd_reserve", 10, "Untappd API calls to keep in hand; once no more remain, calls wait for the quota to be restored and cached results are served")
+)
+
+// configureUntappd applies the Untappd caching and rate limit flags.
+func configureUntappd() {
+	syndicate.Untappd.InfoTTL = *untappdInfoTTL
+	syndicate.Untappd.SearchTTL = *untappdSearchTTL
+	syndicate.Untappd.Reserve = *untappdReserve
+}
+
+// statusHandler shows the state of the beer catalog and the Untappd API
+// quota.
+func statusHandler(w http.ResponseWriter, r *http.Request) *appError {
+	data := struct {
+		Catalog     string
+		Untappd     bool
+		Quota       syndicate.UntappdQuota
+		InfoTTL     time.Duration
+		SearchTTL   time.Duration
+		RefreshAge  time.Duration
+		RefreshRate int
+	}{
+		Catalog:     *catalogName,
+		Untappd:     syndicate.Untappd != nil,
+		InfoTTL:     *untappdInfoTTL,
+		SearchTTL:   *untappdSearchTTL,
+		RefreshAge:  *refreshAge,
+		RefreshRate: *refreshPerHour,
+	}
+	if data.Untappd {
+		data.Quota = syndicate.Untappd.Quota()
+	}
+	return statusTmpl.Execute(w, r, data)
+}
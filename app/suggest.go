@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/buxtronix/syndicate"
+	"github.com/gorilla/mux"
+	"github.com/mdlayher/untappd"
+)
+
+var checkinSyncInterval = flag.Duration("checkin_sync_interval", time.Hour, "How often to look through users' Untappd check-ins for beer to suggest checking out, or 0 to never")
+
+// checkinSyncCount is the number of each user's latest check-ins looked
+// through.
+const checkinSyncCount = 25
+
+// untappdEnabled returns true if the Untappd API can be used.
+func untappdEnabled() bool {
+	return *untappdID != "" && *untappdSecret != ""
+}
+
+// runCheckinSync suggests checkouts from users' check-ins now and then
+// periodically.
+func runCheckinSync() {
+	syncCheckins()
+	for range time.Tick(*checkinSyncInterval) {
+		syncCheckins()
+	}
+}
+
+// syncCheckins suggests checkouts from users' latest check-ins.
+func syncCheckins() (int, error) {
+	n, err := syndicate.SyncCheckins(syndicate.DB, func(id string) ([]*untappd.Checkin, error) {
+		return syndicate.Untappd.GetUserCheckins(id, checkinSyncCount)
+	})
+	if err != nil {
+		log.Printf("Could not sync Untappd check-ins: %v", err)
+	} else if n > 0 {
+		log.Printf("Suggested %d checkouts from Untappd check-ins", n)
+	}
+	return n, err
+}
+
+// suggestionsHandler lists the pending suggestions the browser can answer.
+func suggestionsHandler(w http.ResponseWriter, r *http.Request) *appError {
+	s := sessionFrom(r)
+	sgs, err := syndicate.DB.ListSuggestions(0, syndicate.SuggestionPending)
+	if err != nil {
+		return appErrorf(err, "could not list suggestions: %v", err)
+	}
+	data := struct {
+		Suggestions []*syndicate.Suggestion
+		Syncing     bool
+		Admin       bool
+	}{
+		Syncing: untappdEnabled() && *checkinSyncInterval > 0,
+		Admin:   s.Admin,
+	}
+	for _, sg := range sgs {
+		if canActAs(s, sg.User) {
+			data.Suggestions = append(data.Suggestions, sg)
+		}
+	}
+	return suggestionsTmpl.Execute(w, r, data)
+}
+
+// answerableSuggestion returns the suggestion in the request, if the
+// browser may answer it.
+func answerableSuggestion(r *http.Request) (*syndicate.Suggestion, *appError) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return nil, appErrorf(err, "could not parse suggestion id: %v", err)
+	}
+	sg, err := syndicate.DB.GetSuggestion(id)
+	if err != nil {
+		return nil, appErrorf(err, "could not get suggestion: %v", err)
+	}
+	if !canActAs(sessionFrom(r), sg.User) {
+		return nil, &appError{Message: "you can only answer your own suggestions", Code: http.StatusForbidden}
+	}
+	return sg, nil
+}
+
+// suggestionConfirmHandler checks out the beer of a suggestion, a bottle
+// unless the form gives another quantity.
+func suggestionConfirmHandler(w http.ResponseWriter, r *http.Request) *appError {
+	sg, appErr := answerableSuggestion(r)
+	if appErr != nil {
+		return appErr
+	}
+	twelfths := int64(12)
+	if v := r.FormValue("twelfths"); v != "" {
+		var err error
+		if twelfths, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return appErrorf(err, "error parsing quantity: %v", err)
+		}
+	}
+	if err := activeUserExists(sg.User); err != nil {
+		return appErrorf(err, "invalid user id %d: %v", sg.User, err)
+	}
+	if _, err := auditDB(r).ConfirmSuggestion(sg.ID, twelfths); err != nil {
+		var stockErr *syndicate.InsufficientStockError
+		if errors.As(err, &stockErr) {
+			return &appError{Error: err, Message: stockErr.Error(), Code: http.StatusConflict}
+		}
+		return appErrorf(err, "could not confirm suggestion: %v", err)
+	}
+	http.Redirect(w, r, "/suggestions", http.StatusFound)
+	return nil
+}
+
+// suggestionDismissHandler dismisses a suggestion, so it is not offered
+// again.
+func suggestionDismissHandler(w http.ResponseWriter, r *http.Request) *appError {
+	sg, appErr := answerableSuggestion(r)
+	if appErr != nil {
+		return appErr
+	}
+	if err := syndicate.DB.DismissSuggestion(sg.ID); err != nil {
+		return appErrorf(err, "could not dismiss suggestion: %v", err)
+	}
+	http.Redirect(w, r, "/suggestions", http.StatusFound)
+	return nil
+}
+
+// suggestionSyncHandler looks through users' check-ins now, rather than
+// waiting for the next sync.
+func suggestionSyncHandler(w http.ResponseWriter, r *http.Request) *appError {
+	if !untappdEnabled() {
+		return &appError{Message: "Untappd is not set up", Code: http.StatusNotFound}
+	}
+	if _, err := syncCheckins(); err != nil {
+		return appErrorf(err, "could not sync check-ins: %v", err)
+	}
+	http.Redirect(w, r, "/suggestions", http.StatusFound)
+	return nil
+}
@@ -5,8 +5,11 @@ import (
 	"html/template"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"strings"
+
+	"github.com/buxtronix/syndicate"
 )
 
 // parseTemplate applies a given file to the body of the base template.
@@ -31,21 +34,28 @@ type appTemplate struct {
 	t *template.Template
 }
 
-// Execute writes the template using the provided data, adding login and user
-// information to the base template.
+// Execute writes the template using the provided data, adding login, user
+// and admin information to the base template.
 func (tmpl *appTemplate) Execute(w http.ResponseWriter, r *http.Request, data interface{}) *appError {
 	page := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
 	d := struct {
-		Data        interface{}
-		AuthEnabled bool
-		LoginURL    string
-		LogoutURL   string
-		Page        string
+		Data         interface{}
+		AuthEnabled  bool
+		LoginURL     string
+		LogoutURL    string
+		Page         string
+		AdminEnabled bool
+		Admin        bool
+		User         *syndicate.User
 	}{
-		Data:      data,
-		LoginURL:  "/login?redirect=" + r.URL.RequestURI(),
-		LogoutURL: "/logout?redirect=" + r.URL.RequestURI(),
-		Page:      page,
+		Data:         data,
+		AuthEnabled:  *authEnabled,
+		LoginURL:     "/login?redirect=" + url.QueryEscape(r.URL.RequestURI()),
+		LogoutURL:    "/logout?redirect=" + url.QueryEscape(r.URL.RequestURI()),
+		Page:         page,
+		AdminEnabled: adminEnabled(),
+		Admin:        sessionFrom(r).Admin,
+		User:         sessionFrom(r).User,
 	}
 
 	if err := tmpl.t.Execute(w, d); err != nil {
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	webpush "github.com/SherClockHolmes/webpush-go"
+)
+
+// vapidKeysFile is the file in the data directory, alongside the database,
+// holding the VAPID keys made by the vapid command.
+const vapidKeysFile = "vapid.json"
+
+// vapidKeys are the keys identifying this server to push services.
+type vapidKeys struct {
+	Public  string `json:"public"`
+	Private string `json:"private"`
+}
+
+// vapidKeysPath returns the path of the VAPID keys file.
+func vapidKeysPath() string {
+	return filepath.Join(filepath.Dir(*dbFile), vapidKeysFile)
+}
+
+// loadVAPIDKeys sets the VAPID keys from the keys file, unless they were
+// given as flags. It returns false if there are no keys, so notifications
+// cannot be sent.
+func loadVAPIDKeys() (bool, error) {
+	switch {
+	case *vapidPublic != "" && *vapidPrivate != "":
+		return true, nil
+	case *vapidPublic != "" || *vapidPrivate != "":
+		return false, errors.New("-vapid_public and -vapid_private must be given together")
+	}
+	b, err := ioutil.ReadFile(vapidKeysPath())
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	var keys vapidKeys
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return false, fmt.Errorf("could not read %s: %v", vapidKeysPath(), err)
+	}
+	if keys.Public == "" || keys.Private == "" {
+		return false, fmt.Errorf("%s is missing a key", vapidKeysPath())
+	}
+	*vapidPublic, *vapidPrivate = keys.Public, keys.Private
+	return true, nil
+}
+
+// vapidCommand generates VAPID keys and saves them to the keys file, and
+// returns the exit status.
+func vapidCommand(args []string) int {
+	fs := flag.NewFlagSet("vapid", flag.ExitOnError)
+	force := fs.Bool("force", false, "Replace existing keys, which stops notifications to every browser until it subscribes again")
+	fs.Parse(args)
+
+	path := vapidKeysPath()
+	if _, err := os.Stat(path); err == nil && !*force {
+		log.Printf("%s already exists; use -force to replace the keys", path)
+		return 1
+	}
+	var keys vapidKeys
+	var err error
+	if keys.Private, keys.Public, err = webpush.GenerateVAPIDKeys(); err != nil {
+		log.Printf("Could not generate keys: %v", err)
+		return 1
+	}
+	b, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		log.Printf("Could not encode keys: %v", err)
+		return 1
+	}
+	if err := ioutil.WriteFile(path, append(b, '\n'), 0600); err != nil {
+		log.Printf("Could not save keys: %v", err)
+		return 1
+	}
+	fmt.Printf("Saved VAPID keys to %s\nPublic key: %s\n", path, keys.Public)
+	return 0
+}
+
+// vapidPublicHandler serves the VAPID public key, which browsers need to
+// subscribe to notifications.
+func vapidPublicHandler(w http.ResponseWriter, r *http.Request) *appError {
+	if *vapidPublic == "" {
+		return &appError{Message: "notifications are not set up", Code: http.StatusNotFound}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, *vapidPublic)
+	return nil
+}
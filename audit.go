@@ -0,0 +1,255 @@
+package syndicate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Audit log actions.
+const (
+	AuditInsert   = "insert"
+	AuditEdit     = "edit"
+	AuditDelete   = "delete"
+	AuditMerge    = "merge"
+	AuditRestore  = "restore"
+	AuditPurge    = "purge"
+	AuditPassword = "password"
+)
+
+// Tables recorded in the audit log.
+const (
+	TableUsers         = "users"
+	TableBeers         = "beers"
+	TableContributions = "contributions"
+	TableCheckouts     = "checkouts"
+	TableDebitCredits  = "debitsCredits"
+)
+
+// Actor identifies who made a change, as far as the syndicate can tell
+// without authentication.
+type Actor struct {
+	// RemoteAddr is the network address the change came from.
+	RemoteAddr string
+	// Cookie is the browser's beersyndicate-uuid cookie. Only its
+	// fingerprint is kept in the audit log.
+	Cookie string
+	// User is the id of the user logged in to the browser, or 0.
+	User int64
+}
+
+// CookieFingerprint returns a short fingerprint of a browser's cookie, which
+// tells browsers apart in the audit log without revealing the cookie.
+func CookieFingerprint(cookie string) string {
+	if cookie == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(cookie))
+	return hex.EncodeToString(sum[:])[:8]
+}
+
+// AuditEntry records a single change to the database.
+type AuditEntry struct {
+	// ID is the primary key.
+	ID int64
+	// Time is when the change was made.
+	Time time.Time
+	// Action is one of the Audit* actions.
+	Action string
+	// Table is the table changed, one of the Table* names.
+	Table string
+	// Record is the id of the changed record.
+	Record int64
+	// Before is the record as JSON before the change, if it existed.
+	Before string
+	// After is the record as JSON after the change, if it still exists.
+	After string
+	// Actor is who made the change.
+	Actor Actor
+}
+
+// Undoable returns true if the change can be undone by Undo.
+func (e *AuditEntry) Undoable() bool {
+	return e.Action == AuditDelete && e.Before != ""
+}
+
+// Audited returns a BeerDatabase that records every insert, edit and delete
+// made through it in the audit log of db, attributed to the actor. Each
+// entry is added in the transaction making the change, so a change which
+// cannot be recorded is not made. Subscriptions and login sessions are not
+// recorded, as they are browser registrations rather than syndicate
+// records, nor are check-in suggestions. Password changes are recorded
+// without the hash.
+func Audited(db BeerDatabase, actor Actor) BeerDatabase {
+	a, ok := db.(interface{ audited(Actor) BeerDatabase })
+	if !ok {
+		panic(fmt.Sprintf("audit: %T cannot record an audit log", db))
+	}
+	return a.audited(actor)
+}
+
+// auditTx reads and writes in the transaction of a change, for recording it
+// in the audit log.
+type auditTx interface {
+	// getRecord returns the record with the id from the table, or
+	// ErrNotFound.
+	getRecord(table string, id int64) (interface{}, error)
+	// getDeleted returns the record with the id from the trash of the
+	// table, or nil if it is not there.
+	getDeleted(table string, id int64) (interface{}, error)
+	// addAuditEntry appends an entry to the audit log.
+	addAuditEntry(*AuditEntry) error
+}
+
+// auditLog records the changes made in a transaction, attributed to an
+// actor. A nil *auditLog, for a database that is not audited, records
+// nothing.
+type auditLog struct {
+	actor Actor
+	tx    auditTx
+}
+
+// newAuditLog returns the audit log of changes made in tx, or nil if actor
+// is nil. The actor's cookie is recorded as its fingerprint.
+func newAuditLog(actor *Actor, tx auditTx) *auditLog {
+	if actor == nil {
+		return nil
+	}
+	a := *actor
+	a.Cookie = CookieFingerprint(a.Cookie)
+	return &auditLog{actor: a, tx: tx}
+}
+
+// record adds an entry to the audit log. Before and after are encoded as
+// JSON, with nil meaning the record did not exist.
+func (l *auditLog) record(action, table string, id int64, before, after interface{}) error {
+	if l == nil {
+		return nil
+	}
+	e := &AuditEntry{
+		Time:   time.Now(),
+		Action: action,
+		Table:  table,
+		Record: id,
+		Before: auditJSON(before),
+		After:  auditJSON(after),
+		Actor:  l.actor,
+	}
+	if err := l.tx.addAuditEntry(e); err != nil {
+		return fmt.Errorf("audit: could not record %s of %s id %d: %v", action, table, id, err)
+	}
+	return nil
+}
+
+// auditJSON returns v encoded as JSON, or "" if v is nil.
+func auditJSON(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("audit: could not encode %T: %v", v, err)
+		return ""
+	}
+	return string(b)
+}
+
+// added records the insert or restore of records, as they are now.
+func (l *auditLog) added(action, table string, ids ...int64) error {
+	if l == nil {
+		return nil
+	}
+	for _, id := range ids {
+		after, err := l.tx.getRecord(table, id)
+		if err != nil {
+			return err
+		}
+		if err := l.record(action, table, id, nil, after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// change reads a record before an edit, delete or purge of it, returning a
+// function which records the change once it is made. A missing record is
+// left for the change itself to report.
+func (l *auditLog) change(action, table string, id int64) (func() error, error) {
+	if l == nil {
+		return func() error { return nil }, nil
+	}
+	var (
+		before interface{}
+		err    error
+	)
+	if action == AuditPurge {
+		before, err = l.tx.getDeleted(table, id)
+	} else if before, err = l.tx.getRecord(table, id); errors.Is(err, ErrNotFound) {
+		before, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return func() error {
+		var after interface{}
+		if action == AuditEdit {
+			var err error
+			if after, err = l.tx.getRecord(table, id); err != nil {
+				return err
+			}
+		}
+		return l.record(action, table, id, before, after)
+	}, nil
+}
+
+// merged records the merge of a duplicate beer into the canonical one,
+// against the duplicate with the canonical beer as its after state. It
+// returns a function to call once they are merged.
+func (l *auditLog) merged(duplicate, canonical int64) (func() error, error) {
+	if l == nil {
+		return func() error { return nil }, nil
+	}
+	before, err := l.tx.getRecord(TableBeers, duplicate)
+	if errors.Is(err, ErrNotFound) {
+		before, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return func() error {
+		after, err := l.tx.getRecord(TableBeers, canonical)
+		if err != nil {
+			return err
+		}
+		return l.record(AuditMerge, TableBeers, duplicate, before, after)
+	}, nil
+}
+
+// Undo restores the record removed by a delete recorded in the audit log.
+// Contributions, checkouts and debits/credits are restored from the trash,
+// and beers are re-created with their original id. If db is audited, the
+// restore is itself recorded.
+func Undo(db BeerDatabase, e *AuditEntry) error {
+	if !e.Undoable() {
+		return fmt.Errorf("cannot undo %s of %s id %d", e.Action, e.Table, e.Record)
+	}
+	switch e.Table {
+	case TableBeers:
+		b := &Beer{}
+		if err := json.Unmarshal([]byte(e.Before), b); err != nil {
+			return fmt.Errorf("could not decode audit entry %d: %v", e.ID, err)
+		}
+		return db.RestoreBeer(b)
+	case TableContributions:
+		return db.UndeleteContribution(e.Record)
+	case TableCheckouts:
+		return db.UndeleteCheckout(e.Record)
+	case TableDebitCredits:
+		return db.UndeleteDebitCredit(e.Record)
+	}
+	return fmt.Errorf("cannot undo delete from %s", e.Table)
+}
@@ -0,0 +1,149 @@
+package syndicate
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAudited(t *testing.T) {
+	d := openTestDB(t)
+	actor := Actor{RemoteAddr: "192.0.2.1:1234", Cookie: "cookie"}
+	a := Audited(d, actor)
+
+	user, err := a.AddUser(&User{Name: "alice"})
+	if err != nil {
+		t.Fatalf("AddUser: %v", err)
+	}
+	beer, err := a.AddBeer(&Beer{Name: "Pale Ale"})
+	if err != nil {
+		t.Fatalf("AddBeer: %v", err)
+	}
+	cont, err := a.AddContribution(&Contribution{User: user, Beer: beer, Quantity: 2, UnitPrice: 450, Date: time.Unix(1000, 0)})
+	if err != nil {
+		t.Fatalf("AddContribution: %v", err)
+	}
+	c, err := d.GetContribution(cont)
+	if err != nil {
+		t.Fatalf("GetContribution: %v", err)
+	}
+	c.Comment = "edited"
+	if err := a.EditContribution(c); err != nil {
+		t.Fatalf("EditContribution: %v", err)
+	}
+	if err := a.DeleteContribution(cont); err != nil {
+		t.Fatalf("DeleteContribution: %v", err)
+	}
+	// Failed changes are not recorded.
+	if err := a.DeleteContribution(cont); err == nil {
+		t.Errorf("DeleteContribution(%d) twice succeeded", cont)
+	}
+
+	entries, err := d.ListAuditEntries(0, 10)
+	if err != nil {
+		t.Fatalf("ListAuditEntries: %v", err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Action+" "+e.Table)
+		if want := (Actor{RemoteAddr: actor.RemoteAddr, Cookie: CookieFingerprint(actor.Cookie), User: actor.User}); e.Actor != want {
+			t.Errorf("entry %d actor = %+v, want %+v", e.ID, e.Actor, want)
+		}
+	}
+	want := []string{"delete contributions", "edit contributions", "insert contributions", "insert beers", "insert users"}
+	if len(got) != len(want) {
+		t.Fatalf("audit log = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("audit log = %q, want %q", got, want)
+			break
+		}
+	}
+	del := entries[0]
+	if del.Record != cont || del.Before == "" || del.After != "" || !del.Undoable() {
+		t.Errorf("delete entry = %+v, want before and no after for contribution %d", del, cont)
+	}
+	if older, err := d.ListAuditEntries(entries[1].ID, 10); err != nil || len(older) != 3 {
+		t.Errorf("ListAuditEntries(%d) = %d entries, %v; want 3", entries[1].ID, len(older), err)
+	}
+
+	if err := Undo(a, del); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	restored, err := d.GetContribution(cont)
+	if err != nil {
+		t.Fatalf("GetContribution after undo: %v", err)
+	}
+	if *restored != *c {
+		t.Errorf("restored contribution = %+v, want %+v", restored, c)
+	}
+	if err := Undo(a, del); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Undo: got error %v, want ErrNotFound", err)
+	}
+	if latest, err := d.ListAuditEntries(0, 1); err != nil || latest[0].Action != AuditRestore {
+		t.Errorf("latest entry = %+v, %v; want restore", latest, err)
+	}
+	if err := Undo(a, entries[1]); err == nil {
+		t.Errorf("Undo of an edit succeeded")
+	}
+}
+
+func TestAuditedFailure(t *testing.T) {
+	d := openTestDB(t)
+	user, err := d.AddUser(&User{Name: "alice"})
+	if err != nil {
+		t.Fatalf("AddUser: %v", err)
+	}
+	if _, err := d.db.Exec(`CREATE TRIGGER audit_broken BEFORE INSERT ON audit BEGIN SELECT RAISE(ABORT, 'broken'); END`); err != nil {
+		t.Fatalf("breaking the audit log: %v", err)
+	}
+	a := Audited(d, Actor{RemoteAddr: "192.0.2.1:1234"})
+
+	// A change that cannot be recorded is not made.
+	if _, err := a.AddUser(&User{Name: "bob"}); err == nil {
+		t.Errorf("AddUser with a broken audit log succeeded")
+	}
+	if err := a.EditUser(&User{ID: user, Name: "alicia"}); err == nil {
+		t.Errorf("EditUser with a broken audit log succeeded")
+	}
+	users, err := d.ListUsers()
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	if len(users) != 1 || users[0].Name != "alice" {
+		t.Errorf("users = %+v, want only alice unchanged", users)
+	}
+}
+
+func TestAuditAppendOnly(t *testing.T) {
+	d := openTestDB(t)
+	if _, err := d.AddAuditEntry(&AuditEntry{Time: time.Now(), Action: AuditInsert, Table: TableUsers, Record: 1}); err != nil {
+		t.Fatalf("AddAuditEntry: %v", err)
+	}
+	if _, err := d.db.Exec(`UPDATE audit SET action = 'edit'`); err == nil {
+		t.Errorf("updating the audit log succeeded")
+	}
+	if _, err := d.db.Exec(`DELETE FROM audit`); err == nil {
+		t.Errorf("deleting from the audit log succeeded")
+	}
+}
+
+func TestUndeleteCheckoutStock(t *testing.T) {
+	d := openTestDB(t)
+	user, cont := addTestContribution(t, d, 1)
+	id, err := d.AddCheckout(&Checkout{User: user, Contribution: cont, Twelfths: 12, Date: time.Unix(1000, 0)})
+	if err != nil {
+		t.Fatalf("AddCheckout: %v", err)
+	}
+	if err := d.DeleteCheckout(id); err != nil {
+		t.Fatalf("DeleteCheckout: %v", err)
+	}
+	if _, err := d.AddCheckout(&Checkout{User: user, Contribution: cont, Twelfths: 6, Date: time.Now()}); err != nil {
+		t.Fatalf("AddCheckout: %v", err)
+	}
+	var stockErr *InsufficientStockError
+	if err := d.UndeleteCheckout(id); !errors.As(err, &stockErr) {
+		t.Errorf("UndeleteCheckout over-drawing: got error %v, want *InsufficientStockError", err)
+	}
+}
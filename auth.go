@@ -0,0 +1,112 @@
+package syndicate
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength is the length of the shortest PIN or password accepted.
+const MinPasswordLength = 4
+
+// ErrBadLogin is returned when logging in with the wrong PIN or password,
+// or as a user without one.
+var ErrBadLogin = errors.New("wrong user or password")
+
+// SetPassword sets the PIN or password a user logs in with, or removes it if
+// password is empty, ending any sessions they have.
+func SetPassword(db BeerDatabase, user int64, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	return db.SetPasswordHash(user, hash)
+}
+
+// EditUserPassword edits a user and sets their PIN or password as
+// SetPassword does, making both changes or neither.
+func EditUserPassword(db BeerDatabase, u *User, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	return db.EditUserPasswordHash(u, hash)
+}
+
+// hashPassword returns the hash stored for a PIN or password, or an empty
+// hash for an empty password.
+func hashPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	if len(password) < MinPasswordLength {
+		return "", fmt.Errorf("PIN or password must be at least %d characters", MinPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("could not hash password: %v", err)
+	}
+	return string(hash), nil
+}
+
+// CheckPassword returns nil if password is the user's PIN or password, or
+// ErrBadLogin.
+func CheckPassword(db BeerDatabase, user int64, password string) error {
+	hash, err := db.GetPasswordHash(user)
+	if errors.Is(err, ErrNotFound) {
+		return ErrBadLogin
+	} else if err != nil {
+		return err
+	}
+	if hash == "" || bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return ErrBadLogin
+	}
+	return nil
+}
+
+// Login starts a session for the user lasting ttl, returning the token
+// which identifies it. Only a hash of the token is stored.
+func Login(db BeerDatabase, user int64, ttl time.Duration) (token string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not make session token: %v", err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	s := &LoginSession{TokenHash: tokenHash(token), User: user, Expires: time.Now().Add(ttl)}
+	if err := db.AddLoginSession(s); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// SessionUser returns the user logged in with the session token, or
+// ErrNotFound if the session does not exist or has expired.
+func SessionUser(db BeerDatabase, token string) (*User, error) {
+	s, err := db.GetLoginSession(tokenHash(token))
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(s.Expires) {
+		if err := db.DeleteLoginSession(s.TokenHash); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: login session expired", ErrNotFound)
+	}
+	return db.GetUser(s.User)
+}
+
+// Logout ends the session with the token.
+func Logout(db BeerDatabase, token string) error {
+	return db.DeleteLoginSession(tokenHash(token))
+}
+
+func tokenHash(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
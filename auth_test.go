@@ -0,0 +1,89 @@
+package syndicate
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLogin(t *testing.T) {
+	d := openTestDB(t)
+	alice, err := d.AddUser(&User{Name: "alice"})
+	if err != nil {
+		t.Fatalf("AddUser: %v", err)
+	}
+	if err := CheckPassword(d, alice, ""); !errors.Is(err, ErrBadLogin) {
+		t.Errorf("CheckPassword without a password: got error %v, want ErrBadLogin", err)
+	}
+	if err := SetPassword(d, alice, "123"); err == nil {
+		t.Errorf("SetPassword with a short PIN succeeded")
+	}
+	if err := SetPassword(d, alice, "1234"); err != nil {
+		t.Fatalf("SetPassword: %v", err)
+	}
+	if u, err := d.GetUser(alice); err != nil || !u.HasPassword {
+		t.Errorf("GetUser = %+v, %v; want HasPassword", u, err)
+	}
+	if err := CheckPassword(d, alice, "1234"); err != nil {
+		t.Errorf("CheckPassword: %v", err)
+	}
+	if err := CheckPassword(d, alice, "4321"); !errors.Is(err, ErrBadLogin) {
+		t.Errorf("CheckPassword with the wrong PIN: got error %v, want ErrBadLogin", err)
+	}
+	if err := CheckPassword(d, alice+1, "1234"); !errors.Is(err, ErrBadLogin) {
+		t.Errorf("CheckPassword of a missing user: got error %v, want ErrBadLogin", err)
+	}
+
+	token, err := Login(d, alice, time.Hour)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if u, err := SessionUser(d, token); err != nil || u.ID != alice {
+		t.Errorf("SessionUser = %+v, %v; want alice", u, err)
+	}
+	if err := Logout(d, token); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if _, err := SessionUser(d, token); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SessionUser after Logout: got error %v, want ErrNotFound", err)
+	}
+
+	expired, err := Login(d, alice, -time.Second)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if _, err := SessionUser(d, expired); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SessionUser of expired session: got error %v, want ErrNotFound", err)
+	}
+
+	// Changing or removing the password ends the user's sessions.
+	token, err = Login(d, alice, time.Hour)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if err := SetPassword(d, alice, ""); err != nil {
+		t.Fatalf("SetPassword to remove: %v", err)
+	}
+	if _, err := SessionUser(d, token); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SessionUser after removing password: got error %v, want ErrNotFound", err)
+	}
+	if err := CheckPassword(d, alice, "1234"); !errors.Is(err, ErrBadLogin) {
+		t.Errorf("CheckPassword after removing password: got error %v, want ErrBadLogin", err)
+	}
+	// A rejected password leaves the user unedited.
+	if err := EditUserPassword(d, &User{ID: alice, Name: "alicia"}, "123"); err == nil {
+		t.Errorf("EditUserPassword with a short PIN succeeded")
+	}
+	if u, err := d.GetUser(alice); err != nil || u.Name != "alice" {
+		t.Errorf("GetUser after failed EditUserPassword = %+v, %v; want alice", u, err)
+	}
+	if err := EditUserPassword(d, &User{ID: alice, Name: "alicia"}, "4321"); err != nil {
+		t.Fatalf("EditUserPassword: %v", err)
+	}
+	if u, err := d.GetUser(alice); err != nil || u.Name != "alicia" {
+		t.Errorf("GetUser after EditUserPassword = %+v, %v; want alicia", u, err)
+	}
+	if err := CheckPassword(d, alice, "4321"); err != nil {
+		t.Errorf("CheckPassword after EditUserPassword: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package syndicate
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/mdlayher/untappd"
+)
+
+// CatalogBeer is a beer as described by a beer catalog.
+type CatalogBeer struct {
+	// ID is the catalog's beer ID, kept as Beer.UntappdID.
+	ID int64 `json:"id"`
+	// Name is the name of the beer.
+	Name string `json:"name"`
+	// Brewery is the name of the brewery.
+	Brewery string `json:"brewery"`
+	// BreweryID is the catalog's brewery ID.
+	BreweryID int64 `json:"brewery_id"`
+	// Rating is the beer's overall rating out of 5.
+	Rating float64 `json:"rating"`
+	// LabelURL is the URL of the beer's label, or empty.
+	LabelURL string `json:"label_url"`
+}
+
+// Beer returns a new syndicate beer with the catalog beer's details.
+func (c *CatalogBeer) Beer() *Beer {
+	return &Beer{
+		Brewery:       c.Brewery,
+		Name:          c.Name,
+		UntappdID:     c.ID,
+		UntappdRating: c.Rating,
+		BreweryID:     c.BreweryID,
+		LabelURL:      c.LabelURL,
+	}
+}
+
+// BeerCatalog finds the details of beers to add to the syndicate.
+type BeerCatalog interface {
+	// Search returns the beers matching the query, best match first.
+	Search(query string) ([]*CatalogBeer, error)
+	// Lookup returns the beer with the catalog ID, or ErrNotFound.
+	Lookup(id int64) (*CatalogBeer, error)
+	// LabelURL returns the URL of the label of the beer with the catalog
+	// ID, which is empty if it has none, or ErrNotFound.
+	LabelURL(id int64) (string, error)
+}
+
+// Catalog is the beer catalog beers are added from.
+var Catalog BeerCatalog
+
+var _ BeerCatalog = &UntappdClient{}
+
+// catalogBeer converts a beer from the Untappd API.
+func catalogBeer(b *untappd.Beer) *CatalogBeer {
+	c := &CatalogBeer{
+		ID:       int64(b.ID),
+		Name:     b.Name,
+		Rating:   b.OverallRating,
+		LabelURL: b.Label.String(),
+	}
+	if b.Brewery != nil {
+		c.Brewery = b.Brewery.Name
+		c.BreweryID = int64(b.Brewery.ID)
+	}
+	return c
+}
+
+// untappdNotFound returns ErrNotFound for the beer if err is Untappd saying
+// there is no such beer, and err otherwise.
+func untappdNotFound(err error, id int64) error {
+	var uerr *untappd.Error
+	if errors.As(err, &uerr) && uerr.Code == http.StatusNotFound {
+		return fmt.Errorf("%w: untappd beer id %d", ErrNotFound, id)
+	}
+	return err
+}
+
+// Search searches Untappd for beers.
+func (u *UntappdClient) Search(query string) ([]*CatalogBeer, error) {
+	beers, _, err := u.SearchBeer(query)
+	if err != nil {
+		return nil, err
+	}
+	var found []*CatalogBeer
+	for _, b := range beers {
+		found = append(found, catalogBeer(b))
+	}
+	return found, nil
+}
+
+// Lookup returns a beer's details from Untappd.
+func (u *UntappdClient) Lookup(id int64) (*CatalogBeer, error) {
+	b, _, err := u.GetBeerInfo(id)
+	if err != nil {
+		return nil, untappdNotFound(err, id)
+	}
+	if b == nil {
+		return nil, fmt.Errorf("%w: untappd beer id %d", ErrNotFound, id)
+	}
+	return catalogBeer(b), nil
+}
+
+// LabelURL returns the URL of a beer's label on Untappd.
+func (u *UntappdClient) LabelURL(id int64) (string, error) {
+	b, err := u.Lookup(id)
+	if err != nil {
+		return "", err
+	}
+	return b.LabelURL, nil
+}
@@ -0,0 +1,105 @@
+package syndicate
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/mdlayher/untappd"
+)
+
+// CheckinSource returns the recent check-ins of an Untappd user, such as
+// Untappd.GetUserCheckins.
+type CheckinSource func(untappdID string) ([]*untappd.Checkin, error)
+
+// checkinMatchWindow is how close a check-in must be to a checkout of the
+// same beer by the user to be taken as already checked out.
+const checkinMatchWindow = 12 * time.Hour
+
+// SyncCheckins suggests checkouts to users for their Untappd check-ins of
+// beers with some left in the syndicate. Check-ins from before the oldest
+// contribution with some left, near a checkout of the beer by the user, or
+// already suggested are skipped, as are retired users and those without an
+// Untappd ID. A user whose check-ins cannot be fetched is logged and skipped.
+// It returns the number of suggestions added.
+func SyncCheckins(db BeerDatabase, source CheckinSource) (int, error) {
+	beers, err := db.ListBeers()
+	if err != nil {
+		return 0, err
+	}
+	byUntappd := map[int64][]int64{}
+	for _, b := range beers {
+		if b.UntappdID != 0 {
+			byUntappd[b.UntappdID] = append(byUntappd[b.UntappdID], b.ID)
+		}
+	}
+	conts, err := db.ListContributions()
+	if err != nil {
+		return 0, err
+	}
+	remaining, err := db.ListContributionsRemaining()
+	if err != nil {
+		return 0, err
+	}
+	// since is when each beer with some left was first contributed.
+	since := map[int64]time.Time{}
+	contBeer := map[int64]int64{}
+	for _, c := range conts {
+		contBeer[c.ID] = c.Beer
+		if t, ok := since[c.Beer]; remaining[c.ID] > 0 && (!ok || c.Date.Before(t)) {
+			since[c.Beer] = c.Date
+		}
+	}
+	checkouts, err := db.ListCheckouts()
+	if err != nil {
+		return 0, err
+	}
+	type userBeer struct{ user, beer int64 }
+	taken := map[userBeer][]time.Time{}
+	for _, co := range checkouts {
+		k := userBeer{co.User, contBeer[co.Contribution]}
+		taken[k] = append(taken[k], co.Date)
+	}
+	users, err := db.ListUsers()
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	for _, u := range users {
+		if u.Retired || u.UntappdID == "" {
+			continue
+		}
+		checkins, err := source(u.UntappdID)
+		if err != nil {
+			log.Printf("Could not get check-ins of %s: %v", u.UntappdID, err)
+			continue
+		}
+	checkins:
+		for _, ci := range checkins {
+			if ci.Beer == nil {
+				continue
+			}
+			for _, beer := range byUntappd[int64(ci.Beer.ID)] {
+				first, ok := since[beer]
+				if !ok || ci.Created.Before(first) {
+					continue
+				}
+				for _, t := range taken[userBeer{u.ID, beer}] {
+					if d := ci.Created.Sub(t); d < checkinMatchWindow && d > -checkinMatchWindow {
+						continue checkins
+					}
+				}
+				_, err := db.AddSuggestion(&Suggestion{User: u.ID, Checkin: int64(ci.ID), Beer: beer, Date: ci.Created})
+				if errors.Is(err, ErrExists) {
+					continue checkins
+				} else if err != nil {
+					return added, err
+				}
+				added++
+				continue checkins
+			}
+		}
+	}
+	return added, nil
+}
@@ -0,0 +1,97 @@
+package syndicate
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mdlayher/untappd"
+)
+
+func TestSyncCheckins(t *testing.T) {
+	d := openTestDB(t)
+	alice, err := d.AddUser(&User{Name: "alice", UntappdID: "alice"})
+	if err != nil {
+		t.Fatalf("AddUser: %v", err)
+	}
+	bob, err := d.AddUser(&User{Name: "bob", UntappdID: "bob"})
+	if err != nil {
+		t.Fatalf("AddUser: %v", err)
+	}
+	ale, err := d.AddBeer(&Beer{Name: "Pale Ale", Brewery: "Brewery", UntappdID: 100})
+	if err != nil {
+		t.Fatalf("AddBeer: %v", err)
+	}
+	stout, err := d.AddBeer(&Beer{Name: "Stout", Brewery: "Brewery", UntappdID: 200})
+	if err != nil {
+		t.Fatalf("AddBeer: %v", err)
+	}
+	contributed := time.Now().Add(-48 * time.Hour)
+	var stoutCont int64
+	for _, beer := range []int64{ale, stout} {
+		if stoutCont, err = d.AddContribution(&Contribution{User: alice, Beer: beer, Quantity: 1, Date: contributed}); err != nil {
+			t.Fatalf("AddContribution: %v", err)
+		}
+	}
+	// Bob already checked out the stout an hour before checking it in.
+	checkin := time.Now().Add(-24 * time.Hour)
+	if _, err := d.AddCheckouts([]*Checkout{{User: bob, Contribution: stoutCont, Twelfths: 6, Date: checkin.Add(-time.Hour)}}); err != nil {
+		t.Fatalf("AddCheckouts: %v", err)
+	}
+
+	checkins := map[string][]*untappd.Checkin{
+		"alice": {
+			{ID: 1, Created: checkin, Beer: &untappd.Beer{ID: 100}},
+			{ID: 2, Created: contributed.Add(-time.Hour), Beer: &untappd.Beer{ID: 100}},
+			{ID: 3, Created: checkin, Beer: &untappd.Beer{ID: 999}},
+		},
+		"bob": {
+			{ID: 4, Created: checkin, Beer: &untappd.Beer{ID: 200}},
+			{ID: 5, Created: checkin.Add(-time.Minute), Beer: &untappd.Beer{ID: 100}},
+		},
+	}
+	source := func(id string) ([]*untappd.Checkin, error) { return checkins[id], nil }
+	if n, err := SyncCheckins(d, source); err != nil || n != 2 {
+		t.Fatalf("SyncCheckins = %d, %v; want 2", n, err)
+	}
+	if n, err := SyncCheckins(d, source); err != nil || n != 0 {
+		t.Errorf("SyncCheckins again = %d, %v; want 0", n, err)
+	}
+	sgs, err := d.ListSuggestions(0, SuggestionPending)
+	if err != nil || len(sgs) != 2 {
+		t.Fatalf("ListSuggestions = %+v, %v; want 2", sgs, err)
+	}
+	if sg := sgs[0]; sg.User != alice || sg.Checkin != 1 || sg.Beer != ale {
+		t.Errorf("newest suggestion = %+v, want alice's check-in 1 of beer %d", sg, ale)
+	}
+
+	// Confirming checks out the beer when it was checked in, once.
+	co, err := d.ConfirmSuggestion(sgs[0].ID, 12)
+	if err != nil {
+		t.Fatalf("ConfirmSuggestion: %v", err)
+	}
+	if c, err := d.GetCheckout(co); err != nil || c.User != alice || c.Twelfths != 12 || !c.Date.Equal(checkin.Truncate(time.Second)) {
+		t.Errorf("GetCheckout = %+v, %v; want a bottle for alice at %v", c, err, checkin)
+	}
+	if sg, err := d.GetSuggestion(sgs[0].ID); err != nil || sg.State != SuggestionConfirmed || sg.Checkout != co {
+		t.Errorf("GetSuggestion = %+v, %v; want confirmed as checkout %d", sg, err, co)
+	}
+	if _, err := d.ConfirmSuggestion(sgs[0].ID, 12); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ConfirmSuggestion again = %v, want ErrNotFound", err)
+	}
+
+	// Bob's ale is gone, so his suggestion can only be dismissed.
+	var stockErr *InsufficientStockError
+	if _, err := d.ConfirmSuggestion(sgs[1].ID, 12); !errors.As(err, &stockErr) || stockErr.Beer != ale {
+		t.Errorf("ConfirmSuggestion with none left = %v, want *InsufficientStockError", err)
+	}
+	if err := d.DismissSuggestion(sgs[1].ID); err != nil {
+		t.Fatalf("DismissSuggestion: %v", err)
+	}
+	if sgs, err := d.ListSuggestions(bob, SuggestionDismissed); err != nil || len(sgs) != 1 {
+		t.Errorf("ListSuggestions(bob, dismissed) = %+v, %v; want 1", sgs, err)
+	}
+	if sgs, err := d.ListSuggestions(0, SuggestionPending); err != nil || len(sgs) != 0 {
+		t.Errorf("ListSuggestions pending = %+v, %v; want none", sgs, err)
+	}
+}
@@ -8,107 +8,135 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 )
 
-const createStmt = `
-CREATE TABLE IF NOT EXISTS users(
-  id INTEGER PRIMARY KEY,
-  name TEXT,
-  untappdid TEXT,
-  seedfund INTEGER
-);
-CREATE TABLE IF NOT EXISTS beers(
-  id INTEGER PRIMARY KEY,
-  brewery TEXT,
-  name TEXT,
-  untappdid INTEGER,
-  untappdrating INTEGER,
-  breweryid INTEGER,
-  labelURL TEXT
-);
-CREATE TABLE IF NOT EXISTS contributions(
-  id INTEGER PRIMARY KEY,
-  user INTEGER,
-  beer INTEGER,
-  quantity INTEGER,
-  date INTEGER,
-  unitprice INTEGER,
-  comment TEXT
-);
-CREATE TABLE IF NOT EXISTS checkouts(
-  id INTEGER PRIMARY KEY AUTOINCREMENT,
-  user INTEGER,
-  contribution INTEGER,
-  quantity REAL,
-  twelfths INTEGER,
-  date INTEGER
-);
-CREATE TABLE IF NOT EXISTS subscriptions(
-  id INTEGER PRIMARY KEY AUTOINCREMENT,
-  endpoint TEXT,
-  key TEXT,
-  auth TEXT,
-  userAgent TEXT,
-  host TEXT,
-  cookie TEXT
-);
-CREATE TABLE IF NOT EXISTS debitsCredits(
-  id INTEGER PRIMARY KEY AUTOINCREMENT,
-  user INTEGER,
-  amount INTEGER,
-  date INTEGER,
-  comment TEXT
-);
-`
-
 type database struct {
 	db *sql.DB
 
 	addUser           *sql.Stmt
+	editUser          *sql.Stmt
 	listUsers         *sql.Stmt
+	getUser           *sql.Stmt
 	addBeer           *sql.Stmt
 	listBeers         *sql.Stmt
+	getBeer           *sql.Stmt
+	editBeer          *sql.Stmt
+	refreshBeer       *sql.Stmt
+	addRating         *sql.Stmt
+	listRatings       *sql.Stmt
 	addContribution   *sql.Stmt
 	editContribution  *sql.Stmt
 	delContribution   *sql.Stmt
 	listContributions *sql.Stmt
+	getContribution   *sql.Stmt
 	listCheckouts     *sql.Stmt
+	getCheckout       *sql.Stmt
 	addCheckout       *sql.Stmt
+	editCheckout      *sql.Stmt
 	delCheckout       *sql.Stmt
+	remainingTwelfths *sql.Stmt
+	beerRemaining     *sql.Stmt
+	listRemaining     *sql.Stmt
+	listBeersLeft     *sql.Stmt
+	listBalances      *sql.Stmt
+	getBalance        *sql.Stmt
 
 	listSubscriptions *sql.Stmt
 	addSubscription   *sql.Stmt
 	delSubscription   *sql.Stmt
+	claimSubscription *sql.Stmt
+	muteSubscription  *sql.Stmt
+	addDelivery       *sql.Stmt
+	listDeliveries    *sql.Stmt
+	dueDeliveries     *sql.Stmt
+	failDelivery      *sql.Stmt
+	retryDelivery     *sql.Stmt
+	delDelivery       *sql.Stmt
+
+	addSuggestion     *sql.Stmt
+	getSuggestion     *sql.Stmt
+	listSuggestions   *sql.Stmt
+	answerSuggestion  *sql.Stmt
+	contribsRemaining *sql.Stmt
 
 	listDebitCredits *sql.Stmt
+	getDebitCredit   *sql.Stmt
 	addDebitCredit   *sql.Stmt
+	editDebitCredit  *sql.Stmt
 	delDebitCredit   *sql.Stmt
+
+	addAuditEntry    *sql.Stmt
+	listAuditEntries *sql.Stmt
+	getAuditEntry    *sql.Stmt
+
+	getPasswordHash *sql.Stmt
+	setPasswordHash *sql.Stmt
+	addLoginSession *sql.Stmt
+	getLoginSession *sql.Stmt
+	delLoginSession *sql.Stmt
+	delUserSessions *sql.Stmt
+
+	// actor is who changes made through the database are attributed to in
+	// the audit log, or nil if they are not recorded.
+	actor *Actor
 }
 
 var _ BeerDatabase = &database{}
 
+// dsn returns the sqlite3 data source name for the database file at path.
+// Transactions take the write lock when they begin so that read-then-write
+// sequences, such as checking stock before a checkout, are serialised.
+// Foreign keys are enforced on every connection.
+func dsn(path string) string {
+	return path + "?_txlock=immediate&_busy_timeout=5000&_foreign_keys=1"
+}
+
 func (d *database) Open(path string) error {
-	db, err := sql.Open("sqlite3", path)
+	db, err := sql.Open("sqlite3", dsn(path))
 	if err != nil {
 		return err
 	}
 	d.db = db
-	if _, err := d.db.Exec(createStmt); err != nil {
-		return fmt.Errorf("error creating database: %v", err)
+	if err := migrate(db); err != nil {
+		return err
 	}
 	if d.listUsers, err = db.Prepare(listUsersStmt); err != nil {
 		return fmt.Errorf("sql: prepare listUsers: %v", err)
 	}
+	if d.getUser, err = db.Prepare(getUserStmt); err != nil {
+		return fmt.Errorf("sql: prepare getUser: %v", err)
+	}
 	if d.addUser, err = db.Prepare(addUserStmt); err != nil {
 		return fmt.Errorf("sql: prepare addUser: %v", err)
 	}
+	if d.editUser, err = db.Prepare(editUserStmt); err != nil {
+		return fmt.Errorf("sql: prepare editUser: %v", err)
+	}
 	if d.listBeers, err = db.Prepare(listBeersStmt); err != nil {
 		return fmt.Errorf("sql: prepare listBeers: %v", err)
 	}
+	if d.getBeer, err = db.Prepare(getBeerStmt); err != nil {
+		return fmt.Errorf("sql: prepare getBeer: %v", err)
+	}
 	if d.addBeer, err = db.Prepare(addBeerStmt); err != nil {
 		return fmt.Errorf("sql: prepare addBeer: %v", err)
 	}
+	if d.editBeer, err = db.Prepare(editBeerStmt); err != nil {
+		return fmt.Errorf("sql: prepare editBeer: %v", err)
+	}
+	if d.refreshBeer, err = db.Prepare(refreshBeerStmt); err != nil {
+		return fmt.Errorf("sql: prepare refreshBeer: %v", err)
+	}
+	if d.addRating, err = db.Prepare(addRatingStmt); err != nil {
+		return fmt.Errorf("sql: prepare addRating: %v", err)
+	}
+	if d.listRatings, err = db.Prepare(listRatingsStmt); err != nil {
+		return fmt.Errorf("sql: prepare listRatings: %v", err)
+	}
 	if d.listContributions, err = db.Prepare(listContributionsStmt); err != nil {
 		return fmt.Errorf("sql: prepare listContributions: %v", err)
 	}
+	if d.getContribution, err = db.Prepare(getContributionStmt); err != nil {
+		return fmt.Errorf("sql: prepare getContribution: %v", err)
+	}
 	if d.addContribution, err = db.Prepare(addContributionStmt); err != nil {
 		return fmt.Errorf("sql: prepare addContribution: %v", err)
 	}
@@ -121,12 +149,36 @@ func (d *database) Open(path string) error {
 	if d.listCheckouts, err = db.Prepare(listCheckoutsStmt); err != nil {
 		return fmt.Errorf("sql: prepare listCheckouts: %v", err)
 	}
+	if d.getCheckout, err = db.Prepare(getCheckoutStmt); err != nil {
+		return fmt.Errorf("sql: prepare getCheckout: %v", err)
+	}
 	if d.addCheckout, err = db.Prepare(addCheckoutStmt); err != nil {
 		return fmt.Errorf("sql: prepare addCheckout: %v", err)
 	}
+	if d.editCheckout, err = db.Prepare(editCheckoutStmt); err != nil {
+		return fmt.Errorf("sql: prepare editCheckout: %v", err)
+	}
 	if d.delCheckout, err = db.Prepare(delCheckoutStmt); err != nil {
 		return fmt.Errorf("sql: prepare delCheckout: %v", err)
 	}
+	if d.remainingTwelfths, err = db.Prepare(remainingTwelfthsStmt); err != nil {
+		return fmt.Errorf("sql: prepare remainingTwelfths: %v", err)
+	}
+	if d.beerRemaining, err = db.Prepare(beerRemainingStmt); err != nil {
+		return fmt.Errorf("sql: prepare beerRemaining: %v", err)
+	}
+	if d.listRemaining, err = db.Prepare(listRemainingStmt); err != nil {
+		return fmt.Errorf("sql: prepare listRemaining: %v", err)
+	}
+	if d.listBeersLeft, err = db.Prepare(listBeersLeftStmt); err != nil {
+		return fmt.Errorf("sql: prepare listBeersLeft: %v", err)
+	}
+	if d.listBalances, err = db.Prepare(listBalancesStmt); err != nil {
+		return fmt.Errorf("sql: prepare listBalances: %v", err)
+	}
+	if d.getBalance, err = db.Prepare(getBalanceStmt); err != nil {
+		return fmt.Errorf("sql: prepare getBalance: %v", err)
+	}
 
 	if d.listSubscriptions, err = db.Prepare(listSubscriptionsStmt); err != nil {
 		return fmt.Errorf("sql: prepare listSubscription: %v", err)
@@ -137,15 +189,87 @@ func (d *database) Open(path string) error {
 	if d.delSubscription, err = db.Prepare(delSubscriptionStmt); err != nil {
 		return fmt.Errorf("sql: prepare delSubscription: %v", err)
 	}
+	if d.claimSubscription, err = db.Prepare(claimSubscriptionStmt); err != nil {
+		return fmt.Errorf("sql: prepare claimSubscription: %v", err)
+	}
+	if d.muteSubscription, err = db.Prepare(muteSubscriptionStmt); err != nil {
+		return fmt.Errorf("sql: prepare muteSubscription: %v", err)
+	}
+	if d.addDelivery, err = db.Prepare(addDeliveryStmt); err != nil {
+		return fmt.Errorf("sql: prepare addDelivery: %v", err)
+	}
+	if d.listDeliveries, err = db.Prepare(listDeliveriesStmt); err != nil {
+		return fmt.Errorf("sql: prepare listDeliveries: %v", err)
+	}
+	if d.dueDeliveries, err = db.Prepare(dueDeliveriesStmt); err != nil {
+		return fmt.Errorf("sql: prepare dueDeliveries: %v", err)
+	}
+	if d.failDelivery, err = db.Prepare(failDeliveryStmt); err != nil {
+		return fmt.Errorf("sql: prepare failDelivery: %v", err)
+	}
+	if d.retryDelivery, err = db.Prepare(retryDeliveryStmt); err != nil {
+		return fmt.Errorf("sql: prepare retryDelivery: %v", err)
+	}
+	if d.delDelivery, err = db.Prepare(delDeliveryStmt); err != nil {
+		return fmt.Errorf("sql: prepare delDelivery: %v", err)
+	}
+	if d.addSuggestion, err = db.Prepare(addSuggestionStmt); err != nil {
+		return fmt.Errorf("sql: prepare addSuggestion: %v", err)
+	}
+	if d.getSuggestion, err = db.Prepare(getSuggestionStmt); err != nil {
+		return fmt.Errorf("sql: prepare getSuggestion: %v", err)
+	}
+	if d.listSuggestions, err = db.Prepare(listSuggestionsStmt); err != nil {
+		return fmt.Errorf("sql: prepare listSuggestions: %v", err)
+	}
+	if d.answerSuggestion, err = db.Prepare(answerSuggestionStmt); err != nil {
+		return fmt.Errorf("sql: prepare answerSuggestion: %v", err)
+	}
+	if d.contribsRemaining, err = db.Prepare(contribsRemainingStmt); err != nil {
+		return fmt.Errorf("sql: prepare contribsRemaining: %v", err)
+	}
 	if d.listDebitCredits, err = db.Prepare(listDebitCreditsStmt); err != nil {
 		return fmt.Errorf("sql: prepare listDebitCredit: %v", err)
 	}
+	if d.getDebitCredit, err = db.Prepare(getDebitCreditStmt); err != nil {
+		return fmt.Errorf("sql: prepare getDebitCredit: %v", err)
+	}
 	if d.addDebitCredit, err = db.Prepare(addDebitCreditStmt); err != nil {
 		return fmt.Errorf("sql: prepare addDebitCredit: %v", err)
 	}
+	if d.editDebitCredit, err = db.Prepare(editDebitCreditStmt); err != nil {
+		return fmt.Errorf("sql: prepare editDebitCredit: %v", err)
+	}
 	if d.delDebitCredit, err = db.Prepare(delDebitCreditStmt); err != nil {
 		return fmt.Errorf("sql: prepare delDebitCredit: %v", err)
 	}
+	if d.addAuditEntry, err = db.Prepare(addAuditEntryStmt); err != nil {
+		return fmt.Errorf("sql: prepare addAuditEntry: %v", err)
+	}
+	if d.listAuditEntries, err = db.Prepare(listAuditEntriesStmt); err != nil {
+		return fmt.Errorf("sql: prepare listAuditEntries: %v", err)
+	}
+	if d.getAuditEntry, err = db.Prepare(getAuditEntryStmt); err != nil {
+		return fmt.Errorf("sql: prepare getAuditEntry: %v", err)
+	}
+	if d.getPasswordHash, err = db.Prepare(getPasswordHashStmt); err != nil {
+		return fmt.Errorf("sql: prepare getPasswordHash: %v", err)
+	}
+	if d.setPasswordHash, err = db.Prepare(setPasswordHashStmt); err != nil {
+		return fmt.Errorf("sql: prepare setPasswordHash: %v", err)
+	}
+	if d.addLoginSession, err = db.Prepare(addLoginSessionStmt); err != nil {
+		return fmt.Errorf("sql: prepare addLoginSession: %v", err)
+	}
+	if d.getLoginSession, err = db.Prepare(getLoginSessionStmt); err != nil {
+		return fmt.Errorf("sql: prepare getLoginSession: %v", err)
+	}
+	if d.delLoginSession, err = db.Prepare(delLoginSessionStmt); err != nil {
+		return fmt.Errorf("sql: prepare delLoginSession: %v", err)
+	}
+	if d.delUserSessions, err = db.Prepare(delUserSessionsStmt); err != nil {
+		return fmt.Errorf("sql: prepare delUserSessions: %v", err)
+	}
 	return nil
 }
 
@@ -153,11 +277,22 @@ func (d *database) Close() error {
 	return d.db.Close()
 }
 
+// deletedTime returns the time for a nullable deleted_at timestamp, or the
+// zero time if it is null.
+func deletedTime(t sql.NullInt64) time.Time {
+	if !t.Valid {
+		return time.Time{}
+	}
+	return time.Unix(0, t.Int64)
+}
+
 type rowScanner interface {
 	Scan(dest ...interface{}) error
 }
 
-const listUsersStmt = `SELECT * FROM users ORDER BY name`
+const userColumns = `id, name, untappdid, seedfund, retired, IFNULL(passwordhash, '') != ''`
+
+const listUsersStmt = `SELECT ` + userColumns + ` FROM users ORDER BY name`
 
 func scanUsers(s rowScanner) (*User, error) {
 	var (
@@ -165,15 +300,19 @@ func scanUsers(s rowScanner) (*User, error) {
 		name      sql.NullString
 		untappdid sql.NullString
 		seedfund  sql.NullInt64
+		retired   bool
+		password  bool
 	)
-	if err := s.Scan(&id, &name, &untappdid, &seedfund); err != nil {
+	if err := s.Scan(&id, &name, &untappdid, &seedfund, &retired, &password); err != nil {
 		return nil, err
 	}
 	user := &User{
-		ID:        id,
-		Name:      name.String,
-		UntappdID: untappdid.String,
-		SeedFund:  float64(seedfund.Int64) / 100,
+		ID:          id,
+		Name:        name.String,
+		UntappdID:   untappdid.String,
+		SeedFund:    Money(seedfund.Int64),
+		Retired:     retired,
+		HasPassword: password,
 	}
 	return user, nil
 }
@@ -197,36 +336,81 @@ func (d *database) ListUsers() ([]*User, error) {
 	return users, nil
 }
 
+const getUserStmt = `SELECT ` + userColumns + ` FROM users WHERE id = ?`
+
 // GetUser returns the given user.
 func (d *database) GetUser(id int64) (*User, error) {
-	users, err := d.ListUsers()
-	if err != nil {
-		return nil, err
+	user, err := scanUsers(d.getUser.QueryRow(id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: user id %d", ErrNotFound, id)
+	} else if err != nil {
+		return nil, fmt.Errorf("sql: could not get user: %v", err)
 	}
-	for _, u := range users {
-		if u.ID == id {
-			return u, nil
-		}
-	}
-	return nil, nil
+	return user, nil
 }
 
-const addUserStmt = `INSERT INTO users(name, untappdid) VALUES (?,?)`
+const addUserStmt = `INSERT INTO users(name, untappdid, seedfund, retired) VALUES (?,?,?,?)`
 
 // AddUser adds a new user.
 func (d *database) AddUser(u *User) (int64, error) {
-	r, err := execAffectingOneRow(d.addUser, u.Name, u.UntappdID)
+	var lastInsertID int64
+	err := d.write(func(tx *sql.Tx) error {
+		r, err := execAffectingOneRow(tx.Stmt(d.addUser), u.Name, u.UntappdID, u.SeedFund.Cents(), u.Retired)
+		if err != nil {
+			return err
+		}
+		if lastInsertID, err = r.LastInsertId(); err != nil {
+			return fmt.Errorf("sql: could not get last insert id: %v", err)
+		}
+		return d.audit(tx).added(AuditInsert, TableUsers, lastInsertID)
+	})
 	if err != nil {
 		return 0, err
 	}
-	lastInsertID, err := r.LastInsertId()
+	return lastInsertID, nil
+}
+
+const editUserStmt = `
+UPDATE users SET name=?, untappdid=?, seedfund=?, retired=? WHERE id=?`
+
+// EditUser changes the name, Untappd ID, seed fund and retired state of a
+// user.
+func (d *database) EditUser(u *User) error {
+	return d.write(func(tx *sql.Tx) error {
+		return d.txEditUser(tx, u)
+	})
+}
+
+// EditUserPasswordHash edits a user and sets the hash of their PIN or
+// password in one transaction.
+func (d *database) EditUserPasswordHash(u *User, hash string) error {
+	return d.write(func(tx *sql.Tx) error {
+		if err := d.txEditUser(tx, u); err != nil {
+			return err
+		}
+		return d.txSetPasswordHash(tx, u.ID, hash)
+	})
+}
+
+func (d *database) txEditUser(tx *sql.Tx, u *User) error {
+	done, err := d.audit(tx).change(AuditEdit, TableUsers, u.ID)
 	if err != nil {
-		return 0, fmt.Errorf("sql: could not get last insert id: %v", err)
+		return err
 	}
-	return lastInsertID, nil
+	if _, err := scanUsers(tx.Stmt(d.getUser).QueryRow(u.ID)); err == sql.ErrNoRows {
+		return fmt.Errorf("%w: user id %d", ErrNotFound, u.ID)
+	} else if err != nil {
+		return fmt.Errorf("sql: could not get user: %v", err)
+	}
+	if _, err := execAffectingOneRow(tx.Stmt(d.editUser), u.Name, u.UntappdID, u.SeedFund.Cents(), u.Retired, u.ID); err != nil {
+		return err
+	}
+	return done()
 }
 
-const listBeersStmt = `SELECT * FROM beers ORDER BY id desc`
+const beerColumns = `id, brewery, name, untappdid, untappdrating, breweryid, labelURL, refreshed`
+
+const listBeersStmt = `SELECT ` + beerColumns + ` FROM beers ORDER BY id desc`
 
 func scanBeers(s rowScanner) (*Beer, error) {
 	var (
@@ -237,8 +421,9 @@ func scanBeers(s rowScanner) (*Beer, error) {
 		untappdrating sql.NullInt64
 		breweryid     sql.NullInt64
 		labelURL      sql.NullString
+		refreshed     sql.NullInt64
 	)
-	if err := s.Scan(&id, &brewery, &name, &untappdid, &untappdrating, &breweryid, &labelURL); err != nil {
+	if err := s.Scan(&id, &brewery, &name, &untappdid, &untappdrating, &breweryid, &labelURL, &refreshed); err != nil {
 		return nil, err
 	}
 	beer := &Beer{
@@ -250,6 +435,9 @@ func scanBeers(s rowScanner) (*Beer, error) {
 		BreweryID:     breweryid.Int64,
 		LabelURL:      labelURL.String,
 	}
+	if refreshed.Valid {
+		beer.Refreshed = time.Unix(refreshed.Int64, 0)
+	}
 	return beer, nil
 }
 
@@ -272,6 +460,19 @@ func (d *database) ListBeers() ([]*Beer, error) {
 	return beers, nil
 }
 
+const getBeerStmt = `SELECT ` + beerColumns + ` FROM beers WHERE id = ?`
+
+// GetBeer returns the given beer.
+func (d *database) GetBeer(id int64) (*Beer, error) {
+	beer, err := scanBeers(d.getBeer.QueryRow(id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: beer id %d", ErrNotFound, id)
+	} else if err != nil {
+		return nil, fmt.Errorf("sql: could not get beer: %v", err)
+	}
+	return beer, nil
+}
+
 const addBeerStmt = `
 INSERT INTO beers(
 	brewery, name, untappdid, untappdrating, breweryid, labelurl
@@ -280,18 +481,204 @@ INSERT INTO beers(
 // AddBeer adds a new beer.
 func (d *database) AddBeer(b *Beer) (int64, error) {
 	rating := int64(b.UntappdRating * 100)
-	r, err := execAffectingOneRow(d.addBeer, b.Brewery, b.Name, b.UntappdID, rating, b.BreweryID, b.LabelURL)
+	var lastInsertID int64
+	err := d.write(func(tx *sql.Tx) error {
+		r, err := execAffectingOneRow(tx.Stmt(d.addBeer), b.Brewery, b.Name, b.UntappdID, rating, b.BreweryID, b.LabelURL)
+		if err != nil {
+			return err
+		}
+		if lastInsertID, err = r.LastInsertId(); err != nil {
+			return fmt.Errorf("sql: could not get last insert id: %v", err)
+		}
+		return d.audit(tx).added(AuditInsert, TableBeers, lastInsertID)
+	})
 	if err != nil {
 		return 0, err
 	}
-	lastInsertID, err := r.LastInsertId()
+	return lastInsertID, nil
+}
+
+const editBeerStmt = `
+UPDATE beers SET
+	brewery=?, name=?, untappdid=?, untappdrating=?, breweryid=?, labelurl=?
+WHERE id=?`
+
+// EditBeer changes the details of a beer.
+func (d *database) EditBeer(b *Beer) error {
+	rating := int64(b.UntappdRating * 100)
+	return d.write(func(tx *sql.Tx) error {
+		done, err := d.audit(tx).change(AuditEdit, TableBeers, b.ID)
+		if err != nil {
+			return err
+		}
+		if _, err := scanBeers(tx.Stmt(d.getBeer).QueryRow(b.ID)); err == sql.ErrNoRows {
+			return fmt.Errorf("%w: beer id %d", ErrNotFound, b.ID)
+		} else if err != nil {
+			return fmt.Errorf("sql: could not get beer: %v", err)
+		}
+		if _, err := execAffectingOneRow(tx.Stmt(d.editBeer), b.Brewery, b.Name, b.UntappdID, rating, b.BreweryID, b.LabelURL, b.ID); err != nil {
+			return err
+		}
+		return done()
+	})
+}
+
+const refreshBeerStmt = `
+UPDATE beers SET
+	brewery=?, name=?, untappdrating=?, breweryid=?, labelurl=?, refreshed=?
+WHERE id=?`
+
+const lastRatingStmt = `
+SELECT rating FROM ratings WHERE beer = ? ORDER BY date DESC, id DESC LIMIT 1`
+
+const addRatingStmt = `INSERT INTO ratings(beer, date, rating) VALUES (?, ?, ?)`
+
+// RefreshBeer updates a beer's details from the catalog and records its
+// rating if it changed since last seen.
+func (d *database) RefreshBeer(b *Beer) error {
+	return d.write(func(tx *sql.Tx) error {
+		done, err := d.audit(tx).change(AuditEdit, TableBeers, b.ID)
+		if err != nil {
+			return err
+		}
+		now := time.Now().Unix()
+		rating := int64(b.UntappdRating * 100)
+		r, err := tx.Stmt(d.refreshBeer).Exec(b.Brewery, b.Name, rating, b.BreweryID, b.LabelURL, now, b.ID)
+		if err != nil {
+			return fmt.Errorf("sql: could not refresh beer: %v", err)
+		}
+		if n, err := r.RowsAffected(); err != nil {
+			return fmt.Errorf("sql: could not get rows affected: %v", err)
+		} else if n == 0 {
+			return fmt.Errorf("%w: beer id %d", ErrNotFound, b.ID)
+		}
+		var last int64
+		err = tx.QueryRow(lastRatingStmt, b.ID).Scan(&last)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("sql: could not get last rating: %v", err)
+		}
+		if err == sql.ErrNoRows || last != rating {
+			if _, err := tx.Stmt(d.addRating).Exec(b.ID, now, rating); err != nil {
+				return fmt.Errorf("sql: could not add rating: %v", err)
+			}
+		}
+		return done()
+	})
+}
+
+const listRatingsStmt = `SELECT date, rating FROM ratings WHERE beer = ? ORDER BY date, id`
+
+// ListRatings returns the history of a beer's rating.
+func (d *database) ListRatings(beer int64) ([]*Rating, error) {
+	rows, err := d.listRatings.Query(beer)
 	if err != nil {
-		return 0, fmt.Errorf("sql: could not get last insert id: %v", err)
+		return nil, fmt.Errorf("sql: could not list ratings: %v", err)
 	}
-	return lastInsertID, nil
+	defer rows.Close()
+	var ratings []*Rating
+	for rows.Next() {
+		var date, rating int64
+		if err := rows.Scan(&date, &rating); err != nil {
+			return nil, fmt.Errorf("sql: could not read row: %v", err)
+		}
+		ratings = append(ratings, &Rating{Date: time.Unix(date, 0), Rating: float64(rating) / 100})
+	}
+	return ratings, rows.Err()
+}
+
+const beerContributionsStmt = `SELECT COUNT(*) FROM contributions WHERE beer = ?`
+
+const delBeerStmt = `DELETE FROM beers WHERE id = ?`
+
+const moveContributionsStmt = `UPDATE contributions SET beer = ? WHERE beer = ?`
+
+const moveSuggestionsStmt = `UPDATE suggestions SET beer = ? WHERE beer = ?`
+
+// DeleteBeer removes a beer. It returns ErrInUse if any contributions are of
+// the beer.
+func (d *database) DeleteBeer(id int64) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("sql: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	done, err := d.audit(tx).change(AuditDelete, TableBeers, id)
+	if err != nil {
+		return err
+	}
+	if _, err := scanBeers(tx.Stmt(d.getBeer).QueryRow(id)); err == sql.ErrNoRows {
+		return fmt.Errorf("%w: beer id %d", ErrNotFound, id)
+	} else if err != nil {
+		return fmt.Errorf("sql: could not get beer: %v", err)
+	}
+	var n int64
+	if err := tx.QueryRow(beerContributionsStmt, id).Scan(&n); err != nil {
+		return fmt.Errorf("sql: could not count contributions: %v", err)
+	}
+	if n > 0 {
+		return fmt.Errorf("%w: beer id %d has %d contributions", ErrInUse, id, n)
+	}
+	if _, err := tx.Exec(delBeerStmt, id); err != nil {
+		return fmt.Errorf("sql: could not delete beer: %v", err)
+	}
+	if err := done(); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sql: could not commit transaction: %v", err)
+	}
+	return nil
+}
+
+// MergeBeers moves all contributions and suggestions of the duplicate beer
+// onto the canonical one and removes the duplicate, in a single transaction. The canonical beer's
+// details are left unchanged.
+func (d *database) MergeBeers(duplicate, canonical int64) error {
+	if duplicate == canonical {
+		return fmt.Errorf("cannot merge beer id %d into itself", duplicate)
+	}
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("sql: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	done, err := d.audit(tx).merged(duplicate, canonical)
+	if err != nil {
+		return err
+	}
+	getBeer := tx.Stmt(d.getBeer)
+	for _, id := range []int64{duplicate, canonical} {
+		if _, err := scanBeers(getBeer.QueryRow(id)); err == sql.ErrNoRows {
+			return fmt.Errorf("%w: beer id %d", ErrNotFound, id)
+		} else if err != nil {
+			return fmt.Errorf("sql: could not get beer: %v", err)
+		}
+	}
+	if _, err := tx.Exec(moveContributionsStmt, canonical, duplicate); err != nil {
+		return fmt.Errorf("sql: could not move contributions: %v", err)
+	}
+	if _, err := tx.Exec(moveSuggestionsStmt, canonical, duplicate); err != nil {
+		return fmt.Errorf("sql: could not move suggestions: %v", err)
+	}
+	if _, err := tx.Exec(delBeerStmt, duplicate); err != nil {
+		return fmt.Errorf("sql: could not delete beer: %v", err)
+	}
+	if err := done(); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sql: could not commit transaction: %v", err)
+	}
+	return nil
 }
 
-const listContributionsStmt = `SELECT * FROM contributions ORDER BY date`
+const contributionColumns = `id, user, beer, quantity, date, unitprice, comment, deleted_at`
+
+const listContributionsStmt = `
+SELECT ` + contributionColumns + ` FROM contributions
+WHERE deleted_at IS NULL ORDER BY date`
 
 func scanContributions(s rowScanner) (*Contribution, error) {
 	var (
@@ -302,8 +689,9 @@ func scanContributions(s rowScanner) (*Contribution, error) {
 		date      sql.NullInt64
 		unitPrice sql.NullInt64
 		comment   sql.NullString
+		deletedAt sql.NullInt64
 	)
-	if err := s.Scan(&id, &user, &beer, &quantity, &date, &unitPrice, &comment); err != nil {
+	if err := s.Scan(&id, &user, &beer, &quantity, &date, &unitPrice, &comment, &deletedAt); err != nil {
 		return nil, err
 	}
 	cont := &Contribution{
@@ -312,8 +700,9 @@ func scanContributions(s rowScanner) (*Contribution, error) {
 		Beer:      beer.Int64,
 		Quantity:  quantity.Int64,
 		Date:      time.Unix(date.Int64, 0),
-		UnitPrice: float64(unitPrice.Int64) / 100,
+		UnitPrice: Money(unitPrice.Int64),
 		Comment:   comment.String,
+		DeletedAt: deletedTime(deletedAt),
 	}
 	return cont, nil
 }
@@ -337,14 +726,35 @@ func (d *database) ListContributions() ([]*Contribution, error) {
 	return conts, nil
 }
 
+const getContributionStmt = `
+SELECT ` + contributionColumns + ` FROM contributions
+WHERE id = ? AND deleted_at IS NULL`
+
+// GetContribution returns the given contribution, unless it is deleted.
+func (d *database) GetContribution(id int64) (*Contribution, error) {
+	cont, err := scanContributions(d.getContribution.QueryRow(id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: contribution id %d", ErrNotFound, id)
+	} else if err != nil {
+		return nil, fmt.Errorf("sql: could not get contribution: %v", err)
+	}
+	return cont, nil
+}
+
 const addContributionStmt = `
 INSERT INTO contributions(
   user, beer, quantity, date, unitprice, comment
   ) VALUES (?, ?, ?, ?, ?, ?)`
 
-// AddContribution adds a new contribution.
+// AddContribution adds a new contribution, notifying everyone.
 func (d *database) AddContribution(c *Contribution) (int64, error) {
-	r, err := execAffectingOneRow(d.addContribution, c.User, c.Beer, c.Quantity, c.Date.Unix(), int64(c.UnitPrice*100), c.Comment)
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("sql: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	r, err := execAffectingOneRow(tx.Stmt(d.addContribution), c.User, c.Beer, c.Quantity, c.Date.Unix(), c.UnitPrice.Cents(), c.Comment)
 	if err != nil {
 		return 0, err
 	}
@@ -352,35 +762,217 @@ func (d *database) AddContribution(c *Contribution) (int64, error) {
 	if err != nil {
 		return 0, fmt.Errorf("sql: could not get last insert id: %v", err)
 	}
+	if err := d.enqueue(tx, []*Event{{Type: EventContribution, From: c.User, Record: lastInsertID}}); err != nil {
+		return 0, err
+	}
+	if err := d.audit(tx).added(AuditInsert, TableContributions, lastInsertID); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("sql: could not commit transaction: %v", err)
+	}
 	return lastInsertID, nil
 }
 
 const editContributionStmt = `
 UPDATE contributions SET quantity=?, unitprice=?, comment=?
-WHERE id=?`
+WHERE id=? AND deleted_at IS NULL`
 
-// EditContribution edits a contribution.
+// EditContribution edits a contribution. An *InsufficientStockError is
+// returned if more than the new quantity has been checked out.
 func (d *database) EditContribution(c *Contribution) error {
-	_, err := execAffectingOneRow(d.editContribution, c.Quantity, int64(c.UnitPrice*100), c.Comment, c.ID)
+	tx, err := d.db.Begin()
 	if err != nil {
+		return fmt.Errorf("sql: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	done, err := d.audit(tx).change(AuditEdit, TableContributions, c.ID)
+	if err != nil {
+		return err
+	}
+	old, err := scanContributions(tx.Stmt(d.getContribution).QueryRow(c.ID))
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: contribution id %d", ErrNotFound, c.ID)
+	} else if err != nil {
+		return fmt.Errorf("sql: could not get contribution: %v", err)
+	}
+	var remaining int64
+	if err := tx.Stmt(d.remainingTwelfths).QueryRow(c.ID).Scan(&remaining); err != nil {
+		return fmt.Errorf("sql: could not read remaining quantity: %v", err)
+	}
+	if taken := old.Quantity*12 - remaining; c.Quantity*12 < taken {
+		return &InsufficientStockError{
+			Contribution: c.ID,
+			Requested:    taken,
+			Remaining:    c.Quantity * 12,
+		}
+	}
+	if _, err := execAffectingOneRow(tx.Stmt(d.editContribution), c.Quantity, c.UnitPrice.Cents(), c.Comment, c.ID); err != nil {
+		return err
+	}
+	if err := done(); err != nil {
 		return err
 	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sql: could not commit transaction: %v", err)
+	}
 	return nil
 }
 
 const delContributionStmt = `
-DELETE FROM contributions WHERE id = ?`
+UPDATE contributions SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`
 
-// DeleteContribution deletes a contribution.
+const delContributionCheckoutsStmt = `
+UPDATE checkouts SET deleted_at = ? WHERE contribution = ? AND deleted_at IS NULL`
+
+// DeleteContribution moves a contribution to the trash, along with its
+// checkouts.
 func (d *database) DeleteContribution(id int64) error {
-	_, err := execAffectingOneRow(d.delContribution, id)
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("sql: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	done, err := d.audit(tx).change(AuditDelete, TableContributions, id)
 	if err != nil {
 		return err
 	}
+	now := time.Now().UnixNano()
+	r, err := tx.Stmt(d.delContribution).Exec(now, id)
+	if err != nil {
+		return fmt.Errorf("sql: could not delete contribution: %v", err)
+	}
+	if n, err := r.RowsAffected(); err != nil {
+		return fmt.Errorf("sql: could not get rows affected: %v", err)
+	} else if n == 0 {
+		return fmt.Errorf("%w: contribution id %d", ErrNotFound, id)
+	}
+	if _, err := tx.Exec(delContributionCheckoutsStmt, now, id); err != nil {
+		return fmt.Errorf("sql: could not delete checkouts: %v", err)
+	}
+	if err := done(); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sql: could not commit transaction: %v", err)
+	}
+	return nil
+}
+
+const listDeletedContributionsStmt = `
+SELECT ` + contributionColumns + ` FROM contributions
+WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC`
+
+// ListDeletedContributions returns all contributions in the trash, most
+// recently deleted first.
+func (d *database) ListDeletedContributions() ([]*Contribution, error) {
+	rows, err := d.db.Query(listDeletedContributionsStmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conts []*Contribution
+	for rows.Next() {
+		cont, err := scanContributions(rows)
+		if err != nil {
+			return nil, fmt.Errorf("sql: could not read row: %v", err)
+		}
+		conts = append(conts, cont)
+	}
+	return conts, nil
+}
+
+const deletedAtStmt = `SELECT deleted_at FROM %s WHERE id = ? AND deleted_at IS NOT NULL`
+
+// deletedAt returns when the record in the table was deleted, or ErrNotFound
+// if it is not in the trash.
+func deletedAt(tx *sql.Tx, table string, id int64) (int64, error) {
+	var when int64
+	err := tx.QueryRow(fmt.Sprintf(deletedAtStmt, table), id).Scan(&when)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("%w: deleted %s id %d", ErrNotFound, table, id)
+	} else if err != nil {
+		return 0, fmt.Errorf("sql: could not read %s: %v", table, err)
+	}
+	return when, nil
+}
+
+const undeleteContributionStmt = `UPDATE contributions SET deleted_at = NULL WHERE id = ?`
+
+const undeleteContributionCheckoutsStmt = `
+UPDATE checkouts SET deleted_at = NULL WHERE contribution = ? AND deleted_at = ?`
+
+// UndeleteContribution restores a contribution from the trash, along with the
+// checkouts that were deleted with it.
+func (d *database) UndeleteContribution(id int64) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("sql: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	when, err := deletedAt(tx, "contributions", id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(undeleteContributionStmt, id); err != nil {
+		return fmt.Errorf("sql: could not restore contribution: %v", err)
+	}
+	if _, err := tx.Exec(undeleteContributionCheckoutsStmt, id, when); err != nil {
+		return fmt.Errorf("sql: could not restore checkouts: %v", err)
+	}
+	if err := d.audit(tx).added(AuditRestore, TableContributions, id); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sql: could not commit transaction: %v", err)
+	}
+	return nil
+}
+
+const purgeContributionCheckoutsStmt = `DELETE FROM checkouts WHERE contribution = ?`
+
+const purgeContributionStmt = `DELETE FROM contributions WHERE id = ?`
+
+// PurgeContribution permanently removes a contribution in the trash, and all
+// of its checkouts. Only the purge of the contribution is audited.
+func (d *database) PurgeContribution(id int64) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("sql: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := deletedAt(tx, "contributions", id); err != nil {
+		return err
+	}
+	done, err := d.audit(tx).change(AuditPurge, TableContributions, id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(purgeContributionCheckoutsStmt, id); err != nil {
+		return fmt.Errorf("sql: could not purge checkouts: %v", err)
+	}
+	if _, err := tx.Exec(purgeContributionStmt, id); err != nil {
+		return fmt.Errorf("sql: could not purge contribution: %v", err)
+	}
+	if err := done(); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sql: could not commit transaction: %v", err)
+	}
 	return nil
 }
 
-const listCheckoutsStmt = `SELECT * FROM checkouts ORDER BY date`
+const checkoutColumns = `id, user, contribution, quantity, date, twelfths, deleted_at`
+
+const listCheckoutsStmt = `
+SELECT ` + checkoutColumns + ` FROM checkouts
+WHERE deleted_at IS NULL ORDER BY date`
 
 func scanCheckouts(s rowScanner) (*Checkout, error) {
 	var (
@@ -390,8 +982,9 @@ func scanCheckouts(s rowScanner) (*Checkout, error) {
 		quantity     sql.NullFloat64
 		date         sql.NullInt64
 		twelfths     sql.NullInt64
+		deletedAt    sql.NullInt64
 	)
-	if err := s.Scan(&id, &user, &contribution, &quantity, &date, &twelfths); err != nil {
+	if err := s.Scan(&id, &user, &contribution, &quantity, &date, &twelfths, &deletedAt); err != nil {
 		return nil, err
 	}
 	with := &Checkout{
@@ -401,6 +994,7 @@ func scanCheckouts(s rowScanner) (*Checkout, error) {
 		Quantity:     quantity.Float64,
 		Twelfths:     twelfths.Int64,
 		Date:         time.Unix(date.Int64, 0),
+		DeletedAt:    deletedTime(deletedAt),
 	}
 	return with, nil
 }
@@ -424,37 +1018,306 @@ func (d *database) ListCheckouts() ([]*Checkout, error) {
 	return withs, nil
 }
 
-const addCheckoutStmt = `
+const getCheckoutStmt = `
+SELECT ` + checkoutColumns + ` FROM checkouts
+WHERE id = ? AND deleted_at IS NULL`
+
+// GetCheckout returns the given checkout.
+func (d *database) GetCheckout(id int64) (*Checkout, error) {
+	with, err := scanCheckouts(d.getCheckout.QueryRow(id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: checkout id %d", ErrNotFound, id)
+	} else if err != nil {
+		return nil, fmt.Errorf("sql: could not get checkout: %v", err)
+	}
+	return with, nil
+}
+
+const addCheckoutStmt = `
 INSERT INTO checkouts (
   user, contribution, date, twelfths
   ) VALUES (?, ?, ?, ?)`
 
 // AddCheckout adds a new checkout.
 func (d *database) AddCheckout(c *Checkout) (int64, error) {
-	r, err := execAffectingOneRow(d.addCheckout, c.User, c.Contribution, c.Date.Unix(), c.Twelfths)
+	ids, err := d.AddCheckouts([]*Checkout{c})
 	if err != nil {
 		return 0, err
 	}
-	lastInsertID, err := r.LastInsertId()
+	return ids[0], nil
+}
+
+const remainingTwelfthsStmt = `
+SELECT c.quantity * 12 - IFNULL(
+  (SELECT SUM(twelfths) FROM checkouts
+   WHERE contribution = c.id AND deleted_at IS NULL), 0)
+FROM contributions c WHERE c.id = ? AND c.deleted_at IS NULL`
+
+// AddCheckouts adds a set of checkouts, such as a bottle split between
+// several users, in a single transaction. The remaining quantity of each
+// contribution is verified within the transaction, and an
+// *InsufficientStockError is returned if any would be over-drawn, in which
+// case none of the checkouts are recorded.
+func (d *database) AddCheckouts(cs []*Checkout) ([]int64, error) {
+	tx, err := d.db.Begin()
 	if err != nil {
-		return 0, fmt.Errorf("sql: could not get last insert id: %v", err)
+		return nil, fmt.Errorf("sql: could not begin transaction: %v", err)
 	}
-	return lastInsertID, nil
+	defer tx.Rollback()
+
+	ids, err := d.addCheckouts(tx, cs)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("sql: could not commit transaction: %v", err)
+	}
+	return ids, nil
+}
+
+// addCheckouts adds checkouts and enqueues the events they cause in the
+// transaction.
+func (d *database) addCheckouts(tx *sql.Tx, cs []*Checkout) ([]int64, error) {
+	requested := map[int64]int64{}
+	var users []int64
+	for _, c := range cs {
+		if c.Twelfths <= 0 {
+			return nil, fmt.Errorf("invalid checkout quantity: %d twelfths", c.Twelfths)
+		}
+		requested[c.Contribution] += c.Twelfths
+		users = append(users, c.User)
+	}
+	for cont, want := range requested {
+		var remaining int64
+		err := tx.Stmt(d.remainingTwelfths).QueryRow(cont).Scan(&remaining)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: contribution id %d", ErrNotFound, cont)
+		} else if err != nil {
+			return nil, fmt.Errorf("sql: could not read remaining quantity: %v", err)
+		}
+		if want > remaining {
+			return nil, &InsufficientStockError{
+				Contribution: cont,
+				Requested:    want,
+				Remaining:    remaining,
+			}
+		}
+	}
+
+	before, err := d.txBalances(tx, users)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(cs))
+	addCheckout := tx.Stmt(d.addCheckout)
+	for _, c := range cs {
+		r, err := execAffectingOneRow(addCheckout, c.User, c.Contribution, c.Date.Unix(), c.Twelfths)
+		if err != nil {
+			return nil, err
+		}
+		lastInsertID, err := r.LastInsertId()
+		if err != nil {
+			return nil, fmt.Errorf("sql: could not get last insert id: %v", err)
+		}
+		ids = append(ids, lastInsertID)
+	}
+	if err := d.audit(tx).added(AuditInsert, TableCheckouts, ids...); err != nil {
+		return nil, err
+	}
+	events, err := d.checkoutEvents(tx, cs, ids)
+	if err != nil {
+		return nil, err
+	}
+	after, err := d.txBalances(tx, users)
+	if err != nil {
+		return nil, err
+	}
+	events = append(events, negativeBalanceEvents(users, before, after)...)
+	if err := d.enqueue(tx, events); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+const editCheckoutStmt = `
+UPDATE checkouts SET user=?, twelfths=? WHERE id=? AND deleted_at IS NULL`
+
+// EditCheckout changes the user and quantity of a checkout. The remaining
+// quantity of the contribution is verified within the transaction, and an
+// *InsufficientStockError is returned if it would be over-drawn.
+func (d *database) EditCheckout(c *Checkout) error {
+	if c.Twelfths <= 0 {
+		return fmt.Errorf("invalid checkout quantity: %d twelfths", c.Twelfths)
+	}
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("sql: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	done, err := d.audit(tx).change(AuditEdit, TableCheckouts, c.ID)
+	if err != nil {
+		return err
+	}
+	old, err := scanCheckouts(tx.Stmt(d.getCheckout).QueryRow(c.ID))
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: checkout id %d", ErrNotFound, c.ID)
+	} else if err != nil {
+		return fmt.Errorf("sql: could not get checkout: %v", err)
+	}
+	var remaining int64
+	if err := tx.Stmt(d.remainingTwelfths).QueryRow(old.Contribution).Scan(&remaining); err != nil {
+		return fmt.Errorf("sql: could not read remaining quantity: %v", err)
+	}
+	if available := remaining + old.Twelfths; c.Twelfths > available {
+		return &InsufficientStockError{
+			Contribution: old.Contribution,
+			Requested:    c.Twelfths,
+			Remaining:    available,
+		}
+	}
+	if _, err := execAffectingOneRow(tx.Stmt(d.editCheckout), c.User, c.Twelfths, c.ID); err != nil {
+		return err
+	}
+	if err := done(); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sql: could not commit transaction: %v", err)
+	}
+	return nil
 }
 
 const delCheckoutStmt = `
-DELETE FROM checkouts WHERE id = ?`
+UPDATE checkouts SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`
 
-// DeleteCheckout removes a checkout.
+// DeleteCheckout moves a checkout to the trash.
 func (d *database) DeleteCheckout(id int64) error {
-	_, err := execAffectingOneRow(d.delCheckout, id)
+	return d.write(func(tx *sql.Tx) error {
+		done, err := d.audit(tx).change(AuditDelete, TableCheckouts, id)
+		if err != nil {
+			return err
+		}
+		r, err := tx.Stmt(d.delCheckout).Exec(time.Now().UnixNano(), id)
+		if err != nil {
+			return fmt.Errorf("sql: could not delete checkout: %v", err)
+		}
+		if n, err := r.RowsAffected(); err != nil {
+			return fmt.Errorf("sql: could not get rows affected: %v", err)
+		} else if n == 0 {
+			return fmt.Errorf("%w: checkout id %d", ErrNotFound, id)
+		}
+		return done()
+	})
+}
+
+const listDeletedCheckoutsStmt = `
+SELECT ` + checkoutColumns + ` FROM checkouts
+WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC`
+
+// ListDeletedCheckouts returns all checkouts in the trash, most recently
+// deleted first. This includes checkouts deleted along with their
+// contribution.
+func (d *database) ListDeletedCheckouts() ([]*Checkout, error) {
+	rows, err := d.db.Query(listDeletedCheckoutsStmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var couts []*Checkout
+	for rows.Next() {
+		cout, err := scanCheckouts(rows)
+		if err != nil {
+			return nil, fmt.Errorf("sql: could not read row: %v", err)
+		}
+		couts = append(couts, cout)
+	}
+	return couts, nil
+}
+
+const deletedCheckoutStmt = `SELECT contribution, twelfths FROM checkouts WHERE id = ?`
+
+const undeleteCheckoutStmt = `UPDATE checkouts SET deleted_at = NULL WHERE id = ?`
+
+// UndeleteCheckout restores a checkout from the trash. Its contribution must
+// not be deleted, and an *InsufficientStockError is returned if the
+// contribution has since been taken by others.
+func (d *database) UndeleteCheckout(id int64) error {
+	tx, err := d.db.Begin()
 	if err != nil {
+		return fmt.Errorf("sql: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := deletedAt(tx, "checkouts", id); err != nil {
+		return err
+	}
+	var cont, twelfths, remaining int64
+	if err := tx.QueryRow(deletedCheckoutStmt, id).Scan(&cont, &twelfths); err != nil {
+		return fmt.Errorf("sql: could not get checkout: %v", err)
+	}
+	err = tx.Stmt(d.remainingTwelfths).QueryRow(cont).Scan(&remaining)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: contribution id %d", ErrNotFound, cont)
+	} else if err != nil {
+		return fmt.Errorf("sql: could not read remaining quantity: %v", err)
+	}
+	if twelfths > remaining {
+		return &InsufficientStockError{
+			Contribution: cont,
+			Requested:    twelfths,
+			Remaining:    remaining,
+		}
+	}
+	if _, err := tx.Exec(undeleteCheckoutStmt, id); err != nil {
+		return fmt.Errorf("sql: could not restore checkout: %v", err)
+	}
+	if err := d.audit(tx).added(AuditRestore, TableCheckouts, id); err != nil {
 		return err
 	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sql: could not commit transaction: %v", err)
+	}
 	return nil
 }
 
-const listSubscriptionsStmt = `SELECT * FROM subscriptions`
+const purgeCheckoutStmt = `DELETE FROM checkouts WHERE id = ?`
+
+// PurgeCheckout permanently removes a checkout in the trash.
+func (d *database) PurgeCheckout(id int64) error {
+	return d.purge("checkouts", purgeCheckoutStmt, id)
+}
+
+// purge permanently removes a record in the trash from the table.
+func (d *database) purge(table, stmt string, id int64) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("sql: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := deletedAt(tx, table, id); err != nil {
+		return err
+	}
+	done, err := d.audit(tx).change(AuditPurge, table, id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(stmt, id); err != nil {
+		return fmt.Errorf("sql: could not purge %s: %v", table, err)
+	}
+	if err := done(); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sql: could not commit transaction: %v", err)
+	}
+	return nil
+}
+
+const listSubscriptionsStmt = `
+SELECT id, endpoint, key, auth, userAgent, host, cookie, user, muted FROM subscriptions`
 
 func scanSubs(s rowScanner) (*Subscription, error) {
 	var (
@@ -465,8 +1328,10 @@ func scanSubs(s rowScanner) (*Subscription, error) {
 		userAgent sql.NullString
 		host      sql.NullString
 		cookie    sql.NullString
+		user      sql.NullInt64
+		muted     sql.NullString
 	)
-	if err := s.Scan(&id, &endpoint, &key, &auth, &userAgent, &host, &cookie); err != nil {
+	if err := s.Scan(&id, &endpoint, &key, &auth, &userAgent, &host, &cookie, &user, &muted); err != nil {
 		return nil, err
 	}
 	sub := &Subscription{
@@ -477,6 +1342,8 @@ func scanSubs(s rowScanner) (*Subscription, error) {
 		UserAgent: userAgent.String,
 		Host:      host.String,
 		Cookie:    cookie.String,
+		User:      user.Int64,
+		Muted:     splitEvents(muted.String),
 	}
 	return sub, nil
 }
@@ -500,13 +1367,13 @@ func (d *database) ListSubscriptions() ([]*Subscription, error) {
 
 const addSubscriptionStmt = `
 INSERT INTO subscriptions (
-endpoint, key, auth, userAgent, host, cookie) VALUES (?, ?, ?, ?, ?, ?)`
+endpoint, key, auth, userAgent, host, cookie, user, muted) VALUES (?, ?, ?, ?, ?, ?, NULLIF(?, 0), ?)`
 
 func (d *database) AddSubscription(s *Subscription) (int64, error) {
 	r, err := execAffectingOneRow(d.addSubscription, s.Endpoint, s.Key, s.Auth,
-		s.UserAgent, s.Host, s.Cookie)
+		s.UserAgent, s.Host, s.Cookie, s.User, joinEvents(s.Muted))
 	if err != nil {
-		return 0, nil
+		return 0, err
 	}
 	lastInsertID, err := r.LastInsertId()
 	if err != nil {
@@ -523,29 +1390,412 @@ func (d *database) DeleteSubscription(id int64) error {
 	return err
 }
 
+const claimSubscriptionStmt = `
+UPDATE subscriptions SET user = NULLIF(?, 0) WHERE cookie = ?`
+
+const muteSubscriptionStmt = `UPDATE subscriptions SET muted = ? WHERE id = ?`
+
+// SetSubscriptionMuted sets the event types a subscription does not receive.
+func (d *database) SetSubscriptionMuted(id int64, muted []EventType) error {
+	r, err := d.muteSubscription.Exec(joinEvents(muted), id)
+	if err != nil {
+		return fmt.Errorf("sql: could not set muted events: %v", err)
+	}
+	if n, err := r.RowsAffected(); err != nil {
+		return fmt.Errorf("sql: could not get rows affected: %v", err)
+	} else if n == 0 {
+		return fmt.Errorf("%w: subscription id %d", ErrNotFound, id)
+	}
+	return nil
+}
+
+// checkoutEvents returns the events caused by the checkouts with the ids:
+// contributions being tapped and beers running out.
+func (d *database) checkoutEvents(tx *sql.Tx, cs []*Checkout, ids []int64) ([]*Event, error) {
+	var events []*Event
+	conts := map[int64]*Contribution{}
+	getContribution := tx.Stmt(d.getContribution)
+	for i, c := range cs {
+		cont := conts[c.Contribution]
+		if cont == nil {
+			var err error
+			if cont, err = scanContributions(getContribution.QueryRow(c.Contribution)); err != nil {
+				return nil, fmt.Errorf("sql: could not get contribution: %v", err)
+			}
+			conts[c.Contribution] = cont
+		}
+		if c.User != cont.User {
+			events = append(events, &Event{Type: EventTapped, User: cont.User, Record: ids[i]})
+		}
+	}
+	beers := map[int64]bool{}
+	beerRemaining := tx.Stmt(d.beerRemaining)
+	for _, c := range cs {
+		beer := conts[c.Contribution].Beer
+		if beers[beer] {
+			continue
+		}
+		beers[beer] = true
+		var remaining int64
+		if err := beerRemaining.QueryRow(beer).Scan(&remaining); err != nil {
+			return nil, fmt.Errorf("sql: could not read remaining quantity: %v", err)
+		}
+		if remaining == 0 {
+			events = append(events, &Event{Type: EventOutOfStock, Record: beer})
+		}
+	}
+	return events, nil
+}
+
+const addDeliveryStmt = `
+INSERT INTO outbox(subscription, event, user, record, created, nextattempt)
+VALUES (?, ?, NULLIF(?, 0), ?, ?, ?)`
+
+// enqueue adds deliveries of the events to the outbox for every
+// subscription wanting them, in the transaction of the change causing them.
+func (d *database) enqueue(tx *sql.Tx, events []*Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	rows, err := tx.Stmt(d.listSubscriptions).Query()
+	if err != nil {
+		return fmt.Errorf("sql: could not list subscriptions: %v", err)
+	}
+	var subs []*Subscription
+	for rows.Next() {
+		sub, err := scanSubs(rows)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("sql: could not read row: %v", err)
+		}
+		subs = append(subs, sub)
+	}
+	rows.Close()
+	now := time.Now().Unix()
+	addDelivery := tx.Stmt(d.addDelivery)
+	for _, e := range events {
+		if e.Cookie == "" && d.actor != nil {
+			e.Cookie = d.actor.Cookie
+		}
+		for _, sub := range subs {
+			if !sub.Wants(e) {
+				continue
+			}
+			if _, err := addDelivery.Exec(sub.ID, e.Type, e.User, e.Record, now, now); err != nil {
+				return fmt.Errorf("sql: could not add delivery: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// txBalances returns the net positions of the users in the transaction.
+func (d *database) txBalances(tx *sql.Tx, users []int64) (map[int64]Money, error) {
+	m := map[int64]Money{}
+	getBalance := tx.Stmt(d.getBalance)
+	for _, u := range users {
+		b, err := scanBalances(getBalance.QueryRow(u))
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: user id %d", ErrNotFound, u)
+		} else if err != nil {
+			return nil, fmt.Errorf("sql: could not read balance: %v", err)
+		}
+		m[u] = b.NetPosition()
+	}
+	return m, nil
+}
+
+const deliveryColumns = `
+id, subscription, event, IFNULL(user, 0), record, created, attempts, nextattempt,
+IFNULL(lasterror, ''), failed`
+
+func scanDeliveries(s rowScanner) (*Delivery, error) {
+	var (
+		dl                   Delivery
+		created, nextAttempt int64
+	)
+	if err := s.Scan(&dl.ID, &dl.Subscription, &dl.Event.Type, &dl.Event.User, &dl.Event.Record,
+		&created, &dl.Attempts, &nextAttempt, &dl.LastError, &dl.Failed); err != nil {
+		return nil, err
+	}
+	dl.Created = time.Unix(created, 0)
+	dl.NextAttempt = time.Unix(nextAttempt, 0)
+	return &dl, nil
+}
+
+func queryDeliveries(stmt *sql.Stmt, args ...interface{}) ([]*Delivery, error) {
+	rows, err := stmt.Query(args...)
+	if err != nil {
+		return nil, fmt.Errorf("sql: could not list deliveries: %v", err)
+	}
+	defer rows.Close()
+	var dls []*Delivery
+	for rows.Next() {
+		dl, err := scanDeliveries(rows)
+		if err != nil {
+			return nil, fmt.Errorf("sql: could not read row: %v", err)
+		}
+		dls = append(dls, dl)
+	}
+	return dls, rows.Err()
+}
+
+const listDeliveriesStmt = `SELECT ` + deliveryColumns + ` FROM outbox ORDER BY id`
+
+// ListDeliveries lists the pending and failed deliveries.
+func (d *database) ListDeliveries() ([]*Delivery, error) {
+	return queryDeliveries(d.listDeliveries)
+}
+
+const dueDeliveriesStmt = `
+SELECT ` + deliveryColumns + ` FROM outbox
+WHERE failed = 0 AND nextattempt <= ? ORDER BY id LIMIT ?`
+
+// DueDeliveries returns the pending deliveries due to be sent.
+func (d *database) DueDeliveries(by time.Time, limit int) ([]*Delivery, error) {
+	return queryDeliveries(d.dueDeliveries, by.Unix(), limit)
+}
+
+// execDelivery runs a statement changing the delivery with the id, the last
+// argument.
+func execDelivery(stmt *sql.Stmt, args ...interface{}) error {
+	r, err := stmt.Exec(args...)
+	if err != nil {
+		return fmt.Errorf("sql: could not update delivery: %v", err)
+	}
+	if n, err := r.RowsAffected(); err != nil {
+		return fmt.Errorf("sql: could not get rows affected: %v", err)
+	} else if n == 0 {
+		return fmt.Errorf("%w: delivery id %d", ErrNotFound, args[len(args)-1])
+	}
+	return nil
+}
+
+const failDeliveryStmt = `
+UPDATE outbox SET attempts = attempts + 1, lasterror = ?, nextattempt = ?, failed = ?
+WHERE id = ?`
+
+// FailDelivery records a failed attempt to send a delivery.
+func (d *database) FailDelivery(id int64, reason string, retry time.Time, dead bool) error {
+	return execDelivery(d.failDelivery, reason, retry.Unix(), dead, id)
+}
+
+const retryDeliveryStmt = `
+UPDATE outbox SET failed = 0, nextattempt = ? WHERE id = ?`
+
+// RetryDelivery makes a delivery due now.
+func (d *database) RetryDelivery(id int64) error {
+	return execDelivery(d.retryDelivery, time.Now().Unix(), id)
+}
+
+const delDeliveryStmt = `DELETE FROM outbox WHERE id = ?`
+
+// DeleteDelivery removes a delivery from the outbox.
+func (d *database) DeleteDelivery(id int64) error {
+	return execDelivery(d.delDelivery, id)
+}
+
+// ClaimSubscriptions sets the user of a browser's subscriptions.
+func (d *database) ClaimSubscriptions(cookie string, user int64) (int64, error) {
+	r, err := d.claimSubscription.Exec(user, cookie)
+	if err != nil {
+		return 0, fmt.Errorf("sql: could not claim subscriptions: %v", err)
+	}
+	n, err := r.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("sql: could not get rows affected: %v", err)
+	}
+	return n, nil
+}
+
+const suggestionColumns = `id, user, checkin, beer, date, state, IFNULL(checkout, 0)`
+
+func scanSuggestions(s rowScanner) (*Suggestion, error) {
+	var (
+		sg   Suggestion
+		date int64
+	)
+	if err := s.Scan(&sg.ID, &sg.User, &sg.Checkin, &sg.Beer, &date, &sg.State, &sg.Checkout); err != nil {
+		return nil, err
+	}
+	sg.Date = time.Unix(date, 0)
+	return &sg, nil
+}
+
+const addSuggestionStmt = `
+INSERT INTO suggestions(user, checkin, beer, date) VALUES (?, ?, ?, ?)
+ON CONFLICT(user, checkin) DO NOTHING`
+
+// AddSuggestion adds a pending suggestion, unless the check-in has already
+// been suggested to the user.
+func (d *database) AddSuggestion(sg *Suggestion) (int64, error) {
+	r, err := d.addSuggestion.Exec(sg.User, sg.Checkin, sg.Beer, sg.Date.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("sql: could not add suggestion: %v", err)
+	}
+	if n, err := r.RowsAffected(); err != nil {
+		return 0, fmt.Errorf("sql: could not get rows affected: %v", err)
+	} else if n == 0 {
+		return 0, fmt.Errorf("%w: check-in %d of user id %d", ErrExists, sg.Checkin, sg.User)
+	}
+	lastInsertID, err := r.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("sql: could not get last insert id: %v", err)
+	}
+	return lastInsertID, nil
+}
+
+const getSuggestionStmt = `SELECT ` + suggestionColumns + ` FROM suggestions WHERE id = ?`
+
+// GetSuggestion returns the given suggestion.
+func (d *database) GetSuggestion(id int64) (*Suggestion, error) {
+	sg, err := scanSuggestions(d.getSuggestion.QueryRow(id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: suggestion id %d", ErrNotFound, id)
+	} else if err != nil {
+		return nil, fmt.Errorf("sql: could not get suggestion: %v", err)
+	}
+	return sg, nil
+}
+
+const listSuggestionsStmt = `
+SELECT ` + suggestionColumns + ` FROM suggestions
+WHERE (?1 = 0 OR user = ?1) AND state = ?2 ORDER BY date DESC, id DESC`
+
+// ListSuggestions returns the suggestions to a user in a state.
+func (d *database) ListSuggestions(user int64, state SuggestionState) ([]*Suggestion, error) {
+	rows, err := d.listSuggestions.Query(user, state)
+	if err != nil {
+		return nil, fmt.Errorf("sql: could not list suggestions: %v", err)
+	}
+	defer rows.Close()
+	var sgs []*Suggestion
+	for rows.Next() {
+		sg, err := scanSuggestions(rows)
+		if err != nil {
+			return nil, fmt.Errorf("sql: could not read row: %v", err)
+		}
+		sgs = append(sgs, sg)
+	}
+	return sgs, rows.Err()
+}
+
+const answerSuggestionStmt = `
+UPDATE suggestions SET state = ?, checkout = NULLIF(?, 0) WHERE id = ? AND state = 'pending'`
+
+// contribsRemainingStmt lists the contributions of a beer with some left,
+// oldest first, with the twelfths left in each.
+const contribsRemainingStmt = `
+SELECT id, remaining FROM (
+  SELECT c.id, c.date, c.quantity * 12 - IFNULL(
+    (SELECT SUM(twelfths) FROM checkouts
+     WHERE contribution = c.id AND deleted_at IS NULL), 0) AS remaining
+  FROM contributions c WHERE c.beer = ? AND c.deleted_at IS NULL
+) WHERE remaining > 0 ORDER BY date, id`
+
+// answerSuggestion sets the state of a pending suggestion.
+func answerSuggestion(stmt *sql.Stmt, id int64, state SuggestionState, checkout int64) error {
+	r, err := stmt.Exec(state, checkout, id)
+	if err != nil {
+		return fmt.Errorf("sql: could not update suggestion: %v", err)
+	}
+	if n, err := r.RowsAffected(); err != nil {
+		return fmt.Errorf("sql: could not get rows affected: %v", err)
+	} else if n == 0 {
+		return fmt.Errorf("%w: pending suggestion id %d", ErrNotFound, id)
+	}
+	return nil
+}
+
+// ConfirmSuggestion checks out the suggested beer from the oldest
+// contribution with enough left, and marks the suggestion confirmed. The
+// checkout is dated when the beer was checked in.
+func (d *database) ConfirmSuggestion(id, twelfths int64) (int64, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("sql: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	sg, err := scanSuggestions(tx.Stmt(d.getSuggestion).QueryRow(id))
+	if err == sql.ErrNoRows || (err == nil && sg.State != SuggestionPending) {
+		return 0, fmt.Errorf("%w: pending suggestion id %d", ErrNotFound, id)
+	} else if err != nil {
+		return 0, fmt.Errorf("sql: could not get suggestion: %v", err)
+	}
+	rows, err := tx.Stmt(d.contribsRemaining).Query(sg.Beer)
+	if err != nil {
+		return 0, fmt.Errorf("sql: could not list contributions: %v", err)
+	}
+	var cont, most int64
+	for rows.Next() {
+		var c, remaining int64
+		if err := rows.Scan(&c, &remaining); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("sql: could not read row: %v", err)
+		}
+		if remaining >= twelfths {
+			cont = c
+			break
+		}
+		if remaining > most {
+			most = remaining
+		}
+	}
+	rows.Close()
+	if cont == 0 {
+		return 0, &InsufficientStockError{Beer: sg.Beer, Requested: twelfths, Remaining: most}
+	}
+	ids, err := d.addCheckouts(tx, []*Checkout{{
+		User:         sg.User,
+		Contribution: cont,
+		Twelfths:     twelfths,
+		Date:         sg.Date,
+	}})
+	if err != nil {
+		return 0, err
+	}
+	if err := answerSuggestion(tx.Stmt(d.answerSuggestion), id, SuggestionConfirmed, ids[0]); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("sql: could not commit transaction: %v", err)
+	}
+	return ids[0], nil
+}
+
+// DismissSuggestion marks a pending suggestion dismissed.
+func (d *database) DismissSuggestion(id int64) error {
+	return answerSuggestion(d.answerSuggestion, id, SuggestionDismissed, 0)
+}
+
 func scanDebitCredits(s rowScanner) (*DebitCredit, error) {
 	var (
-		id      int64
-		user    sql.NullInt64
-		amount  sql.NullInt64
-		date    sql.NullInt64
-		comment sql.NullString
+		id        int64
+		user      sql.NullInt64
+		amount    sql.NullInt64
+		date      sql.NullInt64
+		comment   sql.NullString
+		deletedAt sql.NullInt64
 	)
-	if err := s.Scan(&id, &user, &amount, &date, &comment); err != nil {
+	if err := s.Scan(&id, &user, &amount, &date, &comment, &deletedAt); err != nil {
 		return nil, err
 	}
 	dc := &DebitCredit{
-		ID:      id,
-		User:    user.Int64,
-		Amount:  float64(amount.Int64) / 100,
-		Date:    time.Unix(date.Int64, 0),
-		Comment: comment.String,
+		ID:        id,
+		User:      user.Int64,
+		Amount:    Money(amount.Int64),
+		Date:      time.Unix(date.Int64, 0),
+		Comment:   comment.String,
+		DeletedAt: deletedTime(deletedAt),
 	}
 	return dc, nil
 }
 
+const debitCreditColumns = `id, user, amount, date, comment, deleted_at`
+
 const listDebitCreditsStmt = `
-SELECT * FROM debitsCredits`
+SELECT ` + debitCreditColumns + ` FROM debitsCredits WHERE deleted_at IS NULL`
 
 // ListDebitCredits lists all debits/credits.
 func (d *database) ListDebitCredits() ([]*DebitCredit, error) {
@@ -566,6 +1816,21 @@ func (d *database) ListDebitCredits() ([]*DebitCredit, error) {
 	return dcs, nil
 }
 
+const getDebitCreditStmt = `
+SELECT ` + debitCreditColumns + ` FROM debitsCredits
+WHERE id = ? AND deleted_at IS NULL`
+
+// GetDebitCredit returns the given debit/credit.
+func (d *database) GetDebitCredit(id int64) (*DebitCredit, error) {
+	dc, err := scanDebitCredits(d.getDebitCredit.QueryRow(id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: debit/credit id %d", ErrNotFound, id)
+	} else if err != nil {
+		return nil, fmt.Errorf("sql: could not get debit/credit: %v", err)
+	}
+	return dc, nil
+}
+
 const addDebitCreditStmt = `
 INSERT INTO debitsCredits (
   user, amount, date, comment
@@ -573,7 +1838,410 @@ INSERT INTO debitsCredits (
 
 // AddCheckout adds a new checkout.
 func (d *database) AddDebitCredit(dc *DebitCredit) (int64, error) {
-	r, err := execAffectingOneRow(d.addDebitCredit, dc.User, int64(dc.Amount*100), dc.Date.Unix(), dc.Comment)
+	ids, err := d.AddDebitCredits([]*DebitCredit{dc})
+	if err != nil {
+		return 0, err
+	}
+	return ids[0], nil
+}
+
+// AddDebitCredits atomically adds several debits/credits, returning their ids
+// in order. Either all are added or none are.
+func (d *database) AddDebitCredits(dcs []*DebitCredit) ([]int64, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("sql: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var users []int64
+	for _, dc := range dcs {
+		users = append(users, dc.User)
+	}
+	before, err := d.txBalances(tx, users)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(dcs))
+	var events []*Event
+	addDebitCredit := tx.Stmt(d.addDebitCredit)
+	for _, dc := range dcs {
+		r, err := execAffectingOneRow(addDebitCredit, dc.User, dc.Amount.Cents(), dc.Date.Unix(), dc.Comment)
+		if err != nil {
+			return nil, err
+		}
+		lastInsertID, err := r.LastInsertId()
+		if err != nil {
+			return nil, fmt.Errorf("sql: could not get last insert id: %v", err)
+		}
+		ids = append(ids, lastInsertID)
+		events = append(events, &Event{Type: EventDebitCredit, User: dc.User, Record: lastInsertID})
+	}
+	if err := d.audit(tx).added(AuditInsert, TableDebitCredits, ids...); err != nil {
+		return nil, err
+	}
+	after, err := d.txBalances(tx, users)
+	if err != nil {
+		return nil, err
+	}
+	events = append(events, negativeBalanceEvents(users, before, after)...)
+	if err := d.enqueue(tx, events); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("sql: could not commit transaction: %v", err)
+	}
+	return ids, nil
+}
+
+const editDebitCreditStmt = `
+UPDATE debitsCredits SET amount=?, comment=? WHERE id=? AND deleted_at IS NULL`
+
+// EditDebitCredit changes the amount and comment of a debit/credit.
+func (d *database) EditDebitCredit(dc *DebitCredit) error {
+	return d.write(func(tx *sql.Tx) error {
+		done, err := d.audit(tx).change(AuditEdit, TableDebitCredits, dc.ID)
+		if err != nil {
+			return err
+		}
+		if _, err := execAffectingOneRow(tx.Stmt(d.editDebitCredit), dc.Amount.Cents(), dc.Comment, dc.ID); err != nil {
+			return err
+		}
+		return done()
+	})
+}
+
+const delDebitCreditStmt = `
+UPDATE debitsCredits SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`
+
+// DeleteDebitCredit moves a debit/credit to the trash.
+func (d *database) DeleteDebitCredit(id int64) error {
+	return d.write(func(tx *sql.Tx) error {
+		done, err := d.audit(tx).change(AuditDelete, TableDebitCredits, id)
+		if err != nil {
+			return err
+		}
+		r, err := tx.Stmt(d.delDebitCredit).Exec(time.Now().UnixNano(), id)
+		if err != nil {
+			return fmt.Errorf("sql: could not delete debit/credit: %v", err)
+		}
+		if n, err := r.RowsAffected(); err != nil {
+			return fmt.Errorf("sql: could not get rows affected: %v", err)
+		} else if n == 0 {
+			return fmt.Errorf("%w: debit/credit id %d", ErrNotFound, id)
+		}
+		return done()
+	})
+}
+
+const listDeletedDebitCreditsStmt = `
+SELECT ` + debitCreditColumns + ` FROM debitsCredits
+WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC`
+
+// ListDeletedDebitCredits returns all debits/credits in the trash, most
+// recently deleted first.
+func (d *database) ListDeletedDebitCredits() ([]*DebitCredit, error) {
+	rows, err := d.db.Query(listDeletedDebitCreditsStmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var dcs []*DebitCredit
+	for rows.Next() {
+		dc, err := scanDebitCredits(rows)
+		if err != nil {
+			return nil, fmt.Errorf("sql: could not read row: %v", err)
+		}
+		dcs = append(dcs, dc)
+	}
+	return dcs, nil
+}
+
+const undeleteDebitCreditStmt = `UPDATE debitsCredits SET deleted_at = NULL WHERE id = ?`
+
+// UndeleteDebitCredit restores a debit/credit from the trash.
+func (d *database) UndeleteDebitCredit(id int64) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("sql: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := deletedAt(tx, "debitsCredits", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(undeleteDebitCreditStmt, id); err != nil {
+		return fmt.Errorf("sql: could not restore debit/credit: %v", err)
+	}
+	if err := d.audit(tx).added(AuditRestore, TableDebitCredits, id); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sql: could not commit transaction: %v", err)
+	}
+	return nil
+}
+
+const purgeDebitCreditStmt = `DELETE FROM debitsCredits WHERE id = ?`
+
+// PurgeDebitCredit permanently removes a debit/credit in the trash.
+func (d *database) PurgeDebitCredit(id int64) error {
+	return d.purge("debitsCredits", purgeDebitCreditStmt, id)
+}
+
+// ContributionRemaining returns the quantity of a contribution that has not
+// been checked out, in twelfths.
+func (d *database) ContributionRemaining(id int64) (int64, error) {
+	var remaining int64
+	if err := d.remainingTwelfths.QueryRow(id).Scan(&remaining); err == sql.ErrNoRows {
+		return 0, fmt.Errorf("%w: contribution id %d", ErrNotFound, id)
+	} else if err != nil {
+		return 0, fmt.Errorf("sql: could not read remaining quantity: %v", err)
+	}
+	return remaining, nil
+}
+
+const beerRemainingStmt = `
+SELECT
+  IFNULL((SELECT SUM(quantity * 12) FROM contributions
+    WHERE beer = ?1 AND deleted_at IS NULL), 0) -
+  IFNULL((SELECT SUM(co.twelfths) FROM checkouts co
+    JOIN contributions c ON c.id = co.contribution
+    WHERE c.beer = ?1 AND co.deleted_at IS NULL AND c.deleted_at IS NULL), 0)`
+
+// BeerRemaining returns the quantity of a beer across all contributions that
+// has not been checked out, in twelfths.
+func (d *database) BeerRemaining(id int64) (int64, error) {
+	var remaining int64
+	if err := d.beerRemaining.QueryRow(id).Scan(&remaining); err != nil {
+		return 0, fmt.Errorf("sql: could not read remaining quantity: %v", err)
+	}
+	return remaining, nil
+}
+
+// remainingQuery gives the twelfths left in each contribution not in the
+// trash.
+const remainingQuery = `
+SELECT c.id, c.beer, c.quantity * 12 - IFNULL(t.taken, 0) AS remaining
+FROM contributions c
+LEFT JOIN (
+  SELECT contribution, SUM(twelfths) AS taken
+  FROM checkouts WHERE deleted_at IS NULL GROUP BY contribution
+) t ON t.contribution = c.id
+WHERE c.deleted_at IS NULL`
+
+const listRemainingStmt = `SELECT id, remaining FROM (` + remainingQuery + `)`
+
+const listBeersLeftStmt = `
+SELECT beer, SUM(remaining) FROM (` + remainingQuery + `) GROUP BY beer`
+
+// queryRemaining runs a query of ids and twelfths left into a map.
+func queryRemaining(rows *sql.Rows, err error) (map[int64]int64, error) {
+	if err != nil {
+		return nil, fmt.Errorf("sql: could not read remaining quantities: %v", err)
+	}
+	defer rows.Close()
+
+	remaining := map[int64]int64{}
+	for rows.Next() {
+		var id, twelfths int64
+		if err := rows.Scan(&id, &twelfths); err != nil {
+			return nil, fmt.Errorf("sql: could not read row: %v", err)
+		}
+		remaining[id] = twelfths
+	}
+	return remaining, rows.Err()
+}
+
+// ListContributionsRemaining returns the quantity of every contribution that
+// has not been checked out, in twelfths.
+func (d *database) ListContributionsRemaining() (map[int64]int64, error) {
+	return queryRemaining(d.listRemaining.Query())
+}
+
+// ListBeersRemaining returns the quantity of every contributed beer that has
+// not been checked out, in twelfths.
+func (d *database) ListBeersRemaining() (map[int64]int64, error) {
+	return queryRemaining(d.listBeersLeft.Query())
+}
+
+// balanceQuery totals each user's contributions, checkouts and
+// debits/credits. The value of each checkout is rounded to the nearest cent
+// individually, as Money.Twelfths does.
+const balanceQuery = `
+SELECT u.id, IFNULL(u.seedfund, 0),
+  IFNULL(a.added, 0), IFNULL(t.taken, 0), IFNULL(dc.amount, 0)
+FROM users u
+LEFT JOIN (
+  SELECT user, SUM(quantity * unitprice) AS added
+  FROM contributions WHERE deleted_at IS NULL GROUP BY user
+) a ON a.user = u.id
+LEFT JOIN (
+  SELECT co.user, SUM(CASE
+    WHEN co.twelfths * c.unitprice >= 0 THEN (co.twelfths * c.unitprice * 2 + 12) / 24
+    ELSE -((-co.twelfths * c.unitprice * 2 + 12) / 24) END) AS taken
+  FROM checkouts co JOIN contributions c ON c.id = co.contribution
+  WHERE co.deleted_at IS NULL AND c.deleted_at IS NULL
+  GROUP BY co.user
+) t ON t.user = u.id
+LEFT JOIN (
+  SELECT user, SUM(amount) AS amount
+  FROM debitsCredits WHERE deleted_at IS NULL GROUP BY user
+) dc ON dc.user = u.id`
+
+const listBalancesStmt = balanceQuery + ` ORDER BY u.name`
+
+const getBalanceStmt = balanceQuery + ` WHERE u.id = ?`
+
+func scanBalances(s rowScanner) (*Balance, error) {
+	var user, seedFund, added, taken, dc int64
+	if err := s.Scan(&user, &seedFund, &added, &taken, &dc); err != nil {
+		return nil, err
+	}
+	b := &Balance{
+		User:        user,
+		SeedFund:    Money(seedFund),
+		Added:       Money(added),
+		Taken:       Money(taken),
+		DebitCredit: Money(dc),
+	}
+	return b, nil
+}
+
+// ListBalances returns the balance of every user.
+func (d *database) ListBalances() ([]*Balance, error) {
+	rows, err := d.listBalances.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bals []*Balance
+	for rows.Next() {
+		b, err := scanBalances(rows)
+		if err != nil {
+			return nil, fmt.Errorf("sql: could not read row: %v", err)
+		}
+		bals = append(bals, b)
+	}
+	return bals, nil
+}
+
+// GetBalance returns the balance of the given user.
+func (d *database) GetBalance(user int64) (*Balance, error) {
+	b, err := scanBalances(d.getBalance.QueryRow(user))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: user id %d", ErrNotFound, user)
+	} else if err != nil {
+		return nil, fmt.Errorf("sql: could not read balance: %v", err)
+	}
+	return b, nil
+}
+
+// restoreTx runs fn in a transaction after verifying that no row of the given
+// table has the id, so that a deleted record can be put back as it was.
+func (d *database) restoreTx(table string, id int64, fn func(*sql.Tx) error) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("sql: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var n int64
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM `+table+` WHERE id = ?`, id).Scan(&n); err != nil {
+		return fmt.Errorf("sql: could not check %s: %v", table, err)
+	}
+	if n > 0 {
+		return fmt.Errorf("%w: %s id %d", ErrExists, table, id)
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := d.audit(tx).added(AuditRestore, table, id); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sql: could not commit transaction: %v", err)
+	}
+	return nil
+}
+
+const restoreBeerStmt = `
+INSERT INTO beers(
+	id, brewery, name, untappdid, untappdrating, breweryid, labelurl
+) VALUES (?,?,?,?,?,?,?)`
+
+// RestoreBeer puts back a deleted beer with its original id.
+func (d *database) RestoreBeer(b *Beer) error {
+	return d.restoreTx("beers", b.ID, func(tx *sql.Tx) error {
+		rating := int64(b.UntappdRating * 100)
+		if _, err := tx.Exec(restoreBeerStmt, b.ID, b.Brewery, b.Name, b.UntappdID, rating, b.BreweryID, b.LabelURL); err != nil {
+			return fmt.Errorf("sql: could not restore beer: %v", err)
+		}
+		return nil
+	})
+}
+
+const restoreUserStmt = `
+INSERT INTO users(id, name, untappdid, seedfund, retired) VALUES (?,?,?,?,?)`
+
+// RestoreUser puts back a user with its original id.
+func (d *database) RestoreUser(u *User) error {
+	return d.restoreTx("users", u.ID, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(restoreUserStmt, u.ID, u.Name, u.UntappdID, u.SeedFund.Cents(), u.Retired); err != nil {
+			return fmt.Errorf("sql: could not restore user: %v", err)
+		}
+		return nil
+	})
+}
+
+const auditEntryColumns = `id, time, action, tablename, record, beforejson, afterjson, remoteaddr, cookie, user`
+
+func scanAuditEntries(s rowScanner) (*AuditEntry, error) {
+	var (
+		id         int64
+		when       int64
+		action     sql.NullString
+		table      sql.NullString
+		record     sql.NullInt64
+		before     sql.NullString
+		after      sql.NullString
+		remoteAddr sql.NullString
+		cookie     sql.NullString
+		user       sql.NullInt64
+	)
+	if err := s.Scan(&id, &when, &action, &table, &record, &before, &after, &remoteAddr, &cookie, &user); err != nil {
+		return nil, err
+	}
+	return &AuditEntry{
+		ID:     id,
+		Time:   time.Unix(when, 0),
+		Action: action.String,
+		Table:  table.String,
+		Record: record.Int64,
+		Before: before.String,
+		After:  after.String,
+		Actor: Actor{
+			RemoteAddr: remoteAddr.String,
+			Cookie:     cookie.String,
+			User:       user.Int64,
+		},
+	}, nil
+}
+
+const addAuditEntryStmt = `
+INSERT INTO audit (
+  time, action, tablename, record, beforejson, afterjson, remoteaddr, cookie, user
+  ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, 0))`
+
+// AddAuditEntry appends an entry to the audit log.
+func (d *database) AddAuditEntry(e *AuditEntry) (int64, error) {
+	return addAuditEntry(d.addAuditEntry, e)
+}
+
+func addAuditEntry(stmt *sql.Stmt, e *AuditEntry) (int64, error) {
+	r, err := execAffectingOneRow(stmt, e.Time.Unix(), e.Action, e.Table, e.Record, e.Before, e.After, e.Actor.RemoteAddr, e.Actor.Cookie, e.Actor.User)
 	if err != nil {
 		return 0, err
 	}
@@ -584,16 +2252,140 @@ func (d *database) AddDebitCredit(dc *DebitCredit) (int64, error) {
 	return lastInsertID, nil
 }
 
-const delDebitCreditStmt = `
-DELETE FROM debitsCredits WHERE id = ?`
+// audited returns a copy of the database which records the changes made
+// through it in the audit log, attributed to the actor.
+func (d *database) audited(actor Actor) BeerDatabase {
+	c := *d
+	c.actor = &actor
+	return &c
+}
 
-// DeleteCheckout removes a checkout.
-func (d *database) DeleteDebitCredit(id int64) error {
-	_, err := execAffectingOneRow(d.delDebitCredit, id)
+// audit returns the audit log of the changes made in tx, or nil if the
+// database is not audited.
+func (d *database) audit(tx *sql.Tx) *auditLog {
+	return newAuditLog(d.actor, &sqlAuditTx{d: d, tx: tx})
+}
+
+// sqlAuditTx reads and records audited records in a transaction.
+type sqlAuditTx struct {
+	d  *database
+	tx *sql.Tx
+}
+
+func (a *sqlAuditTx) getRecord(table string, id int64) (interface{}, error) {
+	var (
+		record interface{}
+		err    error
+	)
+	switch table {
+	case TableUsers:
+		record, err = scanUsers(a.tx.Stmt(a.d.getUser).QueryRow(id))
+	case TableBeers:
+		record, err = scanBeers(a.tx.Stmt(a.d.getBeer).QueryRow(id))
+	case TableContributions:
+		record, err = scanContributions(a.tx.Stmt(a.d.getContribution).QueryRow(id))
+	case TableCheckouts:
+		record, err = scanCheckouts(a.tx.Stmt(a.d.getCheckout).QueryRow(id))
+	case TableDebitCredits:
+		record, err = scanDebitCredits(a.tx.Stmt(a.d.getDebitCredit).QueryRow(id))
+	default:
+		return nil, fmt.Errorf("unknown table %q", table)
+	}
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s id %d", ErrNotFound, table, id)
+	} else if err != nil {
+		return nil, fmt.Errorf("sql: could not get %s: %v", table, err)
+	}
+	return record, nil
+}
+
+const getDeletedStmt = `SELECT %s FROM %s WHERE id = ? AND deleted_at IS NOT NULL`
+
+func (a *sqlAuditTx) getDeleted(table string, id int64) (interface{}, error) {
+	var (
+		record interface{}
+		err    error
+	)
+	switch table {
+	case TableContributions:
+		record, err = scanContributions(a.tx.QueryRow(fmt.Sprintf(getDeletedStmt, contributionColumns, table), id))
+	case TableCheckouts:
+		record, err = scanCheckouts(a.tx.QueryRow(fmt.Sprintf(getDeletedStmt, checkoutColumns, table), id))
+	case TableDebitCredits:
+		record, err = scanDebitCredits(a.tx.QueryRow(fmt.Sprintf(getDeletedStmt, debitCreditColumns, table), id))
+	default:
+		return nil, nil
+	}
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("sql: could not get deleted %s: %v", table, err)
+	}
+	return record, nil
+}
+
+func (a *sqlAuditTx) addAuditEntry(e *AuditEntry) error {
+	_, err := addAuditEntry(a.tx.Stmt(a.d.addAuditEntry), e)
 	return err
 }
 
+const listAuditEntriesStmt = `
+SELECT ` + auditEntryColumns + ` FROM audit
+WHERE ? = 0 OR id < ?
+ORDER BY id DESC LIMIT ?`
+
+// ListAuditEntries returns up to limit audit entries older than the entry
+// with id before, newest first. If before is 0, the newest entries are
+// returned.
+func (d *database) ListAuditEntries(before int64, limit int) ([]*AuditEntry, error) {
+	rows, err := d.listAuditEntries.Query(before, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*AuditEntry
+	for rows.Next() {
+		e, err := scanAuditEntries(rows)
+		if err != nil {
+			return nil, fmt.Errorf("sql: could not read row: %v", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+const getAuditEntryStmt = `SELECT ` + auditEntryColumns + ` FROM audit WHERE id = ?`
+
+// GetAuditEntry returns the given audit entry.
+func (d *database) GetAuditEntry(id int64) (*AuditEntry, error) {
+	e, err := scanAuditEntries(d.getAuditEntry.QueryRow(id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: audit entry id %d", ErrNotFound, id)
+	} else if err != nil {
+		return nil, fmt.Errorf("sql: could not get audit entry: %v", err)
+	}
+	return e, nil
+}
+
 // execAffectingOneRow executes a given statement, expecting one row to be affected.
+// write runs fn in a transaction, committing it if fn succeeds.
+func (d *database) write(fn func(tx *sql.Tx) error) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("sql: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sql: could not commit transaction: %v", err)
+	}
+	return nil
+}
+
 func execAffectingOneRow(stmt *sql.Stmt, args ...interface{}) (sql.Result, error) {
 	r, err := stmt.Exec(args...)
 	if err != nil {
@@ -607,3 +2399,81 @@ func execAffectingOneRow(stmt *sql.Stmt, args ...interface{}) (sql.Result, error
 	}
 	return r, nil
 }
+
+const getPasswordHashStmt = `SELECT IFNULL(passwordhash, '') FROM users WHERE id = ?`
+
+// GetPasswordHash returns the hash of a user's PIN or password.
+func (d *database) GetPasswordHash(user int64) (string, error) {
+	var hash string
+	err := d.getPasswordHash.QueryRow(user).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("%w: user id %d", ErrNotFound, user)
+	} else if err != nil {
+		return "", fmt.Errorf("sql: could not get password hash: %v", err)
+	}
+	return hash, nil
+}
+
+const setPasswordHashStmt = `UPDATE users SET passwordhash = NULLIF(?, '') WHERE id = ?`
+
+const delUserSessionsStmt = `DELETE FROM sessions WHERE user = ?`
+
+// SetPasswordHash sets the hash of a user's PIN or password, ending their
+// login sessions.
+func (d *database) SetPasswordHash(user int64, hash string) error {
+	return d.write(func(tx *sql.Tx) error {
+		return d.txSetPasswordHash(tx, user, hash)
+	})
+}
+
+func (d *database) txSetPasswordHash(tx *sql.Tx, user int64, hash string) error {
+	r, err := tx.Stmt(d.setPasswordHash).Exec(hash, user)
+	if err != nil {
+		return fmt.Errorf("sql: could not set password hash: %v", err)
+	}
+	if n, err := r.RowsAffected(); err != nil {
+		return fmt.Errorf("sql: could not get rows affected: %v", err)
+	} else if n == 0 {
+		return fmt.Errorf("%w: user id %d", ErrNotFound, user)
+	}
+	if _, err := tx.Stmt(d.delUserSessions).Exec(user); err != nil {
+		return fmt.Errorf("sql: could not end sessions: %v", err)
+	}
+	return d.audit(tx).record(AuditPassword, TableUsers, user, nil, nil)
+}
+
+const addLoginSessionStmt = `INSERT INTO sessions(tokenhash, user, expires) VALUES (?,?,?)`
+
+// AddLoginSession starts a login session.
+func (d *database) AddLoginSession(s *LoginSession) error {
+	_, err := execAffectingOneRow(d.addLoginSession, s.TokenHash, s.User, s.Expires.Unix())
+	return err
+}
+
+const getLoginSessionStmt = `SELECT tokenhash, user, expires FROM sessions WHERE tokenhash = ?`
+
+// GetLoginSession returns the login session with the token hash.
+func (d *database) GetLoginSession(tokenHash string) (*LoginSession, error) {
+	var (
+		s       LoginSession
+		expires int64
+	)
+	err := d.getLoginSession.QueryRow(tokenHash).Scan(&s.TokenHash, &s.User, &expires)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: login session", ErrNotFound)
+	} else if err != nil {
+		return nil, fmt.Errorf("sql: could not get login session: %v", err)
+	}
+	s.Expires = time.Unix(expires, 0)
+	return &s, nil
+}
+
+const delLoginSessionStmt = `DELETE FROM sessions WHERE tokenhash = ?`
+
+// DeleteLoginSession ends a login session.
+func (d *database) DeleteLoginSession(tokenHash string) error {
+	if _, err := d.delLoginSession.Exec(tokenHash); err != nil {
+		return fmt.Errorf("sql: could not delete login session: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,627 @@
+package syndicate
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tempDBPath returns the path of a database file in a new temporary directory.
+func tempDBPath(t testing.TB) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "syndicate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "beer.db")
+}
+
+// openTestDB opens a fresh database in a temporary directory.
+func openTestDB(t testing.TB) *database {
+	t.Helper()
+	d := &database{}
+	if err := d.Open(tempDBPath(t)); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+// addTestContribution adds a user, beer and contribution of the given quantity.
+func addTestContribution(t testing.TB, d *database, quantity int64) (user, cont int64) {
+	t.Helper()
+	user, err := d.AddUser(&User{Name: "alice"})
+	if err != nil {
+		t.Fatalf("AddUser: %v", err)
+	}
+	beer, err := d.AddBeer(&Beer{Name: "Pale Ale", Brewery: "Brewery"})
+	if err != nil {
+		t.Fatalf("AddBeer: %v", err)
+	}
+	cont, err = d.AddContribution(&Contribution{
+		User:     user,
+		Beer:     beer,
+		Quantity: quantity,
+		Date:     time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("AddContribution: %v", err)
+	}
+	return user, cont
+}
+
+func sumTwelfths(t testing.TB, d *database, cont int64) int64 {
+	t.Helper()
+	couts, err := d.ListCheckouts()
+	if err != nil {
+		t.Fatalf("ListCheckouts: %v", err)
+	}
+	var total int64
+	for _, c := range couts {
+		if c.Contribution == cont {
+			total += c.Twelfths
+		}
+	}
+	return total
+}
+
+func TestAddCheckoutsConcurrent(t *testing.T) {
+	d := openTestDB(t)
+	user, cont := addTestContribution(t, d, 2)
+
+	// Each worker tries to split half a bottle between two people, so only
+	// four of them can succeed.
+	const workers = 32
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+		rejected  int
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := d.AddCheckouts([]*Checkout{
+				{User: user, Contribution: cont, Twelfths: 3, Date: time.Now()},
+				{User: user, Contribution: cont, Twelfths: 3, Date: time.Now()},
+			})
+			mu.Lock()
+			defer mu.Unlock()
+			var stockErr *InsufficientStockError
+			switch {
+			case err == nil:
+				succeeded++
+			case errors.As(err, &stockErr):
+				rejected++
+			default:
+				t.Errorf("AddCheckouts: unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if succeeded != 4 {
+		t.Errorf("got %d successful checkouts, want 4", succeeded)
+	}
+	if rejected != workers-4 {
+		t.Errorf("got %d rejected checkouts, want %d", rejected, workers-4)
+	}
+	if got := sumTwelfths(t, d, cont); got != 24 {
+		t.Errorf("checked out %d twelfths, want 24", got)
+	}
+}
+
+func TestAddCheckoutsAtomic(t *testing.T) {
+	d := openTestDB(t)
+	user, cont := addTestContribution(t, d, 1)
+	if _, err := d.AddCheckout(&Checkout{User: user, Contribution: cont, Twelfths: 8, Date: time.Now()}); err != nil {
+		t.Fatalf("AddCheckout: %v", err)
+	}
+
+	_, err := d.AddCheckouts([]*Checkout{
+		{User: user, Contribution: cont, Twelfths: 3, Date: time.Now()},
+		{User: user, Contribution: cont, Twelfths: 3, Date: time.Now()},
+	})
+	var stockErr *InsufficientStockError
+	if !errors.As(err, &stockErr) {
+		t.Fatalf("AddCheckouts: got error %v, want *InsufficientStockError", err)
+	}
+	if stockErr.Requested != 6 || stockErr.Remaining != 4 {
+		t.Errorf("got requested=%d remaining=%d, want 6 and 4", stockErr.Requested, stockErr.Remaining)
+	}
+	if got := sumTwelfths(t, d, cont); got != 8 {
+		t.Errorf("checked out %d twelfths after rejected split, want 8", got)
+	}
+
+	if _, err := d.AddCheckouts([]*Checkout{
+		{User: user, Contribution: cont, Twelfths: 2, Date: time.Now()},
+		{User: user, Contribution: cont, Twelfths: 2, Date: time.Now()},
+	}); err != nil {
+		t.Fatalf("AddCheckouts: %v", err)
+	}
+	if got := sumTwelfths(t, d, cont); got != 12 {
+		t.Errorf("checked out %d twelfths, want 12", got)
+	}
+}
+
+func TestAddCheckoutsInvalid(t *testing.T) {
+	d := openTestDB(t)
+	user, cont := addTestContribution(t, d, 1)
+	for _, c := range []*Checkout{
+		{User: user, Contribution: cont, Twelfths: 0},
+		{User: user, Contribution: cont, Twelfths: -12},
+		{User: user, Contribution: cont + 1, Twelfths: 1},
+	} {
+		if _, err := d.AddCheckouts([]*Checkout{c}); err == nil {
+			t.Errorf("AddCheckouts(%+v): got nil error", c)
+		}
+	}
+}
+
+func TestBalances(t *testing.T) {
+	d := openTestDB(t)
+	alice, cont := addTestContribution(t, d, 2)
+	if err := d.EditContribution(&Contribution{ID: cont, Quantity: 2, UnitPrice: 499}); err != nil {
+		t.Fatalf("EditContribution: %v", err)
+	}
+	bob, err := d.AddUser(&User{Name: "bob"})
+	if err != nil {
+		t.Fatalf("AddUser: %v", err)
+	}
+	if _, err := d.AddCheckouts([]*Checkout{
+		{User: bob, Contribution: cont, Twelfths: 6, Date: time.Now()},
+		{User: alice, Contribution: cont, Twelfths: 4, Date: time.Now()},
+	}); err != nil {
+		t.Fatalf("AddCheckouts: %v", err)
+	}
+	if _, err := d.AddDebitCredit(&DebitCredit{User: bob, Amount: -150, Date: time.Now()}); err != nil {
+		t.Fatalf("AddDebitCredit: %v", err)
+	}
+
+	want := map[int64]Balance{
+		alice: {User: alice, Added: 998, Taken: 166},
+		bob:   {User: bob, Taken: 250, DebitCredit: -150},
+	}
+	bals, err := d.ListBalances()
+	if err != nil {
+		t.Fatalf("ListBalances: %v", err)
+	}
+	if len(bals) != len(want) {
+		t.Fatalf("got %d balances, want %d", len(bals), len(want))
+	}
+	for _, b := range bals {
+		if *b != want[b.User] {
+			t.Errorf("ListBalances: user %d got %+v, want %+v", b.User, *b, want[b.User])
+		}
+		got, err := d.GetBalance(b.User)
+		if err != nil {
+			t.Fatalf("GetBalance(%d): %v", b.User, err)
+		}
+		if *got != *b {
+			t.Errorf("GetBalance(%d) = %+v, want %+v", b.User, *got, *b)
+		}
+	}
+	if net := want[bob]; net.NetPosition() != -400 {
+		t.Errorf("bob's net position = %v, want -$4.00", net.NetPosition())
+	}
+
+	if got, err := d.ContributionRemaining(cont); err != nil || got != 14 {
+		t.Errorf("ContributionRemaining = %d, %v; want 14", got, err)
+	}
+	conts, err := d.ListContributions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := d.BeerRemaining(conts[0].Beer); err != nil || got != 14 {
+		t.Errorf("BeerRemaining = %d, %v; want 14", got, err)
+	}
+}
+
+// addTestHistory adds n contributions, each with a checkout and a debit, spread
+// across the given users.
+func addTestHistory(b *testing.B, d *database, users []int64, beer int64, n int) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		user := users[i%len(users)]
+		r, err := tx.Stmt(d.addContribution).Exec(user, beer, 1, time.Now().Unix(), 450, "")
+		if err != nil {
+			b.Fatal(err)
+		}
+		cont, _ := r.LastInsertId()
+		if _, err := tx.Stmt(d.addCheckout).Exec(users[(i+1)%len(users)], cont, time.Now().Unix(), 6); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := tx.Stmt(d.addDebitCredit).Exec(user, -10, time.Now().Unix(), ""); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// scanBalance computes a user's balance the way the users page did before
+// balances were aggregated in SQL, by listing and scanning every contribution,
+// checkout and debit/credit. It is kept to benchmark against.
+func scanBalance(d *database, u *User) (*Balance, error) {
+	b := &Balance{User: u.ID, SeedFund: u.SeedFund}
+	conts, err := d.ListContributions()
+	if err != nil {
+		return nil, err
+	}
+	byID := map[int64]*Contribution{}
+	for _, c := range conts {
+		byID[c.ID] = c
+		if c.User == u.ID {
+			b.Added += c.UnitPrice * Money(c.Quantity)
+		}
+	}
+	takes, err := d.ListCheckouts()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range takes {
+		if t.User == u.ID {
+			b.Taken += byID[t.Contribution].UnitPrice.Twelfths(t.Twelfths)
+		}
+	}
+	dcs, err := d.ListDebitCredits()
+	if err != nil {
+		return nil, err
+	}
+	for _, dc := range dcs {
+		if dc.User == u.ID {
+			b.DebitCredit += dc.Amount
+		}
+	}
+	return b, nil
+}
+
+// BenchmarkUsersPage measures the database work behind the users page, which
+// fetches every user and their balances. The "scan" path is how the page used
+// to work, listing the whole history once per user and column, so it grows
+// with users times history. The "aggregate" path makes two queries however
+// many users and columns it shows, so only the aggregation within SQLite
+// grows with the history of contributions, checkouts and debits/credits.
+func BenchmarkUsersPage(b *testing.B) {
+	for _, history := range []int{100, 1000, 10000} {
+		d := openTestDB(b)
+		var users []int64
+		for i := 0; i < 20; i++ {
+			u, err := d.AddUser(&User{Name: fmt.Sprintf("user%d", i)})
+			if err != nil {
+				b.Fatal(err)
+			}
+			users = append(users, u)
+		}
+		beer, err := d.AddBeer(&Beer{Name: "Pale Ale"})
+		if err != nil {
+			b.Fatal(err)
+		}
+		addTestHistory(b, d, users, beer, history)
+
+		b.Run(fmt.Sprintf("path=scan/history=%d", history), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				us, err := d.ListUsers()
+				if err != nil {
+					b.Fatal(err)
+				}
+				for _, u := range us {
+					// The page showed debits/credits, added, taken and the
+					// net position, each computed separately.
+					for col := 0; col < 4; col++ {
+						if _, err := scanBalance(d, u); err != nil {
+							b.Fatal(err)
+						}
+					}
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("path=aggregate/history=%d", history), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := d.ListUsers(); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := d.ListBalances(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestGetNotFound(t *testing.T) {
+	d := openTestDB(t)
+	user, cont := addTestContribution(t, d, 1)
+	coid, err := d.AddCheckout(&Checkout{User: user, Contribution: cont, Twelfths: 12, Date: time.Now()})
+	if err != nil {
+		t.Fatalf("AddCheckout: %v", err)
+	}
+
+	if u, err := d.GetUser(user); err != nil || u.Name != "alice" {
+		t.Errorf("GetUser(%d) = %+v, %v; want alice", user, u, err)
+	}
+	c, err := d.GetContribution(cont)
+	if err != nil || c.Quantity != 1 {
+		t.Errorf("GetContribution(%d) = %+v, %v; want quantity 1", cont, c, err)
+	}
+	if b, err := d.GetBeer(c.Beer); err != nil || b.Name != "Pale Ale" {
+		t.Errorf("GetBeer(%d) = %+v, %v; want Pale Ale", c.Beer, b, err)
+	}
+	if co, err := d.GetCheckout(coid); err != nil || co.Twelfths != 12 || co.Contribution != cont {
+		t.Errorf("GetCheckout(%d) = %+v, %v; want 12 twelfths of %d", coid, co, err, cont)
+	}
+
+	for name, get := range map[string]func(int64) error{
+		"GetUser":         func(id int64) error { _, err := d.GetUser(id); return err },
+		"GetBeer":         func(id int64) error { _, err := d.GetBeer(id); return err },
+		"GetContribution": func(id int64) error { _, err := d.GetContribution(id); return err },
+		"GetCheckout":     func(id int64) error { _, err := d.GetCheckout(id); return err },
+		"GetBalance":      func(id int64) error { _, err := d.GetBalance(id); return err },
+	} {
+		if err := get(1000); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s(1000): got error %v, want ErrNotFound", name, err)
+		}
+	}
+}
+
+func TestEditCheckout(t *testing.T) {
+	d := openTestDB(t)
+	user, cont := addTestContribution(t, d, 1)
+	ids, err := d.AddCheckouts([]*Checkout{
+		{User: user, Contribution: cont, Twelfths: 4, Date: time.Now()},
+		{User: user, Contribution: cont, Twelfths: 4, Date: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("AddCheckouts: %v", err)
+	}
+	if err := d.EditCheckout(&Checkout{ID: ids[0], User: user, Twelfths: 8}); err != nil {
+		t.Errorf("EditCheckout to take the remainder: %v", err)
+	}
+	var stockErr *InsufficientStockError
+	if err := d.EditCheckout(&Checkout{ID: ids[1], User: user, Twelfths: 5}); !errors.As(err, &stockErr) {
+		t.Errorf("EditCheckout over-draw: got error %v, want *InsufficientStockError", err)
+	}
+	if got := sumTwelfths(t, d, cont); got != 12 {
+		t.Errorf("checked out %d twelfths, want 12", got)
+	}
+	if err := d.EditCheckout(&Checkout{ID: 1000, User: user, Twelfths: 1}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("EditCheckout(1000): got error %v, want ErrNotFound", err)
+	}
+}
+
+func TestEditUser(t *testing.T) {
+	d := openTestDB(t)
+	id, err := d.AddUser(&User{Name: "bob", UntappdID: "bobby", SeedFund: 1050})
+	if err != nil {
+		t.Fatalf("AddUser: %v", err)
+	}
+	u, err := d.GetUser(id)
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if u.SeedFund != 1050 || u.Retired {
+		t.Errorf("new user = %+v, want seed fund $10.50 and not retired", u)
+	}
+
+	u.Name, u.UntappdID, u.SeedFund, u.Retired = "robert", "rob", -200, true
+	if err := d.EditUser(u); err != nil {
+		t.Fatalf("EditUser: %v", err)
+	}
+	got, err := d.GetUser(id)
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if *got != *u {
+		t.Errorf("edited user = %+v, want %+v", got, u)
+	}
+	b, err := d.GetBalance(id)
+	if err != nil {
+		t.Fatalf("GetBalance: %v", err)
+	}
+	if b.NetPosition() != -200 {
+		t.Errorf("retired user net position = %v, want -$2.00", b.NetPosition())
+	}
+
+	if err := d.EditUser(&User{ID: 1000, Name: "nobody"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("EditUser(1000): got error %v, want ErrNotFound", err)
+	}
+}
+
+func TestDeleteAndMergeBeers(t *testing.T) {
+	d := openTestDB(t)
+	_, cont := addTestContribution(t, d, 2)
+	c, err := d.GetContribution(cont)
+	if err != nil {
+		t.Fatalf("GetContribution: %v", err)
+	}
+	dup := c.Beer
+	canonical, err := d.AddBeer(&Beer{Name: "Pale Ale", Brewery: "Brewery", UntappdID: 42})
+	if err != nil {
+		t.Fatalf("AddBeer: %v", err)
+	}
+
+	if err := d.DeleteBeer(dup); !errors.Is(err, ErrInUse) {
+		t.Errorf("DeleteBeer(%d) with contributions: got error %v, want ErrInUse", dup, err)
+	}
+	if err := d.MergeBeers(dup, dup); err == nil {
+		t.Errorf("MergeBeers(%d, %d) succeeded, want error", dup, dup)
+	}
+	if err := d.MergeBeers(dup, 1000); !errors.Is(err, ErrNotFound) {
+		t.Errorf("MergeBeers(%d, 1000): got error %v, want ErrNotFound", dup, err)
+	}
+	if c, err := d.GetContribution(cont); err != nil || c.Beer != dup {
+		t.Fatalf("after failed merge, contribution = %+v, %v; want beer %d", c, err, dup)
+	}
+
+	if err := d.MergeBeers(dup, canonical); err != nil {
+		t.Fatalf("MergeBeers: %v", err)
+	}
+	if c, err := d.GetContribution(cont); err != nil || c.Beer != canonical {
+		t.Errorf("after merge, contribution = %+v, %v; want beer %d", c, err, canonical)
+	}
+	if _, err := d.GetBeer(dup); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetBeer(%d) after merge: got error %v, want ErrNotFound", dup, err)
+	}
+	if n, err := d.BeerRemaining(canonical); err != nil || n != 24 {
+		t.Errorf("BeerRemaining(%d) = %d, %v; want 24", canonical, n, err)
+	}
+
+	b, err := d.GetBeer(canonical)
+	if err != nil {
+		t.Fatalf("GetBeer: %v", err)
+	}
+	b.Name, b.UntappdRating = "Pale", 3.75
+	if err := d.EditBeer(b); err != nil {
+		t.Fatalf("EditBeer: %v", err)
+	}
+	if got, err := d.GetBeer(canonical); err != nil || *got != *b {
+		t.Errorf("edited beer = %+v, %v; want %+v", got, err, b)
+	}
+
+	if err := d.DeleteContribution(cont); err != nil {
+		t.Fatalf("DeleteContribution: %v", err)
+	}
+	// A contribution in the trash still refers to the beer.
+	if err := d.DeleteBeer(canonical); !errors.Is(err, ErrInUse) {
+		t.Errorf("DeleteBeer(%d) with a deleted contribution: got error %v, want ErrInUse", canonical, err)
+	}
+	if err := d.PurgeContribution(cont); err != nil {
+		t.Fatalf("PurgeContribution: %v", err)
+	}
+	if err := d.DeleteBeer(canonical); err != nil {
+		t.Errorf("DeleteBeer(%d): %v", canonical, err)
+	}
+	if err := d.DeleteBeer(canonical); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteBeer(%d) twice: got error %v, want ErrNotFound", canonical, err)
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	d := openTestDB(t)
+	alice, cont := addTestContribution(t, d, 1)
+	couts, err := d.AddCheckouts([]*Checkout{
+		{User: alice, Contribution: cont, Twelfths: 4, Date: time.Now()},
+		{User: alice, Contribution: cont, Twelfths: 2, Date: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("AddCheckouts: %v", err)
+	}
+	dc, err := d.AddDebitCredit(&DebitCredit{User: alice, Amount: 100, Date: time.Now()})
+	if err != nil {
+		t.Fatalf("AddDebitCredit: %v", err)
+	}
+
+	// Deleting a checkout on its own leaves it out of the contribution's
+	// cascade.
+	if err := d.DeleteCheckout(couts[1]); err != nil {
+		t.Fatalf("DeleteCheckout: %v", err)
+	}
+	if err := d.DeleteContribution(cont); err != nil {
+		t.Fatalf("DeleteContribution: %v", err)
+	}
+	if err := d.DeleteDebitCredit(dc); err != nil {
+		t.Fatalf("DeleteDebitCredit: %v", err)
+	}
+	if _, err := d.GetCheckout(couts[0]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetCheckout of cascaded checkout: got error %v, want ErrNotFound", err)
+	}
+	if b, err := d.GetBalance(alice); err != nil || b.Added != 0 || b.Taken != 0 || b.DebitCredit != 0 {
+		t.Errorf("GetBalance after delete = %+v, %v; want zero", b, err)
+	}
+	for name, fn := range map[string]func() (int, error){
+		"ListContributions": func() (int, error) { l, err := d.ListContributions(); return len(l), err },
+		"ListCheckouts":     func() (int, error) { l, err := d.ListCheckouts(); return len(l), err },
+		"ListDebitCredits":  func() (int, error) { l, err := d.ListDebitCredits(); return len(l), err },
+	} {
+		if n, err := fn(); err != nil || n != 0 {
+			t.Errorf("%s after delete = %d, %v; want 0", name, n, err)
+		}
+	}
+	if deleted, err := d.ListDeletedCheckouts(); err != nil || len(deleted) != 2 {
+		t.Errorf("ListDeletedCheckouts = %d, %v; want 2", len(deleted), err)
+	}
+
+	// Restoring the contribution brings back only the checkout deleted
+	// with it.
+	if err := d.UndeleteContribution(cont); err != nil {
+		t.Fatalf("UndeleteContribution: %v", err)
+	}
+	if got := sumTwelfths(t, d, cont); got != 4 {
+		t.Errorf("checked out after undelete = %d twelfths, want 4", got)
+	}
+	if err := d.UndeleteContribution(cont); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UndeleteContribution twice: got error %v, want ErrNotFound", err)
+	}
+	if err := d.UndeleteDebitCredit(dc); err != nil {
+		t.Fatalf("UndeleteDebitCredit: %v", err)
+	}
+	if b, err := d.GetBalance(alice); err != nil || b.DebitCredit != 100 {
+		t.Errorf("GetBalance after undelete = %+v, %v; want debit/credit 100", b, err)
+	}
+
+	if err := d.PurgeCheckout(couts[1]); err != nil {
+		t.Fatalf("PurgeCheckout: %v", err)
+	}
+	if err := d.UndeleteCheckout(couts[1]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UndeleteCheckout of purged checkout: got error %v, want ErrNotFound", err)
+	}
+	if err := d.PurgeCheckout(couts[0]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("PurgeCheckout of live checkout: got error %v, want ErrNotFound", err)
+	}
+}
+
+func TestClaimSubscriptions(t *testing.T) {
+	d := openTestDB(t)
+	alice, err := d.AddUser(&User{Name: "alice"})
+	if err != nil {
+		t.Fatalf("AddUser: %v", err)
+	}
+	for _, sub := range []*Subscription{
+		{Endpoint: "https://push/1", Cookie: "phone"},
+		{Endpoint: "https://push/2", Cookie: "phone"},
+		{Endpoint: "https://push/3", Cookie: "laptop"},
+	} {
+		if _, err := d.AddSubscription(sub); err != nil {
+			t.Fatalf("AddSubscription: %v", err)
+		}
+	}
+	claimed := func() map[string]int64 {
+		t.Helper()
+		subs, err := d.ListSubscriptions()
+		if err != nil {
+			t.Fatalf("ListSubscriptions: %v", err)
+		}
+		m := map[string]int64{}
+		for _, s := range subs {
+			m[s.Endpoint] = s.User
+		}
+		return m
+	}
+
+	if n, err := d.ClaimSubscriptions("phone", alice); err != nil || n != 2 {
+		t.Fatalf("ClaimSubscriptions = %d, %v; want 2", n, err)
+	}
+	if got := claimed(); got["https://push/1"] != alice || got["https://push/2"] != alice || got["https://push/3"] != 0 {
+		t.Errorf("after claim, subscription users = %v", got)
+	}
+	if _, err := d.ClaimSubscriptions("laptop", 99); err == nil {
+		t.Errorf("ClaimSubscriptions for a missing user succeeded")
+	}
+	if _, err := d.ClaimSubscriptions("phone", 0); err != nil {
+		t.Fatalf("ClaimSubscriptions to unclaim: %v", err)
+	}
+	if got := claimed(); got["https://push/1"] != 0 || got["https://push/2"] != 0 {
+		t.Errorf("after unclaim, subscription users = %v", got)
+	}
+}
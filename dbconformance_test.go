@@ -0,0 +1,899 @@
+package syndicate
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// dbBackend opens an empty BeerDatabase of one implementation for a test.
+type dbBackend struct {
+	name string
+	open func(t testing.TB) BeerDatabase
+}
+
+// dbBackends are the BeerDatabase implementations held to the conformance
+// tests below.
+var dbBackends = []dbBackend{
+	{"sqlite", func(t testing.TB) BeerDatabase { return openTestDB(t) }},
+	{"memory", func(testing.TB) BeerDatabase { return NewMemoryDatabase() }},
+	{"postgres", func(t testing.TB) BeerDatabase { return openTestPostgres(t) }},
+}
+
+// reusesIDs returns true if the database gives a new user, beer or
+// contribution the id after the highest in use, as SQLite does, so that the
+// id of the newest one is given out again once it is deleted. PostgreSQL's
+// identity columns never give out an id twice.
+func reusesIDs(d BeerDatabase) bool {
+	_, pg := d.(*pgDatabase)
+	return !pg
+}
+
+// forEachBackend runs a test against an empty database of every backend.
+func forEachBackend(t *testing.T, test func(t *testing.T, d BeerDatabase)) {
+	for _, b := range dbBackends {
+		b := b
+		t.Run(b.name, func(t *testing.T) { test(t, b.open(t)) })
+	}
+}
+
+// errOther stands for an error that is none of ErrNotFound, ErrExists or
+// ErrInUse, such as a broken constraint.
+var errOther = errors.New("other error")
+
+// wantErr reports unless err is the target error.
+func wantErr(t *testing.T, call string, err, target error) {
+	t.Helper()
+	switch {
+	case err == nil:
+		t.Errorf("%s succeeded, want %v", call, target)
+	case target == errOther:
+		for _, e := range []error{ErrNotFound, ErrExists, ErrInUse} {
+			if errors.Is(err, e) {
+				t.Errorf("%s = %v, want %v", call, err, target)
+			}
+		}
+	case !errors.Is(err, target):
+		t.Errorf("%s = %v, want %v", call, err, target)
+	}
+}
+
+// must fails the test if err is not nil.
+func must(t *testing.T, call string, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %v", call, err)
+	}
+}
+
+// wantStockErr reports unless err is the *InsufficientStockError want.
+func wantStockErr(t *testing.T, call string, err error, want InsufficientStockError) {
+	t.Helper()
+	var stockErr *InsufficientStockError
+	if !errors.As(err, &stockErr) || *stockErr != want {
+		t.Errorf("%s = %v, want %v", call, err, &want)
+	}
+}
+
+// recordIDs returns the ID fields of a slice of records.
+func recordIDs(records interface{}) []int64 {
+	v := reflect.ValueOf(records)
+	ids := make([]int64, v.Len())
+	for i := range ids {
+		ids[i] = v.Index(i).Elem().FieldByName("ID").Int()
+	}
+	return ids
+}
+
+// wantIDs reports unless the records have the ids, in order.
+func wantIDs(t *testing.T, call string, records interface{}, err error, want ...int64) {
+	t.Helper()
+	if err != nil {
+		t.Errorf("%s: %v", call, err)
+		return
+	}
+	if got := recordIDs(records); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("%s ids = %v, want %v", call, got, want)
+	}
+}
+
+// conformanceDay is the date of the records added by the conformance tests.
+var conformanceDay = time.Date(2021, 3, 14, 18, 30, 0, 0, time.Local)
+
+func TestConformanceUsers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, d BeerDatabase) {
+		for i, name := range []string{"carol", "alice", "bob"} {
+			id, err := d.AddUser(&User{Name: name, SeedFund: 500})
+			if err != nil || id != int64(i+1) {
+				t.Fatalf("AddUser(%s) = %d, %v; want %d", name, id, err, i+1)
+			}
+		}
+		users, err := d.ListUsers()
+		wantIDs(t, "ListUsers", users, err, 2, 3, 1)
+
+		want := &User{ID: 1, Name: "carol", UntappdID: "carol_u", SeedFund: 700, Retired: true}
+		must(t, "EditUser", d.EditUser(want))
+		if u, err := d.GetUser(1); err != nil || *u != *want {
+			t.Errorf("GetUser after edit = %+v, %v; want %+v", u, err, want)
+		}
+		_, err = d.GetUser(4)
+		wantErr(t, "GetUser of unknown user", err, ErrNotFound)
+		wantErr(t, "EditUser of unknown user", d.EditUser(&User{ID: 4}), ErrNotFound)
+
+		// Restored users keep their id, and the next is numbered after them.
+		wantErr(t, "RestoreUser of existing user", d.RestoreUser(&User{ID: 2}), ErrExists)
+		must(t, "RestoreUser", d.RestoreUser(&User{ID: 7, Name: "dave", Retired: true}))
+		if u, err := d.GetUser(7); err != nil || u.Name != "dave" || !u.Retired {
+			t.Errorf("GetUser of restored user = %+v, %v", u, err)
+		}
+		if id, err := d.AddUser(&User{Name: "erin"}); err != nil || id != 8 {
+			t.Errorf("AddUser after restore = %d, %v; want 8", id, err)
+		}
+	})
+}
+
+func TestConformanceLogin(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, d BeerDatabase) {
+		user, err := d.AddUser(&User{Name: "alice"})
+		must(t, "AddUser", err)
+		if hash, err := d.GetPasswordHash(user); err != nil || hash != "" {
+			t.Errorf("GetPasswordHash of new user = %q, %v", hash, err)
+		}
+		must(t, "SetPasswordHash", d.SetPasswordHash(user, "hash"))
+		if u, err := d.GetUser(user); err != nil || !u.HasPassword {
+			t.Errorf("GetUser after SetPasswordHash = %+v, %v; want HasPassword", u, err)
+		}
+		_, err = d.GetPasswordHash(99)
+		wantErr(t, "GetPasswordHash of unknown user", err, ErrNotFound)
+		wantErr(t, "SetPasswordHash of unknown user", d.SetPasswordHash(99, "hash"), ErrNotFound)
+
+		expires := conformanceDay.Add(time.Hour + time.Millisecond)
+		must(t, "AddLoginSession", d.AddLoginSession(&LoginSession{TokenHash: "token", User: user, Expires: expires}))
+		wantErr(t, "AddLoginSession of existing token", d.AddLoginSession(&LoginSession{TokenHash: "token", User: user}), errOther)
+		wantErr(t, "AddLoginSession of unknown user", d.AddLoginSession(&LoginSession{TokenHash: "other", User: 99}), errOther)
+		if s, err := d.GetLoginSession("token"); err != nil || s.User != user || !s.Expires.Equal(expires.Truncate(time.Second)) {
+			t.Errorf("GetLoginSession = %+v, %v", s, err)
+		}
+
+		// Changing the password ends the user's sessions.
+		must(t, "SetPasswordHash", d.SetPasswordHash(user, ""))
+		_, err = d.GetLoginSession("token")
+		wantErr(t, "GetLoginSession after password change", err, ErrNotFound)
+		if u, err := d.GetUser(user); err != nil || u.HasPassword {
+			t.Errorf("GetUser after clearing password = %+v, %v; want no password", u, err)
+		}
+		must(t, "DeleteLoginSession of unknown token", d.DeleteLoginSession("token"))
+
+		// Editing a user can set their password in the same change.
+		must(t, "AddLoginSession", d.AddLoginSession(&LoginSession{TokenHash: "token", User: user, Expires: expires}))
+		must(t, "EditUserPasswordHash", d.EditUserPasswordHash(&User{ID: user, Name: "alicia"}, "hash"))
+		if u, err := d.GetUser(user); err != nil || u.Name != "alicia" || !u.HasPassword {
+			t.Errorf("GetUser after EditUserPasswordHash = %+v, %v; want alicia with a password", u, err)
+		}
+		_, err = d.GetLoginSession("token")
+		wantErr(t, "GetLoginSession after EditUserPasswordHash", err, ErrNotFound)
+		wantErr(t, "EditUserPasswordHash of unknown user", d.EditUserPasswordHash(&User{ID: 99, Name: "nobody"}, "hash"), ErrNotFound)
+	})
+}
+
+func TestConformanceBeers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, d BeerDatabase) {
+		for i := 1; i <= 3; i++ {
+			id, err := d.AddBeer(&Beer{Name: fmt.Sprintf("Beer %d", i), UntappdID: int64(100 + i), UntappdRating: 3.5})
+			if err != nil || id != int64(i) {
+				t.Fatalf("AddBeer = %d, %v; want %d", id, err, i)
+			}
+		}
+		beers, err := d.ListBeers()
+		wantIDs(t, "ListBeers", beers, err, 3, 2, 1)
+
+		want := &Beer{ID: 2, Brewery: "Brewery", Name: "Pale", UntappdID: 202, UntappdRating: 3.75, BreweryID: 9, LabelURL: "label"}
+		must(t, "EditBeer", d.EditBeer(want))
+		if b, err := d.GetBeer(2); err != nil || *b != *want {
+			t.Errorf("GetBeer after edit = %+v, %v; want %+v", b, err, want)
+		}
+		_, err = d.GetBeer(4)
+		wantErr(t, "GetBeer of unknown beer", err, ErrNotFound)
+		wantErr(t, "EditBeer of unknown beer", d.EditBeer(&Beer{ID: 4}), ErrNotFound)
+
+		// Refreshing keeps the Untappd ID, and records ratings as they change.
+		for _, rating := range []float64{3.75, 3.75, 4} {
+			must(t, "RefreshBeer", d.RefreshBeer(&Beer{ID: 2, Name: "Pale Ale", UntappdID: 999, UntappdRating: rating}))
+		}
+		b, err := d.GetBeer(2)
+		if err != nil || b.Name != "Pale Ale" || b.UntappdID != 202 || b.UntappdRating != 4 || b.Refreshed.IsZero() || b.Refreshed.Nanosecond() != 0 {
+			t.Errorf("GetBeer after refresh = %+v, %v", b, err)
+		}
+		ratings, err := d.ListRatings(2)
+		if err != nil || len(ratings) != 2 || ratings[0].Rating != 3.75 || ratings[1].Rating != 4 {
+			t.Errorf("ListRatings = %v, %v; want 3.75 then 4", ratings, err)
+		}
+		wantErr(t, "RefreshBeer of unknown beer", d.RefreshBeer(&Beer{ID: 4}), ErrNotFound)
+
+		// Deleting the newest beer frees its id, where ids are reused.
+		must(t, "DeleteBeer", d.DeleteBeer(3))
+		wantErr(t, "DeleteBeer of unknown beer", d.DeleteBeer(3), ErrNotFound)
+		wantID := int64(4)
+		if reusesIDs(d) {
+			wantID = 3
+		}
+		id, err := d.AddBeer(&Beer{Name: "Beer 4"})
+		if err != nil || id != wantID {
+			t.Errorf("AddBeer after delete = %d, %v; want %d", id, err, wantID)
+		}
+		wantErr(t, "RestoreBeer of existing beer", d.RestoreBeer(&Beer{ID: id}), ErrExists)
+		must(t, "RestoreBeer", d.RestoreBeer(&Beer{ID: 10, Name: "Lost", UntappdRating: 2.5}))
+		if b, err := d.GetBeer(10); err != nil || b.Name != "Lost" || b.UntappdRating != 2.5 {
+			t.Errorf("GetBeer of restored beer = %+v, %v", b, err)
+		}
+		// The next beer is numbered after the restored one.
+		if id, err := d.AddBeer(&Beer{Name: "Beer 5"}); err != nil || id != 11 {
+			t.Errorf("AddBeer after restore = %d, %v; want 11", id, err)
+		}
+	})
+}
+
+func TestConformanceDeleteAndMergeBeers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, d BeerDatabase) {
+		user, err := d.AddUser(&User{Name: "alice"})
+		must(t, "AddUser", err)
+		var beers []int64
+		for i := 0; i < 3; i++ {
+			id, err := d.AddBeer(&Beer{Name: "Pale Ale", UntappdRating: 3.5})
+			must(t, "AddBeer", err)
+			must(t, "RefreshBeer", d.RefreshBeer(&Beer{ID: id, UntappdRating: 3.5}))
+			beers = append(beers, id)
+		}
+		cont, err := d.AddContribution(&Contribution{User: user, Beer: beers[0], Quantity: 1, Date: conformanceDay})
+		must(t, "AddContribution", err)
+		sg, err := d.AddSuggestion(&Suggestion{User: user, Checkin: 1, Beer: beers[0], Date: conformanceDay})
+		must(t, "AddSuggestion", err)
+		_, err = d.AddSuggestion(&Suggestion{User: user, Checkin: 2, Beer: beers[2], Date: conformanceDay})
+		must(t, "AddSuggestion", err)
+
+		// Beers of contributions cannot be deleted, even from the trash.
+		must(t, "DeleteContribution", d.DeleteContribution(cont))
+		wantErr(t, "DeleteBeer of contributed beer", d.DeleteBeer(beers[0]), ErrInUse)
+
+		wantErr(t, "MergeBeers into itself", d.MergeBeers(beers[0], beers[0]), errOther)
+		wantErr(t, "MergeBeers of unknown beer", d.MergeBeers(99, beers[1]), ErrNotFound)
+		wantErr(t, "MergeBeers into unknown beer", d.MergeBeers(beers[0], 99), ErrNotFound)
+		must(t, "MergeBeers", d.MergeBeers(beers[0], beers[1]))
+		_, err = d.GetBeer(beers[0])
+		wantErr(t, "GetBeer of merged beer", err, ErrNotFound)
+		if r, err := d.ListRatings(beers[0]); err != nil || len(r) != 0 {
+			t.Errorf("ListRatings of merged beer = %v, %v; want none", r, err)
+		}
+		must(t, "UndeleteContribution", d.UndeleteContribution(cont))
+		if c, err := d.GetContribution(cont); err != nil || c.Beer != beers[1] {
+			t.Errorf("GetContribution after merge = %+v, %v; want beer %d", c, err, beers[1])
+		}
+		if s, err := d.GetSuggestion(sg); err != nil || s.Beer != beers[1] {
+			t.Errorf("GetSuggestion after merge = %+v, %v; want beer %d", s, err, beers[1])
+		}
+
+		// Deleting a beer takes its ratings and suggestions with it.
+		must(t, "DeleteBeer", d.DeleteBeer(beers[2]))
+		if r, err := d.ListRatings(beers[2]); err != nil || len(r) != 0 {
+			t.Errorf("ListRatings of deleted beer = %v, %v; want none", r, err)
+		}
+		sgs, err := d.ListSuggestions(0, SuggestionPending)
+		wantIDs(t, "ListSuggestions after DeleteBeer", sgs, err, sg)
+	})
+}
+
+// addConformanceStock adds two users and a beer, with a contribution of
+// it by the first user of the given quantity.
+func addConformanceStock(t *testing.T, d BeerDatabase, quantity int64) (alice, bob, beer, cont int64) {
+	t.Helper()
+	alice, err := d.AddUser(&User{Name: "alice"})
+	must(t, "AddUser", err)
+	bob, err = d.AddUser(&User{Name: "bob"})
+	must(t, "AddUser", err)
+	beer, err = d.AddBeer(&Beer{Name: "Pale Ale"})
+	must(t, "AddBeer", err)
+	cont, err = d.AddContribution(&Contribution{User: alice, Beer: beer, Quantity: quantity, UnitPrice: 1000, Date: conformanceDay})
+	must(t, "AddContribution", err)
+	return alice, bob, beer, cont
+}
+
+func TestConformanceContributions(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, d BeerDatabase) {
+		alice, bob, beer, first := addConformanceStock(t, d, 1)
+		// Contributions are listed by date, then as added.
+		var conts []int64
+		for _, days := range []int{-1, 1, 0} {
+			id, err := d.AddContribution(&Contribution{User: bob, Beer: beer, Quantity: 2, UnitPrice: 500, Date: conformanceDay.AddDate(0, 0, days)})
+			must(t, "AddContribution", err)
+			conts = append(conts, id)
+		}
+		if conts[0] != first+1 || conts[2] != first+3 {
+			t.Errorf("AddContribution ids = %v, want %d to %d", conts, first+1, first+3)
+		}
+		list, err := d.ListContributions()
+		wantIDs(t, "ListContributions", list, err, conts[0], first, conts[2], conts[1])
+
+		want := &Contribution{ID: first, User: alice, Beer: beer, Quantity: 3, UnitPrice: 1200, Comment: "dozen", Date: conformanceDay}
+		must(t, "EditContribution", d.EditContribution(&Contribution{ID: first, User: bob, Quantity: 3, UnitPrice: 1200, Comment: "dozen"}))
+		if c, err := d.GetContribution(first); err != nil || *c != *want {
+			t.Errorf("GetContribution after edit = %+v, %v; want %+v", c, err, want)
+		}
+		wantErr(t, "EditContribution of unknown contribution", d.EditContribution(&Contribution{ID: 99}), ErrNotFound)
+		_, err = d.AddContribution(&Contribution{User: 99, Beer: beer, Quantity: 1})
+		wantErr(t, "AddContribution of unknown user", err, errOther)
+		_, err = d.AddContribution(&Contribution{User: alice, Beer: 99, Quantity: 1})
+		wantErr(t, "AddContribution of unknown beer", err, errOther)
+
+		// Trashed contributions are hidden, and their ids are not reused
+		// until purged, where ids are reused at all.
+		must(t, "DeleteContribution", d.DeleteContribution(conts[1]))
+		must(t, "DeleteContribution", d.DeleteContribution(conts[2]))
+		wantErr(t, "DeleteContribution again", d.DeleteContribution(conts[2]), ErrNotFound)
+		_, err = d.GetContribution(conts[2])
+		wantErr(t, "GetContribution in trash", err, ErrNotFound)
+		wantErr(t, "EditContribution in trash", d.EditContribution(&Contribution{ID: conts[2]}), ErrNotFound)
+		list, err = d.ListContributions()
+		wantIDs(t, "ListContributions after delete", list, err, conts[0], first)
+		list, err = d.ListDeletedContributions()
+		wantIDs(t, "ListDeletedContributions", list, err, conts[2], conts[1])
+		if len(list) > 0 && list[0].DeletedAt.IsZero() {
+			t.Errorf("ListDeletedContributions = %+v, want when deleted", list[0])
+		}
+		wantErr(t, "UndeleteContribution not in trash", d.UndeleteContribution(first), ErrNotFound)
+		wantErr(t, "PurgeContribution not in trash", d.PurgeContribution(first), ErrNotFound)
+		must(t, "UndeleteContribution", d.UndeleteContribution(conts[1]))
+		must(t, "PurgeContribution", d.PurgeContribution(conts[2]))
+		wantID := conts[2]
+		if !reusesIDs(d) {
+			wantID++
+		}
+		if id, err := d.AddContribution(&Contribution{User: bob, Beer: beer, Quantity: 1, Date: conformanceDay}); err != nil || id != wantID {
+			t.Errorf("AddContribution after purge = %d, %v; want %d", id, err, wantID)
+		}
+	})
+}
+
+func TestConformanceCheckouts(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, d BeerDatabase) {
+		alice, bob, beer, cont := addConformanceStock(t, d, 1)
+		ids, err := d.AddCheckouts([]*Checkout{
+			{User: bob, Contribution: cont, Twelfths: 3, Date: conformanceDay.Add(time.Hour)},
+			{User: alice, Contribution: cont, Twelfths: 3, Date: conformanceDay},
+		})
+		if err != nil || fmt.Sprint(ids) != "[1 2]" {
+			t.Fatalf("AddCheckouts = %v, %v; want [1 2]", ids, err)
+		}
+		couts, err := d.ListCheckouts()
+		wantIDs(t, "ListCheckouts", couts, err, 2, 1)
+		want := &Checkout{ID: 1, User: bob, Contribution: cont, Twelfths: 3, Date: conformanceDay.Add(time.Hour)}
+		if c, err := d.GetCheckout(1); err != nil || *c != *want {
+			t.Errorf("GetCheckout = %+v, %v; want %+v", c, err, want)
+		}
+		if r, err := d.ContributionRemaining(cont); err != nil || r != 6 {
+			t.Errorf("ContributionRemaining = %d, %v; want 6", r, err)
+		}
+
+		// A contribution cannot be cut below what has been checked out.
+		err = d.EditContribution(&Contribution{ID: cont, Quantity: 0, UnitPrice: 500})
+		wantStockErr(t, "EditContribution below checkouts", err, InsufficientStockError{Contribution: cont, Requested: 6, Remaining: 0})
+		if r, err := d.ContributionRemaining(cont); err != nil || r != 6 {
+			t.Errorf("ContributionRemaining after failed edit = %d, %v; want 6", r, err)
+		}
+
+		// Checkouts are all added or none are.
+		_, err = d.AddCheckouts([]*Checkout{
+			{User: bob, Contribution: cont, Twelfths: 4},
+			{User: alice, Contribution: cont, Twelfths: 4},
+		})
+		wantStockErr(t, "AddCheckouts of too much", err, InsufficientStockError{Contribution: cont, Requested: 8, Remaining: 6})
+		_, err = d.AddCheckouts([]*Checkout{{User: bob, Contribution: cont, Twelfths: 1}, {User: bob, Contribution: cont}})
+		wantErr(t, "AddCheckouts of nothing", err, errOther)
+		_, err = d.AddCheckout(&Checkout{User: 99, Contribution: cont, Twelfths: 1})
+		wantErr(t, "AddCheckout by unknown user", err, ErrNotFound)
+		_, err = d.AddCheckout(&Checkout{User: bob, Contribution: 99, Twelfths: 1})
+		wantErr(t, "AddCheckout of unknown contribution", err, ErrNotFound)
+		if r, err := d.BeerRemaining(beer); err != nil || r != 6 {
+			t.Errorf("BeerRemaining after failed checkouts = %d, %v; want 6", r, err)
+		}
+		if r, err := d.BeerRemaining(99); err != nil || r != 0 {
+			t.Errorf("BeerRemaining of unknown beer = %d, %v; want 0", r, err)
+		}
+		_, err = d.ContributionRemaining(99)
+		wantErr(t, "ContributionRemaining of unknown contribution", err, ErrNotFound)
+
+		must(t, "EditCheckout", d.EditCheckout(&Checkout{ID: 1, User: alice, Twelfths: 9}))
+		if c, err := d.GetCheckout(1); err != nil || c.User != alice || c.Twelfths != 9 || !c.Date.Equal(want.Date) {
+			t.Errorf("GetCheckout after edit = %+v, %v", c, err)
+		}
+		err = d.EditCheckout(&Checkout{ID: 1, User: alice, Twelfths: 10})
+		wantStockErr(t, "EditCheckout of too much", err, InsufficientStockError{Contribution: cont, Requested: 10, Remaining: 9})
+		wantErr(t, "EditCheckout of nothing", d.EditCheckout(&Checkout{ID: 1, User: alice}), errOther)
+		wantErr(t, "EditCheckout of unknown checkout", d.EditCheckout(&Checkout{ID: 99, Twelfths: 1}), ErrNotFound)
+		wantErr(t, "EditCheckout to unknown user", d.EditCheckout(&Checkout{ID: 1, User: 99, Twelfths: 1}), errOther)
+
+		// Checkout ids are never reused.
+		must(t, "DeleteCheckout", d.DeleteCheckout(2))
+		wantErr(t, "DeleteCheckout again", d.DeleteCheckout(2), ErrNotFound)
+		_, err = d.GetCheckout(2)
+		wantErr(t, "GetCheckout in trash", err, ErrNotFound)
+		wantErr(t, "EditCheckout in trash", d.EditCheckout(&Checkout{ID: 2, Twelfths: 1}), ErrNotFound)
+		wantErr(t, "PurgeCheckout not in trash", d.PurgeCheckout(1), ErrNotFound)
+		must(t, "PurgeCheckout", d.PurgeCheckout(2))
+		wantErr(t, "UndeleteCheckout of purged checkout", d.UndeleteCheckout(2), ErrNotFound)
+		if id, err := d.AddCheckout(&Checkout{User: bob, Contribution: cont, Twelfths: 3, Date: conformanceDay}); err != nil || id != 3 {
+			t.Errorf("AddCheckout after purge = %d, %v; want 3", id, err)
+		}
+
+		// A checkout in the trash cannot come back once its stock is gone.
+		must(t, "DeleteCheckout", d.DeleteCheckout(3))
+		_, err = d.AddCheckout(&Checkout{User: bob, Contribution: cont, Twelfths: 1, Date: conformanceDay})
+		must(t, "AddCheckout", err)
+		err = d.UndeleteCheckout(3)
+		wantStockErr(t, "UndeleteCheckout of taken stock", err, InsufficientStockError{Contribution: cont, Requested: 3, Remaining: 2})
+		wantErr(t, "UndeleteCheckout not in trash", d.UndeleteCheckout(1), ErrNotFound)
+	})
+}
+
+func TestConformanceListRemaining(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, d BeerDatabase) {
+		alice, bob, beer, cont := addConformanceStock(t, d, 2)
+		second, err := d.AddContribution(&Contribution{User: bob, Beer: beer, Quantity: 1, UnitPrice: 800, Date: conformanceDay})
+		must(t, "AddContribution", err)
+		trashed, err := d.AddContribution(&Contribution{User: bob, Beer: beer, Quantity: 5, UnitPrice: 800, Date: conformanceDay})
+		must(t, "AddContribution", err)
+		empty, err := d.AddBeer(&Beer{Name: "Stout"})
+		must(t, "AddBeer", err)
+		_, err = d.AddCheckouts([]*Checkout{
+			{User: bob, Contribution: cont, Twelfths: 5, Date: conformanceDay},
+			{User: alice, Contribution: second, Twelfths: 12, Date: conformanceDay},
+			{User: alice, Contribution: trashed, Twelfths: 1, Date: conformanceDay},
+		})
+		must(t, "AddCheckouts", err)
+		must(t, "DeleteContribution", d.DeleteContribution(trashed))
+
+		want := map[int64]int64{cont: 19, second: 0}
+		if got, err := d.ListContributionsRemaining(); err != nil || fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("ListContributionsRemaining = %v, %v; want %v", got, err, want)
+		}
+		want = map[int64]int64{beer: 19}
+		if got, err := d.ListBeersRemaining(); err != nil || fmt.Sprint(got) != fmt.Sprint(want) || got[empty] != 0 {
+			t.Errorf("ListBeersRemaining = %v, %v; want %v", got, err, want)
+		}
+	})
+}
+
+func TestConformanceTrashCascade(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, d BeerDatabase) {
+		alice, bob, _, cont := addConformanceStock(t, d, 1)
+		var ids []int64
+		for i := 0; i < 3; i++ {
+			id, err := d.AddCheckout(&Checkout{User: bob, Contribution: cont, Twelfths: 2, Date: conformanceDay})
+			must(t, "AddCheckout", err)
+			ids = append(ids, id)
+		}
+		must(t, "DeleteCheckout", d.DeleteCheckout(ids[0]))
+		must(t, "DeleteContribution", d.DeleteContribution(cont))
+		couts, err := d.ListDeletedCheckouts()
+		if err != nil || len(couts) != 3 || couts[0].ID == ids[0] || couts[2].ID != ids[0] {
+			t.Errorf("ListDeletedCheckouts = %v, %v; want %d last", recordIDs(couts), err, ids[0])
+		}
+		wantErr(t, "UndeleteCheckout of trashed contribution", d.UndeleteCheckout(ids[1]), ErrNotFound)
+		if b, err := d.GetBalance(bob); err != nil || b.Taken != 0 {
+			t.Errorf("GetBalance with contribution in trash = %+v, %v; want nothing taken", b, err)
+		}
+
+		// Only the checkouts deleted with the contribution come back.
+		must(t, "UndeleteContribution", d.UndeleteContribution(cont))
+		couts, err = d.ListCheckouts()
+		wantIDs(t, "ListCheckouts after undelete", couts, err, ids[1], ids[2])
+		couts, err = d.ListDeletedCheckouts()
+		wantIDs(t, "ListDeletedCheckouts after undelete", couts, err, ids[0])
+
+		// Purging a contribution purges its checkouts, unlinking suggestions
+		// confirmed by them.
+		beer := int64(1)
+		sg, err := d.AddSuggestion(&Suggestion{User: alice, Checkin: 1, Beer: beer, Date: conformanceDay})
+		must(t, "AddSuggestion", err)
+		cout, err := d.ConfirmSuggestion(sg, 2)
+		must(t, "ConfirmSuggestion", err)
+		must(t, "DeleteContribution", d.DeleteContribution(cont))
+		must(t, "PurgeContribution", d.PurgeContribution(cont))
+		couts, err = d.ListDeletedCheckouts()
+		wantIDs(t, "ListDeletedCheckouts after purge", couts, err)
+		if s, err := d.GetSuggestion(sg); err != nil || s.State != SuggestionConfirmed || s.Checkout != 0 {
+			t.Errorf("GetSuggestion after purging checkout %d = %+v, %v", cout, s, err)
+		}
+	})
+}
+
+func TestConformanceBalances(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, d BeerDatabase) {
+		zed, err := d.AddUser(&User{Name: "zed", SeedFund: 2000})
+		must(t, "AddUser", err)
+		alice, bob, _, cont := addConformanceStock(t, d, 2)
+		// Each checkout's value is rounded: 1 twelfth of $10 is 83c.
+		for i := 0; i < 3; i++ {
+			_, err := d.AddCheckout(&Checkout{User: bob, Contribution: cont, Twelfths: 1, Date: conformanceDay})
+			must(t, "AddCheckout", err)
+		}
+		_, err = d.AddDebitCredits([]*DebitCredit{
+			{User: bob, Amount: -150, Date: conformanceDay},
+			{User: zed, Amount: 25, Date: conformanceDay},
+		})
+		must(t, "AddDebitCredits", err)
+
+		bals, err := d.ListBalances()
+		if err != nil || len(bals) != 3 {
+			t.Fatalf("ListBalances = %v, %v", bals, err)
+		}
+		for i, want := range []Balance{
+			{User: alice, Added: 2000},
+			{User: bob, Taken: 249, DebitCredit: -150},
+			{User: zed, SeedFund: 2000, DebitCredit: 25},
+		} {
+			if *bals[i] != want {
+				t.Errorf("ListBalances[%d] = %+v, want %+v", i, bals[i], want)
+			}
+		}
+		if b, err := d.GetBalance(bob); err != nil || b.NetPosition() != -399 {
+			t.Errorf("GetBalance = %+v, %v; want net -399", b, err)
+		}
+		_, err = d.GetBalance(99)
+		wantErr(t, "GetBalance of unknown user", err, ErrNotFound)
+	})
+}
+
+func TestConformanceDebitCredits(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, d BeerDatabase) {
+		alice, err := d.AddUser(&User{Name: "alice"})
+		must(t, "AddUser", err)
+		ids, err := d.AddDebitCredits([]*DebitCredit{
+			{User: alice, Amount: 100, Date: conformanceDay, Comment: "one"},
+			{User: alice, Amount: -200, Date: conformanceDay.AddDate(0, 0, -1), Comment: "two"},
+		})
+		if err != nil || fmt.Sprint(ids) != "[1 2]" {
+			t.Fatalf("AddDebitCredits = %v, %v; want [1 2]", ids, err)
+		}
+		_, err = d.AddDebitCredits([]*DebitCredit{{User: alice, Amount: 1}, {User: 99, Amount: 1}})
+		wantErr(t, "AddDebitCredits for unknown user", err, ErrNotFound)
+		dcs, err := d.ListDebitCredits()
+		wantIDs(t, "ListDebitCredits", dcs, err, 1, 2)
+
+		want := &DebitCredit{ID: 2, User: alice, Amount: -250, Date: conformanceDay.AddDate(0, 0, -1), Comment: "edited"}
+		must(t, "EditDebitCredit", d.EditDebitCredit(&DebitCredit{ID: 2, Amount: -250, Comment: "edited"}))
+		if dc, err := d.GetDebitCredit(2); err != nil || *dc != *want {
+			t.Errorf("GetDebitCredit after edit = %+v, %v; want %+v", dc, err, want)
+		}
+		wantErr(t, "EditDebitCredit of unknown debit/credit", d.EditDebitCredit(&DebitCredit{ID: 99}), errOther)
+
+		must(t, "DeleteDebitCredit", d.DeleteDebitCredit(1))
+		must(t, "DeleteDebitCredit", d.DeleteDebitCredit(2))
+		wantErr(t, "DeleteDebitCredit again", d.DeleteDebitCredit(2), ErrNotFound)
+		_, err = d.GetDebitCredit(2)
+		wantErr(t, "GetDebitCredit in trash", err, ErrNotFound)
+		wantErr(t, "EditDebitCredit in trash", d.EditDebitCredit(&DebitCredit{ID: 2}), errOther)
+		dcs, err = d.ListDeletedDebitCredits()
+		wantIDs(t, "ListDeletedDebitCredits", dcs, err, 2, 1)
+		must(t, "UndeleteDebitCredit", d.UndeleteDebitCredit(1))
+		wantErr(t, "UndeleteDebitCredit not in trash", d.UndeleteDebitCredit(1), ErrNotFound)
+		wantErr(t, "PurgeDebitCredit not in trash", d.PurgeDebitCredit(1), ErrNotFound)
+		must(t, "PurgeDebitCredit", d.PurgeDebitCredit(2))
+		if id, err := d.AddDebitCredit(&DebitCredit{User: alice, Amount: 1, Date: conformanceDay}); err != nil || id != 3 {
+			t.Errorf("AddDebitCredit after purge = %d, %v; want 3", id, err)
+		}
+		if b, err := d.GetBalance(alice); err != nil || b.DebitCredit != 101 {
+			t.Errorf("GetBalance = %+v, %v; want 101 debited/credited", b, err)
+		}
+	})
+}
+
+func TestConformanceSubscriptions(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, d BeerDatabase) {
+		alice, err := d.AddUser(&User{Name: "alice"})
+		must(t, "AddUser", err)
+		want := &Subscription{Endpoint: "https://push/1", Key: "key", Auth: "auth", UserAgent: "ua", Host: "host", Cookie: "c1", Muted: []EventType{EventTapped, EventOutOfStock}}
+		for i, cookie := range []string{"c1", "c1", "c2"} {
+			s := *want
+			s.Cookie = cookie
+			if id, err := d.AddSubscription(&s); err != nil || id != int64(i+1) {
+				t.Fatalf("AddSubscription = %d, %v; want %d", id, err, i+1)
+			}
+		}
+		_, err = d.AddSubscription(&Subscription{User: 99})
+		wantErr(t, "AddSubscription of unknown user", err, errOther)
+		subs, err := d.ListSubscriptions()
+		wantIDs(t, "ListSubscriptions", subs, err, 1, 2, 3)
+		want.ID = 1
+		if len(subs) > 0 && !reflect.DeepEqual(subs[0], want) {
+			t.Errorf("ListSubscriptions[0] = %+v, want %+v", subs[0], want)
+		}
+
+		if n, err := d.ClaimSubscriptions("c1", alice); err != nil || n != 2 {
+			t.Errorf("ClaimSubscriptions = %d, %v; want 2", n, err)
+		}
+		if n, err := d.ClaimSubscriptions("none", alice); err != nil || n != 0 {
+			t.Errorf("ClaimSubscriptions of unknown cookie = %d, %v; want 0", n, err)
+		}
+		_, err = d.ClaimSubscriptions("c2", 99)
+		wantErr(t, "ClaimSubscriptions by unknown user", err, errOther)
+		must(t, "SetSubscriptionMuted", d.SetSubscriptionMuted(2, nil))
+		wantErr(t, "SetSubscriptionMuted of unknown subscription", d.SetSubscriptionMuted(99, nil), ErrNotFound)
+		subs, err = d.ListSubscriptions()
+		if err != nil || len(subs) != 3 || subs[0].User != alice || subs[1].Muted != nil || subs[2].User != 0 {
+			t.Errorf("ListSubscriptions after claim and mute = %+v, %v", subs, err)
+		}
+
+		must(t, "DeleteSubscription", d.DeleteSubscription(3))
+		wantErr(t, "DeleteSubscription again", d.DeleteSubscription(3), errOther)
+		if id, err := d.AddSubscription(&Subscription{Cookie: "c3"}); err != nil || id != 4 {
+			t.Errorf("AddSubscription after delete = %d, %v; want 4", id, err)
+		}
+	})
+}
+
+func TestConformanceOutbox(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, d BeerDatabase) {
+		alice, err := d.AddUser(&User{Name: "alice"})
+		must(t, "AddUser", err)
+		bob, err := d.AddUser(&User{Name: "bob"})
+		must(t, "AddUser", err)
+		for _, s := range []*Subscription{
+			{Cookie: "a", User: alice},
+			{Cookie: "b", User: bob, Muted: []EventType{EventOutOfStock}},
+		} {
+			_, err := d.AddSubscription(s)
+			must(t, "AddSubscription", err)
+		}
+		beer, err := d.AddBeer(&Beer{Name: "Pale Ale"})
+		must(t, "AddBeer", err)
+		before := time.Now().Truncate(time.Second)
+		cont, err := d.AddContribution(&Contribution{User: alice, Beer: beer, Quantity: 1, UnitPrice: 1200, Date: conformanceDay})
+		must(t, "AddContribution", err)
+		cout, err := d.AddCheckout(&Checkout{User: bob, Contribution: cont, Twelfths: 12, Date: conformanceDay})
+		must(t, "AddCheckout", err)
+		dc, err := d.AddDebitCredit(&DebitCredit{User: alice, Amount: -5000, Date: conformanceDay})
+		must(t, "AddDebitCredit", err)
+
+		dls, err := d.ListDeliveries()
+		if err != nil {
+			t.Fatalf("ListDeliveries: %v", err)
+		}
+		var got []string
+		for _, dl := range dls {
+			got = append(got, fmt.Sprintf("%d:%d:%s:%d:%d", dl.ID, dl.Subscription, dl.Event.Type, dl.Event.User, dl.Event.Record))
+			if dl.Created.Before(before) || !dl.NextAttempt.Equal(dl.Created) || dl.Attempts != 0 || dl.Failed {
+				t.Errorf("Delivery %d = %+v, want new and due", dl.ID, dl)
+			}
+		}
+		want := fmt.Sprint([]string{
+			fmt.Sprintf("1:2:contribution:0:%d", cont),
+			fmt.Sprintf("2:1:tapped:%d:%d", alice, cout),
+			fmt.Sprintf("3:1:out-of-stock:0:%d", beer),
+			fmt.Sprintf("4:2:negative-balance:%d:%d", bob, bob),
+			fmt.Sprintf("5:1:debit-credit:%d:%d", alice, dc),
+			fmt.Sprintf("6:1:negative-balance:%d:%d", alice, alice),
+		})
+		if fmt.Sprint(got) != want {
+			t.Errorf("ListDeliveries = %v, want %v", got, want)
+		}
+
+		due, err := d.DueDeliveries(time.Now(), 2)
+		wantIDs(t, "DueDeliveries", due, err, 1, 2)
+		must(t, "FailDelivery", d.FailDelivery(1, "gone", time.Now().Add(time.Hour), false))
+		must(t, "FailDelivery", d.FailDelivery(2, "gone", time.Now(), true))
+		wantErr(t, "FailDelivery of unknown delivery", d.FailDelivery(99, "", time.Now(), false), ErrNotFound)
+		due, err = d.DueDeliveries(time.Now(), 10)
+		wantIDs(t, "DueDeliveries after failures", due, err, 3, 4, 5, 6)
+		must(t, "RetryDelivery", d.RetryDelivery(2))
+		wantErr(t, "RetryDelivery of unknown delivery", d.RetryDelivery(99), ErrNotFound)
+		dls, err = d.ListDeliveries()
+		if err != nil || len(dls) != 6 || dls[0].Attempts != 1 || dls[0].LastError != "gone" || dls[1].Failed || dls[1].Attempts != 1 {
+			t.Errorf("ListDeliveries after failures = %+v, %v", dls, err)
+		}
+
+		must(t, "DeleteDelivery", d.DeleteDelivery(3))
+		wantErr(t, "DeleteDelivery again", d.DeleteDelivery(3), ErrNotFound)
+		// Deliveries go with their subscription.
+		must(t, "DeleteSubscription", d.DeleteSubscription(1))
+		dls, err = d.ListDeliveries()
+		wantIDs(t, "ListDeliveries after deletes", dls, err, 1, 4)
+		_, err = d.AddDebitCredit(&DebitCredit{User: bob, Amount: 1, Date: conformanceDay})
+		must(t, "AddDebitCredit", err)
+		dls, err = d.ListDeliveries()
+		wantIDs(t, "ListDeliveries after new event", dls, err, 1, 4, 7)
+	})
+}
+
+func TestConformanceSuggestions(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, d BeerDatabase) {
+		alice, bob, beer, cont := addConformanceStock(t, d, 1)
+		add := func(user, checkin int64, date time.Time) int64 {
+			t.Helper()
+			id, err := d.AddSuggestion(&Suggestion{User: user, Checkin: checkin, Beer: beer, Date: date})
+			must(t, "AddSuggestion", err)
+			return id
+		}
+		first := add(bob, 1, conformanceDay.AddDate(0, 0, -1))
+		second := add(bob, 2, conformanceDay.Add(time.Minute))
+		third := add(alice, 3, conformanceDay.Add(time.Minute))
+		if first != 1 || third != 3 {
+			t.Errorf("AddSuggestion ids = %d to %d, want 1 to 3", first, third)
+		}
+		_, err := d.AddSuggestion(&Suggestion{User: bob, Checkin: 2, Beer: beer})
+		wantErr(t, "AddSuggestion of suggested check-in", err, ErrExists)
+		_, err = d.AddSuggestion(&Suggestion{User: 99, Checkin: 4, Beer: beer})
+		wantErr(t, "AddSuggestion to unknown user", err, errOther)
+		_, err = d.AddSuggestion(&Suggestion{User: bob, Checkin: 4, Beer: 99})
+		wantErr(t, "AddSuggestion of unknown beer", err, errOther)
+
+		sgs, err := d.ListSuggestions(0, SuggestionPending)
+		wantIDs(t, "ListSuggestions", sgs, err, third, second, first)
+		sgs, err = d.ListSuggestions(bob, SuggestionPending)
+		wantIDs(t, "ListSuggestions of user", sgs, err, second, first)
+		want := &Suggestion{ID: first, User: bob, Checkin: 1, Beer: beer, Date: conformanceDay.AddDate(0, 0, -1), State: SuggestionPending}
+		if s, err := d.GetSuggestion(first); err != nil || *s != *want {
+			t.Errorf("GetSuggestion = %+v, %v; want %+v", s, err, want)
+		}
+		_, err = d.GetSuggestion(99)
+		wantErr(t, "GetSuggestion of unknown suggestion", err, ErrNotFound)
+
+		// Confirming takes from the oldest contribution with enough left,
+		// dated when checked in.
+		newer, err := d.AddContribution(&Contribution{User: alice, Beer: beer, Quantity: 1, Date: conformanceDay.AddDate(0, 0, 1)})
+		must(t, "AddContribution", err)
+		_, err = d.AddCheckout(&Checkout{User: alice, Contribution: cont, Twelfths: 8, Date: conformanceDay})
+		must(t, "AddCheckout", err)
+		cout, err := d.ConfirmSuggestion(first, 6)
+		must(t, "ConfirmSuggestion", err)
+		if c, err := d.GetCheckout(cout); err != nil || c.Contribution != newer || c.User != bob || !c.Date.Equal(want.Date) {
+			t.Errorf("GetCheckout of confirmed suggestion = %+v, %v", c, err)
+		}
+		if s, err := d.GetSuggestion(first); err != nil || s.State != SuggestionConfirmed || s.Checkout != cout {
+			t.Errorf("GetSuggestion after confirm = %+v, %v", s, err)
+		}
+		_, err = d.ConfirmSuggestion(first, 1)
+		wantErr(t, "ConfirmSuggestion again", err, ErrNotFound)
+		_, err = d.ConfirmSuggestion(second, 12)
+		wantStockErr(t, "ConfirmSuggestion of too much", err, InsufficientStockError{Beer: beer, Requested: 12, Remaining: 6})
+		_, err = d.ConfirmSuggestion(second, 0)
+		wantErr(t, "ConfirmSuggestion of nothing", err, errOther)
+
+		must(t, "DismissSuggestion", d.DismissSuggestion(second))
+		wantErr(t, "DismissSuggestion again", d.DismissSuggestion(second), ErrNotFound)
+		wantErr(t, "DismissSuggestion of unknown suggestion", d.DismissSuggestion(99), ErrNotFound)
+		sgs, err = d.ListSuggestions(bob, SuggestionDismissed)
+		wantIDs(t, "ListSuggestions dismissed", sgs, err, second)
+
+		// Purging the checkout unlinks the suggestion.
+		must(t, "DeleteCheckout", d.DeleteCheckout(cout))
+		must(t, "PurgeCheckout", d.PurgeCheckout(cout))
+		if s, err := d.GetSuggestion(first); err != nil || s.State != SuggestionConfirmed || s.Checkout != 0 {
+			t.Errorf("GetSuggestion after purge = %+v, %v", s, err)
+		}
+	})
+}
+
+func TestConformanceAudit(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, d BeerDatabase) {
+		want := &AuditEntry{Time: conformanceDay, Action: "add", Table: "users", Record: 1, After: "{}", Actor: Actor{RemoteAddr: "addr", Cookie: "cookie", User: 1}}
+		for i := 1; i <= 5; i++ {
+			if id, err := d.AddAuditEntry(want); err != nil || id != int64(i) {
+				t.Fatalf("AddAuditEntry = %d, %v; want %d", id, err, i)
+			}
+		}
+		want.ID = 2
+		if e, err := d.GetAuditEntry(2); err != nil || *e != *want {
+			t.Errorf("GetAuditEntry = %+v, %v; want %+v", e, err, want)
+		}
+		_, err := d.GetAuditEntry(99)
+		wantErr(t, "GetAuditEntry of unknown entry", err, ErrNotFound)
+		entries, err := d.ListAuditEntries(0, 2)
+		wantIDs(t, "ListAuditEntries", entries, err, 5, 4)
+		entries, err = d.ListAuditEntries(4, 10)
+		wantIDs(t, "ListAuditEntries before", entries, err, 3, 2, 1)
+	})
+}
+
+func TestConformanceAudited(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, d BeerDatabase) {
+		actor := Actor{RemoteAddr: "addr", Cookie: "cookie", User: 1}
+		a := Audited(d, actor)
+		alice, err := a.AddUser(&User{Name: "alice"})
+		must(t, "AddUser", err)
+		must(t, "EditUser", a.EditUser(&User{ID: alice, Name: "alicia"}))
+		wantErr(t, "EditUser of unknown user", a.EditUser(&User{ID: 99, Name: "nobody"}), ErrNotFound)
+		beer, err := a.AddBeer(&Beer{Name: "Pale Ale"})
+		must(t, "AddBeer", err)
+		must(t, "RefreshBeer", a.RefreshBeer(&Beer{ID: beer, Name: "Pale Ale", UntappdRating: 3.5}))
+		cont, err := a.AddContribution(&Contribution{User: alice, Beer: beer, Quantity: 1, Date: conformanceDay})
+		must(t, "AddContribution", err)
+		must(t, "DeleteContribution", a.DeleteContribution(cont))
+		must(t, "PurgeContribution", a.PurgeContribution(cont))
+		must(t, "SetPasswordHash", a.SetPasswordHash(alice, "hash"))
+
+		entries, err := d.ListAuditEntries(0, -1)
+		must(t, "ListAuditEntries", err)
+		var got []string
+		for _, e := range entries {
+			got = append(got, fmt.Sprintf("%s %s %d", e.Action, e.Table, e.Record))
+			if want := (Actor{RemoteAddr: actor.RemoteAddr, Cookie: CookieFingerprint(actor.Cookie), User: actor.User}); e.Actor != want {
+				t.Errorf("entry %d actor = %+v, want %+v", e.ID, e.Actor, want)
+			}
+		}
+		want := []string{
+			fmt.Sprintf("password users %d", alice),
+			fmt.Sprintf("purge contributions %d", cont),
+			fmt.Sprintf("delete contributions %d", cont),
+			fmt.Sprintf("insert contributions %d", cont),
+			fmt.Sprintf("edit beers %d", beer),
+			fmt.Sprintf("insert beers %d", beer),
+			fmt.Sprintf("edit users %d", alice),
+			fmt.Sprintf("insert users %d", alice),
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("audit log = %q, want %q", got, want)
+		}
+		if e := entries[1]; e.Before == "" || e.After != "" {
+			t.Errorf("purge entry = %+v, want the deleted contribution before", e)
+		}
+		if e := entries[4]; e.Before == "" || e.After == "" || e.Before == e.After {
+			t.Errorf("refresh entry = %+v, want different before and after", e)
+		}
+		if e := entries[6]; e.Before == "" || e.After == "" || e.Before == e.After {
+			t.Errorf("edit entry = %+v, want different before and after", e)
+		}
+		if e := entries[0]; e.Before != "" || e.After != "" {
+			t.Errorf("password entry = %+v, want no hash recorded", e)
+		}
+	})
+}
+
+func TestConformanceConcurrent(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, d BeerDatabase) {
+		_, bob, beer, cont := addConformanceStock(t, d, 2)
+		// Of the workers each taking half a bottle, only four can succeed,
+		// while others read and write alongside them.
+		const workers = 16
+		var (
+			wg        sync.WaitGroup
+			mu        sync.Mutex
+			succeeded int
+		)
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, err := d.AddCheckout(&Checkout{User: bob, Contribution: cont, Twelfths: 6, Date: conformanceDay})
+				var stockErr *InsufficientStockError
+				if err != nil && !errors.As(err, &stockErr) {
+					t.Errorf("AddCheckout: %v", err)
+				}
+				if _, err := d.AddBeer(&Beer{Name: fmt.Sprint("Beer ", i)}); err != nil {
+					t.Errorf("AddBeer: %v", err)
+				}
+				if _, err := d.ListBalances(); err != nil {
+					t.Errorf("ListBalances: %v", err)
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				if err == nil {
+					succeeded++
+				}
+			}(i)
+		}
+		wg.Wait()
+		if succeeded != 4 {
+			t.Errorf("%d checkouts succeeded, want 4", succeeded)
+		}
+		if r, err := d.BeerRemaining(beer); err != nil || r != 0 {
+			t.Errorf("BeerRemaining = %d, %v; want 0", r, err)
+		}
+		beers, err := d.ListBeers()
+		if err != nil || len(beers) != workers+1 || beers[0].ID != workers+1 {
+			t.Errorf("ListBeers = %v, %v; want ids %d to 1", recordIDs(beers), err, workers+1)
+		}
+	})
+}
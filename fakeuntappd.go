@@ -0,0 +1,227 @@
+package syndicate
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeUntappd is a stand-in for the Untappd API and its untp.beer short
+// links, serving beers and check-ins from fixtures, for development and
+// tests. Point an UntappdClient at its /v4 path and ResolveShortURL at its
+// root.
+type FakeUntappd struct {
+	// Beers are the beers known to the API.
+	Beers []*CatalogBeer `json:"beers"`
+	// Checkins are users' check-ins by username, in any order.
+	Checkins map[string][]*FakeCheckin `json:"checkins"`
+	// ShortURLs map short link codes to beer IDs.
+	ShortURLs map[string]int64 `json:"short_urls"`
+	// Limit is the hourly API quota reported. Each API call lowers the
+	// remaining quota, and once it is used up calls fail with 429.
+	Limit int `json:"limit"`
+
+	mu    sync.Mutex
+	calls int
+}
+
+// FakeCheckin is a check-in served by FakeUntappd.
+type FakeCheckin struct {
+	ID      int64     `json:"id"`
+	Beer    int64     `json:"beer"`
+	Created time.Time `json:"created"`
+}
+
+// LoadFakeUntappd reads a FakeUntappd's fixtures from a JSON file.
+func LoadFakeUntappd(path string) (*FakeUntappd, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fake := &FakeUntappd{}
+	if err := json.NewDecoder(f).Decode(fake); err != nil {
+		return nil, fmt.Errorf("could not read %s: %v", path, err)
+	}
+	return fake, nil
+}
+
+// ResetQuota restores the API quota.
+func (f *FakeUntappd) ResetQuota() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = 0
+}
+
+// ServeHTTP answers beer info, beer search and user check-in calls under
+// /v4, and redirects short link codes at the root to the beer's page.
+func (f *FakeUntappd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 1 {
+		id, ok := f.ShortURLs[parts[0]]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/b/beer/%d", id), http.StatusFound)
+		return
+	}
+	if parts[0] != "v4" {
+		http.NotFound(w, r)
+		return
+	}
+	if !f.count(w) {
+		fakeUntappdError(w, http.StatusTooManyRequests, "invalid_limit", "rate limit exceeded")
+		return
+	}
+	switch {
+	case len(parts) == 4 && parts[1] == "beer" && parts[2] == "info":
+		id, _ := strconv.ParseInt(parts[3], 10, 64)
+		b := f.beer(id)
+		if b == nil {
+			fakeUntappdError(w, http.StatusNotFound, "invalid_param", "there is no beer with that ID")
+			return
+		}
+		fakeUntappdRespond(w, map[string]interface{}{"beer": fakeBeer(b, true)})
+	case len(parts) == 3 && parts[1] == "search" && parts[2] == "beer":
+		var items []interface{}
+		for _, b := range f.search(r.FormValue("q")) {
+			items = append(items, map[string]interface{}{
+				"beer":    fakeBeer(b, false),
+				"brewery": fakeBrewery(b),
+			})
+		}
+		fakeUntappdRespond(w, map[string]interface{}{
+			"beers": map[string]interface{}{"count": len(items), "items": items},
+		})
+	case len(parts) == 4 && parts[1] == "user" && parts[2] == "checkins":
+		limit, err := strconv.Atoi(r.FormValue("limit"))
+		if err != nil || limit <= 0 {
+			limit = 25
+		}
+		checkins, ok := f.Checkins[parts[3]]
+		if !ok {
+			fakeUntappdError(w, http.StatusNotFound, "invalid_user", "there is no user with that name")
+			return
+		}
+		checkins = append([]*FakeCheckin(nil), checkins...)
+		sort.Slice(checkins, func(i, j int) bool { return checkins[i].Created.After(checkins[j].Created) })
+		var items []interface{}
+		for _, c := range checkins {
+			if len(items) == limit {
+				break
+			}
+			b := f.beer(c.Beer)
+			if b == nil {
+				b = &CatalogBeer{ID: c.Beer}
+			}
+			items = append(items, map[string]interface{}{
+				"checkin_id": c.ID,
+				"created_at": c.Created.Format(time.RFC1123Z),
+				"beer":       fakeBeer(b, false),
+				"brewery":    fakeBrewery(b),
+			})
+		}
+		fakeUntappdRespond(w, map[string]interface{}{
+			"checkins": map[string]interface{}{"count": len(items), "items": items},
+		})
+	default:
+		fakeUntappdError(w, http.StatusNotFound, "invalid_method", "unknown API method")
+	}
+}
+
+// count counts an API call and sets the rate limit headers, returning false
+// if the quota is used up.
+func (f *FakeUntappd) count(w http.ResponseWriter) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Limit == 0 {
+		return true
+	}
+	ok := f.calls < f.Limit
+	if ok {
+		f.calls++
+	}
+	w.Header().Set("X-Ratelimit-Limit", strconv.Itoa(f.Limit))
+	w.Header().Set("X-Ratelimit-Remaining", strconv.Itoa(f.Limit-f.calls))
+	return ok
+}
+
+func (f *FakeUntappd) beer(id int64) *CatalogBeer {
+	for _, b := range f.Beers {
+		if b.ID == id {
+			return b
+		}
+	}
+	return nil
+}
+
+// search returns the beers whose name or brewery have all the query's words.
+func (f *FakeUntappd) search(query string) []*CatalogBeer {
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
+		return nil
+	}
+	var found []*CatalogBeer
+beers:
+	for _, b := range f.Beers {
+		text := strings.ToLower(b.Name + " " + b.Brewery)
+		for _, w := range words {
+			if !strings.Contains(text, w) {
+				continue beers
+			}
+		}
+		found = append(found, b)
+	}
+	return found
+}
+
+// fakeBeer returns a beer as the API describes it, with its brewery inside
+// as beer info has.
+func fakeBeer(b *CatalogBeer, withBrewery bool) map[string]interface{} {
+	beer := map[string]interface{}{
+		"bid":          b.ID,
+		"beer_name":    b.Name,
+		"rating_score": b.Rating,
+	}
+	if b.LabelURL != "" {
+		beer["beer_label"] = b.LabelURL
+	}
+	if withBrewery {
+		beer["brewery"] = fakeBrewery(b)
+	}
+	return beer
+}
+
+func fakeBrewery(b *CatalogBeer) map[string]interface{} {
+	return map[string]interface{}{
+		"brewery_id":   b.BreweryID,
+		"brewery_name": b.Brewery,
+	}
+}
+
+func fakeUntappdRespond(w http.ResponseWriter, response interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"meta":     map[string]interface{}{"code": http.StatusOK},
+		"response": response,
+	})
+}
+
+func fakeUntappdError(w http.ResponseWriter, code int, errType, detail string) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"meta": map[string]interface{}{
+			"code":         code,
+			"error_type":   errType,
+			"error_detail": detail,
+		},
+	})
+}
@@ -0,0 +1,81 @@
+package syndicate
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+// startFakeUntappd serves the fixtures in testdata and points Untappd at
+// them for the rest of the test.
+func startFakeUntappd(t testing.TB) (*FakeUntappd, *httptest.Server) {
+	t.Helper()
+	fake, err := LoadFakeUntappd("testdata/untappd.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	old := Untappd
+	t.Cleanup(func() { Untappd = old })
+	if err := NewUntappdClient("id", "secret", srv.URL+"/v4"); err != nil {
+		t.Fatal(err)
+	}
+	return fake, srv
+}
+
+func TestFakeUntappd(t *testing.T) {
+	_, srv := startFakeUntappd(t)
+
+	b, err := Untappd.Lookup(16649)
+	if err != nil || b.Name != "Pacific Ale" || b.Brewery != "Stone & Wood Brewing Co." || b.BreweryID != 3725 || b.Rating != 3.79 || b.LabelURL == "" {
+		t.Errorf("Lookup(16649) = %+v, %v", b, err)
+	}
+	if _, err := Untappd.Lookup(1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Lookup(1) = %v, want ErrNotFound", err)
+	}
+	found, err := Untappd.Search("pale ALE")
+	if err != nil || len(found) != 1 || found[0].ID != 3839 {
+		t.Errorf("Search = %+v, %v; want Pale Ale", found, err)
+	}
+	if _, err := Untappd.Search("Pale Ale"); err != nil {
+		t.Errorf("Search again: %v", err)
+	}
+
+	checkins, err := Untappd.GetUserCheckins("alice", 1)
+	if err != nil || len(checkins) != 1 || checkins[0].ID != 1002 || checkins[0].Beer.ID != 3839 || checkins[0].Created.IsZero() {
+		t.Errorf("GetUserCheckins = %+v, %v; want the latest check-in", checkins, err)
+	}
+	if _, err := Untappd.GetUserCheckins("nobody", 1); err == nil {
+		t.Errorf("GetUserCheckins of an unknown user succeeded")
+	}
+	// Failed calls count, but the second search came from the cache.
+	if q := Untappd.Quota(); q.Limit != 100 || q.Remaining != 95 {
+		t.Errorf("Quota = %+v, want 95 of 100 remaining", q)
+	}
+
+	for uri, want := range map[string]int64{
+		"https://untp.beer/1hHog":         110569,
+		"untp.beer/0rqOe":                 16649,
+		"https://untappd.com/b/beer/3839": 3839,
+	} {
+		if id, err := ResolveShortURL(srv.URL, uri); err != nil || id != want {
+			t.Errorf("ResolveShortURL(%q) = %d, %v; want %d", uri, id, err, want)
+		}
+	}
+	if _, err := ResolveShortURL(srv.URL, "https://untp.beer/nope"); err == nil {
+		t.Errorf("ResolveShortURL of an unknown link succeeded")
+	}
+}
+
+func TestFakeUntappdLimit(t *testing.T) {
+	fake, _ := startFakeUntappd(t)
+	fake.Limit = 1
+	Untappd.Reserve = 0
+	if _, err := Untappd.Lookup(3839); err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if _, err := Untappd.Lookup(4473); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Lookup with no quota left = %v, want ErrRateLimited", err)
+	}
+}
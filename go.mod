@@ -1,13 +1,17 @@
 module github.com/buxtronix/syndicate
 
-go 1.13
+go 1.18
 
 require (
 	github.com/SherClockHolmes/webpush-go v1.1.0
 	github.com/google/uuid v1.1.1
 	github.com/gorilla/handlers v1.4.2
 	github.com/gorilla/mux v1.7.3
+	github.com/lib/pq v1.10.9
 	github.com/mattn/go-sqlite3 v1.11.0
 	github.com/mdlayher/untappd v0.0.0-20181024205307-380b9e004c0e
 	github.com/patrickmn/go-cache v2.1.0+incompatible
+	golang.org/x/crypto v0.0.0-20190131182504-b8fe1690c613
 )
+
+require github.com/dgrijalva/jwt-go v3.2.0+incompatible // indirect
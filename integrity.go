@@ -0,0 +1,296 @@
+package syndicate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Kinds of problem found by CheckIntegrity.
+const (
+	ProblemMissingUser         = "missing user"
+	ProblemMissingBeer         = "missing beer"
+	ProblemMissingContribution = "missing contribution"
+	ProblemNegativeQuantity    = "negative quantity"
+	ProblemOverdrawn           = "over-drawn contribution"
+)
+
+// IntegrityProblem is an inconsistency in the database found by
+// CheckIntegrity.
+type IntegrityProblem struct {
+	// Kind is one of the Problem* kinds.
+	Kind string
+	// Table is the table of the record with the problem.
+	Table string
+	// Record is the id of the record with the problem.
+	Record int64
+	// Detail describes the problem.
+	Detail string
+	// Repair describes how the problem was repaired, or is empty if it
+	// was not.
+	Repair string
+}
+
+func (p *IntegrityProblem) String() string {
+	s := fmt.Sprintf("%s id %d: %s: %s", p.Table, p.Record, p.Kind, p.Detail)
+	if p.Repair != "" {
+		s += " (repaired: " + p.Repair + ")"
+	}
+	return s
+}
+
+// CheckIntegrity checks the database for records referring to users, beers
+// or contributions that do not exist, for contributions and checkouts with
+// negative quantities, and for contributions with more checked out than was
+// contributed. Records in the trash are checked for missing references too,
+// as they may yet be restored.
+//
+// If repair is true, each problem is also repaired:
+//   - missing users and beers are re-created as placeholders with the
+//     missing id, so that balances are unchanged;
+//   - checkouts of missing contributions cannot be valued, so are purged;
+//   - records with negative quantities are moved to the trash;
+//   - the latest checkouts of over-drawn contributions are moved to the
+//     trash until the rest are covered.
+//
+// The problems are returned whether repaired or not.
+func CheckIntegrity(db BeerDatabase, repair bool) ([]*IntegrityProblem, error) {
+	c := &integrityChecker{db: db, repair: repair}
+	for _, check := range []func() error{c.references, c.negatives, c.overdrawn} {
+		if err := check(); err != nil {
+			return c.problems, err
+		}
+	}
+	return c.problems, nil
+}
+
+type integrityChecker struct {
+	db       BeerDatabase
+	repair   bool
+	problems []*IntegrityProblem
+}
+
+// add records a problem, repairing it with fn if asked to. Fn returns a
+// description of the repair.
+func (c *integrityChecker) add(p *IntegrityProblem, fn func() (string, error)) error {
+	c.problems = append(c.problems, p)
+	if !c.repair {
+		return nil
+	}
+	repair, err := fn()
+	if err != nil {
+		return fmt.Errorf("could not repair %s: %v", p, err)
+	}
+	p.Repair = repair
+	return nil
+}
+
+// references checks that every user, beer and contribution referred to
+// exists.
+func (c *integrityChecker) references() error {
+	users, err := c.db.ListUsers()
+	if err != nil {
+		return err
+	}
+	userIDs := map[int64]bool{}
+	for _, u := range users {
+		userIDs[u.ID] = true
+	}
+	beers, err := c.db.ListBeers()
+	if err != nil {
+		return err
+	}
+	beerIDs := map[int64]bool{}
+	for _, b := range beers {
+		beerIDs[b.ID] = true
+	}
+	conts, err := c.db.ListContributions()
+	if err != nil {
+		return err
+	}
+	deletedConts, err := c.db.ListDeletedContributions()
+	if err != nil {
+		return err
+	}
+	conts = append(conts, deletedConts...)
+	couts, err := c.db.ListCheckouts()
+	if err != nil {
+		return err
+	}
+	deletedCouts, err := c.db.ListDeletedCheckouts()
+	if err != nil {
+		return err
+	}
+	couts = append(couts, deletedCouts...)
+	dcs, err := c.db.ListDebitCredits()
+	if err != nil {
+		return err
+	}
+	deletedDCs, err := c.db.ListDeletedDebitCredits()
+	if err != nil {
+		return err
+	}
+	dcs = append(dcs, deletedDCs...)
+
+	// Placeholders are created once, however many records refer to them.
+	placeholderUsers, placeholderBeers := map[int64]bool{}, map[int64]bool{}
+	user := func(table string, record, id int64) error {
+		if userIDs[id] {
+			return nil
+		}
+		p := &IntegrityProblem{Kind: ProblemMissingUser, Table: table, Record: record, Detail: fmt.Sprintf("user %d does not exist", id)}
+		return c.add(p, func() (string, error) {
+			if !placeholderUsers[id] {
+				if err := c.db.RestoreUser(&User{ID: id, Name: fmt.Sprintf("Missing user %d", id), Retired: true}); err != nil {
+					return "", err
+				}
+				placeholderUsers[id] = true
+			}
+			return fmt.Sprintf("added retired placeholder user %d", id), nil
+		})
+	}
+	contIDs := map[int64]bool{}
+	for _, cont := range conts {
+		contIDs[cont.ID] = true
+		if err := user(TableContributions, cont.ID, cont.User); err != nil {
+			return err
+		}
+		if beerIDs[cont.Beer] {
+			continue
+		}
+		id := cont.Beer
+		p := &IntegrityProblem{Kind: ProblemMissingBeer, Table: TableContributions, Record: cont.ID, Detail: fmt.Sprintf("beer %d does not exist", id)}
+		if err := c.add(p, func() (string, error) {
+			if !placeholderBeers[id] {
+				if err := c.db.RestoreBeer(&Beer{ID: id, Name: fmt.Sprintf("Missing beer %d", id)}); err != nil {
+					return "", err
+				}
+				placeholderBeers[id] = true
+			}
+			return fmt.Sprintf("added placeholder beer %d", id), nil
+		}); err != nil {
+			return err
+		}
+	}
+	for _, cout := range couts {
+		if !contIDs[cout.Contribution] {
+			cout := cout
+			p := &IntegrityProblem{Kind: ProblemMissingContribution, Table: TableCheckouts, Record: cout.ID, Detail: fmt.Sprintf("contribution %d does not exist", cout.Contribution)}
+			if err := c.add(p, func() (string, error) {
+				if cout.DeletedAt.IsZero() {
+					if err := c.db.DeleteCheckout(cout.ID); err != nil {
+						return "", err
+					}
+				}
+				return "purged checkout", c.db.PurgeCheckout(cout.ID)
+			}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := user(TableCheckouts, cout.ID, cout.User); err != nil {
+			return err
+		}
+	}
+	for _, dc := range dcs {
+		if err := user(TableDebitCredits, dc.ID, dc.User); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// negatives checks that no contribution or checkout is for a negative
+// quantity. Checkouts of nothing are reported too, as they cannot be made.
+func (c *integrityChecker) negatives() error {
+	conts, err := c.db.ListContributions()
+	if err != nil {
+		return err
+	}
+	for _, cont := range conts {
+		if cont.Quantity >= 0 {
+			continue
+		}
+		id := cont.ID
+		p := &IntegrityProblem{Kind: ProblemNegativeQuantity, Table: TableContributions, Record: id, Detail: fmt.Sprintf("quantity is %d", cont.Quantity)}
+		if err := c.add(p, func() (string, error) {
+			return "moved contribution and its checkouts to the trash", c.db.DeleteContribution(id)
+		}); err != nil {
+			return err
+		}
+	}
+	couts, err := c.db.ListCheckouts()
+	if err != nil {
+		return err
+	}
+	for _, cout := range couts {
+		if cout.Twelfths > 0 {
+			continue
+		}
+		id := cout.ID
+		p := &IntegrityProblem{Kind: ProblemNegativeQuantity, Table: TableCheckouts, Record: id, Detail: fmt.Sprintf("quantity is %d twelfths", cout.Twelfths)}
+		if err := c.add(p, func() (string, error) {
+			return "moved checkout to the trash", c.db.DeleteCheckout(id)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// overdrawn checks that no more has been checked out of each contribution
+// than was contributed.
+func (c *integrityChecker) overdrawn() error {
+	conts, err := c.db.ListContributions()
+	if err != nil {
+		return err
+	}
+	couts, err := c.db.ListCheckouts()
+	if err != nil {
+		return err
+	}
+	byCont := map[int64][]*Checkout{}
+	taken := map[int64]int64{}
+	for _, cout := range couts {
+		if cout.Twelfths > 0 {
+			byCont[cout.Contribution] = append(byCont[cout.Contribution], cout)
+			taken[cout.Contribution] += cout.Twelfths
+		}
+	}
+	for _, cont := range conts {
+		stock := cont.Quantity * 12
+		if cont.Quantity < 0 || taken[cont.ID] <= stock {
+			continue
+		}
+		id := cont.ID
+		p := &IntegrityProblem{Kind: ProblemOverdrawn, Table: TableContributions, Record: id, Detail: fmt.Sprintf("%d twelfths checked out of %d", taken[id], stock)}
+		if err := c.add(p, func() (string, error) {
+			latest := byCont[id]
+			sort.Slice(latest, func(i, j int) bool {
+				if !latest[i].Date.Equal(latest[j].Date) {
+					return latest[i].Date.After(latest[j].Date)
+				}
+				return latest[i].ID > latest[j].ID
+			})
+			var moved []string
+			for _, cout := range latest {
+				if taken[id] <= stock {
+					break
+				}
+				if err := c.db.DeleteCheckout(cout.ID); err != nil {
+					return "", err
+				}
+				taken[id] -= cout.Twelfths
+				moved = append(moved, fmt.Sprint(cout.ID))
+			}
+			noun := "checkouts "
+			if len(moved) == 1 {
+				noun = "checkout "
+			}
+			return "moved " + noun + strings.Join(moved, ", ") + " to the trash", nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
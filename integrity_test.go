@@ -0,0 +1,114 @@
+package syndicate
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+// openDirtyDB opens a database from before foreign keys, with records
+// referring to missing users, beers and contributions.
+func openDirtyDB(t *testing.T) *database {
+	t.Helper()
+	path := tempDBPath(t)
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		initialSchemaStmt,
+		`INSERT INTO users(id, name) VALUES (1, 'alice')`,
+		`INSERT INTO beers(id, name) VALUES (1, 'Pale Ale')`,
+		`INSERT INTO contributions(id, user, beer, quantity, date, unitprice) VALUES
+		  (1, 1, 1, 1, 100, 450), (2, 7, 9, 1, 100, 450), (3, 1, 1, -2, 100, 450)`,
+		`INSERT INTO checkouts(id, user, contribution, quantity, twelfths, date) VALUES
+		  (1, 1, 1, 0, 8, 100), (2, 1, 1, 0, 8, 200), (3, 1, 42, 0, 6, 100), (4, 1, 2, 0, -1, 100)`,
+		`INSERT INTO debitsCredits(id, user, amount, date) VALUES (1, 7, 100, 100)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	d := &database{}
+	if err := d.Open(path); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+func TestCheckIntegrity(t *testing.T) {
+	d := openDirtyDB(t)
+	want := []IntegrityProblem{
+		{Kind: ProblemMissingUser, Table: TableContributions, Record: 2},
+		{Kind: ProblemMissingBeer, Table: TableContributions, Record: 2},
+		{Kind: ProblemMissingContribution, Table: TableCheckouts, Record: 3},
+		{Kind: ProblemMissingUser, Table: TableDebitCredits, Record: 1},
+		{Kind: ProblemNegativeQuantity, Table: TableContributions, Record: 3},
+		{Kind: ProblemNegativeQuantity, Table: TableCheckouts, Record: 4},
+		{Kind: ProblemOverdrawn, Table: TableContributions, Record: 1},
+	}
+	check := func(repair bool) {
+		t.Helper()
+		problems, err := CheckIntegrity(d, repair)
+		if err != nil {
+			t.Fatalf("CheckIntegrity(%v): %v", repair, err)
+		}
+		if len(problems) != len(want) {
+			t.Fatalf("CheckIntegrity(%v) = %v, want %d problems", repair, problems, len(want))
+		}
+		for i, p := range problems {
+			if p.Kind != want[i].Kind || p.Table != want[i].Table || p.Record != want[i].Record {
+				t.Errorf("problem %d = %v, want %s of %s id %d", i, p, want[i].Kind, want[i].Table, want[i].Record)
+			}
+			if repaired := p.Repair != ""; repaired != repair {
+				t.Errorf("problem %d = %v, want repaired %v", i, p, repair)
+			}
+		}
+	}
+	check(false)
+	check(true)
+	if problems, err := CheckIntegrity(d, false); err != nil || len(problems) != 0 {
+		t.Errorf("CheckIntegrity after repair = %v, %v; want no problems", problems, err)
+	}
+
+	if u, err := d.GetUser(7); err != nil || !u.Retired {
+		t.Errorf("placeholder user = %+v, %v; want retired user", u, err)
+	}
+	if _, err := d.GetBeer(9); err != nil {
+		t.Errorf("placeholder beer: %v", err)
+	}
+	if err := d.UndeleteCheckout(3); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UndeleteCheckout of orphan: got error %v, want ErrNotFound as it was purged", err)
+	}
+	if _, err := d.GetCheckout(1); err != nil {
+		t.Errorf("earliest checkout of over-drawn contribution: %v", err)
+	}
+	if _, err := d.GetCheckout(2); !errors.Is(err, ErrNotFound) {
+		t.Errorf("latest checkout of over-drawn contribution: got error %v, want ErrNotFound as it is in the trash", err)
+	}
+}
+
+func TestForeignKeys(t *testing.T) {
+	d := openTestDB(t)
+	user, cont := addTestContribution(t, d, 1)
+	if _, err := d.AddCheckout(&Checkout{User: user, Contribution: cont, Twelfths: 1}); err != nil {
+		t.Fatalf("AddCheckout: %v", err)
+	}
+	for _, tc := range []struct {
+		stmt string
+		args []interface{}
+	}{
+		{`INSERT INTO checkouts(user, contribution, twelfths) VALUES (?, 99, 1)`, []interface{}{user}},
+		{`INSERT INTO checkouts(user, contribution, twelfths) VALUES (99, ?, 1)`, []interface{}{cont}},
+		{`INSERT INTO debitsCredits(user, amount) VALUES (99, 100)`, nil},
+		{`DELETE FROM users WHERE id = ?`, []interface{}{user}},
+		{`DELETE FROM contributions WHERE id = ?`, []interface{}{cont}},
+	} {
+		if _, err := d.db.Exec(tc.stmt, tc.args...); err == nil {
+			t.Errorf("%s: got nil error, want foreign key violation", tc.stmt)
+		}
+	}
+}
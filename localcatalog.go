@@ -0,0 +1,230 @@
+package syndicate
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// LocalCatalog is a beer catalog kept in an SQLite file, for running without
+// Untappd API credentials. Beers are put in it with Put, such as from a file
+// read by ReadCatalogFile.
+type LocalCatalog struct {
+	db *sql.DB
+}
+
+var _ BeerCatalog = &LocalCatalog{}
+
+const createCatalogStmt = `
+CREATE TABLE IF NOT EXISTS catalog(
+  id INTEGER PRIMARY KEY,
+  name TEXT NOT NULL,
+  brewery TEXT,
+  breweryid INTEGER,
+  rating REAL,
+  labelurl TEXT
+)`
+
+// OpenLocalCatalog opens the catalog in the SQLite file at path, creating
+// it if needed.
+func OpenLocalCatalog(path string) (*LocalCatalog, error) {
+	db, err := sql.Open("sqlite3", dsn(path))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(createCatalogStmt); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("sql: could not create catalog: %v", err)
+	}
+	return &LocalCatalog{db: db}, nil
+}
+
+// Close closes the catalog.
+func (c *LocalCatalog) Close() error {
+	return c.db.Close()
+}
+
+const catalogColumns = `id, name, IFNULL(brewery, ''), IFNULL(breweryid, 0), IFNULL(rating, 0), IFNULL(labelurl, '')`
+
+// maxCatalogResults is the most beers returned by a search.
+const maxCatalogResults = 25
+
+func scanCatalogBeers(s rowScanner) (*CatalogBeer, error) {
+	var b CatalogBeer
+	if err := s.Scan(&b.ID, &b.Name, &b.Brewery, &b.BreweryID, &b.Rating, &b.LabelURL); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Search returns the beers whose name and brewery contain every word of the
+// query, highest rated first.
+func (c *LocalCatalog) Search(query string) ([]*CatalogBeer, error) {
+	words := strings.Fields(query)
+	if len(words) == 0 {
+		return nil, nil
+	}
+	stmt := `SELECT ` + catalogColumns + ` FROM catalog WHERE 1`
+	var args []interface{}
+	for _, w := range words {
+		stmt += ` AND (name || ' ' || IFNULL(brewery, '')) LIKE ? ESCAPE '\'`
+		args = append(args, "%"+likeEscaper.Replace(w)+"%")
+	}
+	stmt += ` ORDER BY rating DESC, name LIMIT ?`
+	args = append(args, maxCatalogResults)
+	rows, err := c.db.Query(stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("sql: could not search catalog: %v", err)
+	}
+	defer rows.Close()
+	var beers []*CatalogBeer
+	for rows.Next() {
+		b, err := scanCatalogBeers(rows)
+		if err != nil {
+			return nil, fmt.Errorf("sql: could not read row: %v", err)
+		}
+		beers = append(beers, b)
+	}
+	return beers, rows.Err()
+}
+
+const getCatalogBeerStmt = `SELECT ` + catalogColumns + ` FROM catalog WHERE id = ?`
+
+// Lookup returns the beer with the ID.
+func (c *LocalCatalog) Lookup(id int64) (*CatalogBeer, error) {
+	b, err := scanCatalogBeers(c.db.QueryRow(getCatalogBeerStmt, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: catalog beer id %d", ErrNotFound, id)
+	} else if err != nil {
+		return nil, fmt.Errorf("sql: could not get catalog beer: %v", err)
+	}
+	return b, nil
+}
+
+// LabelURL returns the URL of the beer's label.
+func (c *LocalCatalog) LabelURL(id int64) (string, error) {
+	b, err := c.Lookup(id)
+	if err != nil {
+		return "", err
+	}
+	return b.LabelURL, nil
+}
+
+const putCatalogBeerStmt = `
+INSERT OR REPLACE INTO catalog(id, name, brewery, breweryid, rating, labelurl)
+VALUES (?, ?, ?, ?, ?, ?)`
+
+// Put adds beers to the catalog, replacing any with the same IDs.
+func (c *LocalCatalog) Put(beers []*CatalogBeer) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return fmt.Errorf("sql: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	for _, b := range beers {
+		if b.ID <= 0 || b.Name == "" {
+			return fmt.Errorf("catalog beer %q needs an id and name", b.Name)
+		}
+		if _, err := tx.Exec(putCatalogBeerStmt, b.ID, b.Name, b.Brewery, b.BreweryID, b.Rating, b.LabelURL); err != nil {
+			return fmt.Errorf("sql: could not put catalog beer: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sql: could not commit transaction: %v", err)
+	}
+	return nil
+}
+
+// setCatalogField sets the field of the beer named by a CSV column, which
+// may be one from an Untappd data export. Other columns are ignored.
+func setCatalogField(b *CatalogBeer, column, v string) error {
+	if v == "" {
+		return nil
+	}
+	var err error
+	switch column {
+	case "id", "bid":
+		b.ID, err = strconv.ParseInt(v, 10, 64)
+	case "name", "beer_name":
+		b.Name = v
+	case "brewery", "brewery_name":
+		b.Brewery = v
+	case "brewery_id":
+		b.BreweryID, err = strconv.ParseInt(v, 10, 64)
+	case "rating", "global_rating_score":
+		b.Rating, err = strconv.ParseFloat(v, 64)
+	case "label_url":
+		b.LabelURL = v
+	}
+	return err
+}
+
+// ReadCatalogFile reads beers for a LocalCatalog from a JSON file holding a
+// list of CatalogBeers, or a CSV file with a header naming its columns: id,
+// name, brewery, brewery_id, rating and label_url. The columns of an Untappd
+// data export are also understood.
+func ReadCatalogFile(path string) ([]*CatalogBeer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		var beers []*CatalogBeer
+		if err := json.NewDecoder(f).Decode(&beers); err != nil {
+			return nil, fmt.Errorf("could not read %s: %v", path, err)
+		}
+		return beers, nil
+	}
+	beers, err := readCatalogCSV(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %v", path, err)
+	}
+	return beers, nil
+}
+
+func readCatalogCSV(r io.Reader) ([]*CatalogBeer, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	var haveID, haveName bool
+	for i, col := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(col))
+		switch header[i] {
+		case "id", "bid":
+			haveID = true
+		case "name", "beer_name":
+			haveName = true
+		}
+	}
+	if !haveID || !haveName {
+		return nil, fmt.Errorf("header needs id and name columns, got %q", header)
+	}
+	var beers []*CatalogBeer
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return beers, nil
+		} else if err != nil {
+			return nil, err
+		}
+		b := &CatalogBeer{}
+		for i, v := range rec {
+			if err := setCatalogField(b, header[i], strings.TrimSpace(v)); err != nil {
+				return nil, fmt.Errorf("line %d, column %s: %v", line, header[i], err)
+			}
+		}
+		beers = append(beers, b)
+	}
+}
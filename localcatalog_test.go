@@ -0,0 +1,73 @@
+package syndicate
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalCatalog(t *testing.T) {
+	path := tempDBPath(t)
+	csvPath := filepath.Join(filepath.Dir(path), "export.csv")
+	// An Untappd export has a row per check-in, with extra columns.
+	export := "beer_name,brewery_name,beer_type,bid,brewery_id,global_rating_score\n" +
+		"Pale Ale,Stone & Wood,Pale Ale,100,10,3.8\n" +
+		"Stout,Stone & Wood,Stout,200,10,4.1\n" +
+		"Pale Ale,Stone & Wood,Pale Ale,100,10,3.8\n" +
+		"100% Lager,Other Brewery,Lager,300,,\n"
+	if err := ioutil.WriteFile(csvPath, []byte(export), 0644); err != nil {
+		t.Fatal(err)
+	}
+	beers, err := ReadCatalogFile(csvPath)
+	if err != nil || len(beers) != 4 {
+		t.Fatalf("ReadCatalogFile = %v, %v; want 4 beers", beers, err)
+	}
+
+	c, err := OpenLocalCatalog(path)
+	if err != nil {
+		t.Fatalf("OpenLocalCatalog: %v", err)
+	}
+	defer c.Close()
+	if err := c.Put(beers); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := c.Put([]*CatalogBeer{{Name: "No ID"}}); err == nil {
+		t.Errorf("Put without an id succeeded")
+	}
+
+	for _, tc := range []struct {
+		query string
+		want  []int64
+	}{
+		{"stone wood", []int64{200, 100}},
+		{"PALE", []int64{100}},
+		{"100%", []int64{300}},
+		{"%", []int64{300}},
+		{"_", nil},
+		{"  ", nil},
+	} {
+		found, err := c.Search(tc.query)
+		if err != nil {
+			t.Fatalf("Search(%q): %v", tc.query, err)
+		}
+		var got []int64
+		for _, b := range found {
+			got = append(got, b.ID)
+		}
+		if len(got) != len(tc.want) || (len(got) > 0 && got[0] != tc.want[0]) {
+			t.Errorf("Search(%q) = %v, want %v", tc.query, got, tc.want)
+		}
+	}
+
+	b, err := c.Lookup(200)
+	if err != nil || b.Name != "Stout" || b.Brewery != "Stone & Wood" || b.BreweryID != 10 || b.Rating != 4.1 {
+		t.Errorf("Lookup(200) = %+v, %v", b, err)
+	}
+	if _, err := c.Lookup(999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Lookup(999) = %v, want ErrNotFound", err)
+	}
+	if _, err := c.LabelURL(999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("LabelURL(999) = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,1635 @@
+package syndicate
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryDatabase is a BeerDatabase kept in memory, for tests and demos. It
+// behaves as the SQLite database does, down to the ordering of lists, the
+// reuse of ids and the resolution of stored times, and a single lock
+// serialises every call as SQLite's write lock does.
+type memoryDatabase struct {
+	*memoryStore
+
+	// actor is who changes made through the database are attributed to in
+	// the audit log, or nil if they are not recorded.
+	actor *Actor
+}
+
+// memoryStore holds the records of a memoryDatabase, shared by its audited
+// copies.
+type memoryStore struct {
+	mu sync.Mutex
+
+	users         map[int64]*User
+	passwordHash  map[int64]string
+	beers         map[int64]*Beer
+	ratings       []*memoryRating
+	contributions map[int64]*Contribution
+	checkouts     map[int64]*Checkout
+	subscriptions map[int64]*Subscription
+	deliveries    map[int64]*Delivery
+	suggestions   map[int64]*Suggestion
+	debitCredits  map[int64]*DebitCredit
+	auditEntries  []*AuditEntry
+	sessions      map[string]*LoginSession
+
+	// sequence is the last id given out by each table whose ids are
+	// never reused.
+	sequence map[string]int64
+}
+
+// memoryRating is a rating in a beer's history.
+type memoryRating struct {
+	id     int64
+	beer   int64
+	date   time.Time
+	rating int64
+}
+
+var _ BeerDatabase = &memoryDatabase{}
+
+// NewMemoryDatabase returns an empty database kept in memory, which is lost
+// when the process exits.
+func NewMemoryDatabase() BeerDatabase {
+	return &memoryDatabase{memoryStore: &memoryStore{
+		users:         map[int64]*User{},
+		passwordHash:  map[int64]string{},
+		beers:         map[int64]*Beer{},
+		contributions: map[int64]*Contribution{},
+		checkouts:     map[int64]*Checkout{},
+		subscriptions: map[int64]*Subscription{},
+		deliveries:    map[int64]*Delivery{},
+		suggestions:   map[int64]*Suggestion{},
+		debitCredits:  map[int64]*DebitCredit{},
+		sessions:      map[string]*LoginSession{},
+		sequence:      map[string]int64{},
+	}}
+}
+
+// unixTime returns t at the resolution the SQLite database stores it.
+func unixTime(t time.Time) time.Time {
+	return time.Unix(t.Unix(), 0)
+}
+
+// deletionTime returns the time to record a deletion at.
+func deletionTime() time.Time {
+	return time.Unix(0, time.Now().UnixNano())
+}
+
+// storedRating returns a rating as stored, in hundredths.
+func storedRating(rating float64) int64 {
+	return int64(rating * 100)
+}
+
+// rowID returns the id of a new row of a table whose highest id is given,
+// reusing the ids of removed rows above it as SQLite's INTEGER PRIMARY KEY
+// does.
+func rowID(highest int64) int64 {
+	return highest + 1
+}
+
+// autoID returns the id of a new row of a table whose ids are never reused,
+// as SQLite's AUTOINCREMENT does.
+func (m *memoryDatabase) autoID(table string, highest int64) int64 {
+	if highest > m.sequence[table] {
+		m.sequence[table] = highest
+	}
+	m.sequence[table]++
+	return m.sequence[table]
+}
+
+// errNoReference returns the error for a record referring to a missing one,
+// as a foreign key constraint gives.
+func errNoReference(table string, id int64) error {
+	return fmt.Errorf("memory: no %s id %d to refer to", table, id)
+}
+
+// errNotChanged returns the error for a change to a missing record, where
+// the SQLite database expects one row affected.
+func errNotChanged(table string, id int64) error {
+	return fmt.Errorf("memory: expected 1 row affected, no %s id %d", table, id)
+}
+
+func (m *memoryDatabase) ListUsers() ([]*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.listUsers(), nil
+}
+
+// listUsers returns copies of the users in order of name.
+func (m *memoryDatabase) listUsers() []*User {
+	var users []*User
+	for _, u := range m.users {
+		users = append(users, m.user(u))
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].Name != users[j].Name {
+			return users[i].Name < users[j].Name
+		}
+		return users[i].ID < users[j].ID
+	})
+	return users
+}
+
+// user returns a copy of the stored user.
+func (m *memoryDatabase) user(u *User) *User {
+	c := *u
+	c.HasPassword = m.passwordHash[u.ID] != ""
+	return &c
+}
+
+func (m *memoryDatabase) GetUser(id int64) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: user id %d", ErrNotFound, id)
+	}
+	return m.user(u), nil
+}
+
+func (m *memoryDatabase) AddUser(u *User) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var highest int64
+	for id := range m.users {
+		if id > highest {
+			highest = id
+		}
+	}
+	c := &User{ID: rowID(highest)}
+	setUser(c, u)
+	m.users[c.ID] = c
+	if err := m.audit().added(AuditInsert, TableUsers, c.ID); err != nil {
+		return 0, err
+	}
+	return c.ID, nil
+}
+
+// setUser sets the stored details of a user.
+func setUser(to, from *User) {
+	to.Name, to.UntappdID, to.SeedFund, to.Retired = from.Name, from.UntappdID, from.SeedFund, from.Retired
+}
+
+func (m *memoryDatabase) EditUser(u *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.editUser(u)
+}
+
+func (m *memoryDatabase) EditUserPasswordHash(u *User, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.editUser(u); err != nil {
+		return err
+	}
+	return m.setPasswordHash(u.ID, hash)
+}
+
+func (m *memoryDatabase) editUser(u *User) error {
+	c, ok := m.users[u.ID]
+	if !ok {
+		return fmt.Errorf("%w: user id %d", ErrNotFound, u.ID)
+	}
+	done, err := m.audit().change(AuditEdit, TableUsers, u.ID)
+	if err != nil {
+		return err
+	}
+	setUser(c, u)
+	return done()
+}
+
+func (m *memoryDatabase) ListBeers() ([]*Beer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var beers []*Beer
+	for _, b := range m.beers {
+		c := *b
+		beers = append(beers, &c)
+	}
+	sort.Slice(beers, func(i, j int) bool { return beers[i].ID > beers[j].ID })
+	return beers, nil
+}
+
+func (m *memoryDatabase) GetBeer(id int64) (*Beer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.beers[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: beer id %d", ErrNotFound, id)
+	}
+	c := *b
+	return &c, nil
+}
+
+// setBeer sets the stored details of a beer, other than when it was
+// refreshed.
+func setBeer(to, from *Beer) {
+	to.Brewery, to.Name, to.UntappdID = from.Brewery, from.Name, from.UntappdID
+	to.UntappdRating = float64(storedRating(from.UntappdRating)) / 100
+	to.BreweryID, to.LabelURL = from.BreweryID, from.LabelURL
+}
+
+func (m *memoryDatabase) AddBeer(b *Beer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var highest int64
+	for id := range m.beers {
+		if id > highest {
+			highest = id
+		}
+	}
+	c := &Beer{ID: rowID(highest)}
+	setBeer(c, b)
+	m.beers[c.ID] = c
+	if err := m.audit().added(AuditInsert, TableBeers, c.ID); err != nil {
+		return 0, err
+	}
+	return c.ID, nil
+}
+
+func (m *memoryDatabase) EditBeer(b *Beer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.beers[b.ID]
+	if !ok {
+		return fmt.Errorf("%w: beer id %d", ErrNotFound, b.ID)
+	}
+	done, err := m.audit().change(AuditEdit, TableBeers, b.ID)
+	if err != nil {
+		return err
+	}
+	setBeer(c, b)
+	return done()
+}
+
+func (m *memoryDatabase) RefreshBeer(b *Beer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.beers[b.ID]
+	if !ok {
+		return fmt.Errorf("%w: beer id %d", ErrNotFound, b.ID)
+	}
+	done, err := m.audit().change(AuditEdit, TableBeers, b.ID)
+	if err != nil {
+		return err
+	}
+	untappdID := c.UntappdID
+	setBeer(c, b)
+	c.UntappdID = untappdID
+	c.Refreshed = unixTime(time.Now())
+
+	rating := storedRating(b.UntappdRating)
+	var last *memoryRating
+	for _, r := range m.ratings {
+		if r.beer == b.ID && (last == nil || !r.date.Before(last.date)) {
+			last = r
+		}
+	}
+	if last == nil || last.rating != rating {
+		var highest int64
+		for _, r := range m.ratings {
+			if r.id > highest {
+				highest = r.id
+			}
+		}
+		m.ratings = append(m.ratings, &memoryRating{
+			id:     m.autoID("ratings", highest),
+			beer:   b.ID,
+			date:   c.Refreshed,
+			rating: rating,
+		})
+	}
+	return done()
+}
+
+func (m *memoryDatabase) ListRatings(beer int64) ([]*Rating, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ratings []*Rating
+	for _, r := range m.ratings {
+		if r.beer == beer {
+			ratings = append(ratings, &Rating{Date: r.date, Rating: float64(r.rating) / 100})
+		}
+	}
+	sort.SliceStable(ratings, func(i, j int) bool { return ratings[i].Date.Before(ratings[j].Date) })
+	return ratings, nil
+}
+
+// removeBeer removes a beer along with its rating history and suggestions.
+func (m *memoryDatabase) removeBeer(id int64) {
+	delete(m.beers, id)
+	var ratings []*memoryRating
+	for _, r := range m.ratings {
+		if r.beer != id {
+			ratings = append(ratings, r)
+		}
+	}
+	m.ratings = ratings
+	for sid, sg := range m.suggestions {
+		if sg.Beer == id {
+			delete(m.suggestions, sid)
+		}
+	}
+}
+
+func (m *memoryDatabase) DeleteBeer(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.beers[id]; !ok {
+		return fmt.Errorf("%w: beer id %d", ErrNotFound, id)
+	}
+	var n int64
+	for _, c := range m.contributions {
+		if c.Beer == id {
+			n++
+		}
+	}
+	if n > 0 {
+		return fmt.Errorf("%w: beer id %d has %d contributions", ErrInUse, id, n)
+	}
+	done, err := m.audit().change(AuditDelete, TableBeers, id)
+	if err != nil {
+		return err
+	}
+	m.removeBeer(id)
+	return done()
+}
+
+func (m *memoryDatabase) MergeBeers(duplicate, canonical int64) error {
+	if duplicate == canonical {
+		return fmt.Errorf("cannot merge beer id %d into itself", duplicate)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range []int64{duplicate, canonical} {
+		if _, ok := m.beers[id]; !ok {
+			return fmt.Errorf("%w: beer id %d", ErrNotFound, id)
+		}
+	}
+	done, err := m.audit().merged(duplicate, canonical)
+	if err != nil {
+		return err
+	}
+	for _, c := range m.contributions {
+		if c.Beer == duplicate {
+			c.Beer = canonical
+		}
+	}
+	for _, sg := range m.suggestions {
+		if sg.Beer == duplicate {
+			sg.Beer = canonical
+		}
+	}
+	m.removeBeer(duplicate)
+	return done()
+}
+
+// listContributions returns copies of the contributions in or out of the
+// trash, in the order the SQLite database lists them.
+func (m *memoryDatabase) listContributions(deleted bool) []*Contribution {
+	var conts []*Contribution
+	for _, c := range m.contributions {
+		if c.DeletedAt.IsZero() != deleted {
+			cc := *c
+			conts = append(conts, &cc)
+		}
+	}
+	sort.Slice(conts, func(i, j int) bool {
+		if deleted && !conts[i].DeletedAt.Equal(conts[j].DeletedAt) {
+			return conts[i].DeletedAt.After(conts[j].DeletedAt)
+		}
+		if !deleted && !conts[i].Date.Equal(conts[j].Date) {
+			return conts[i].Date.Before(conts[j].Date)
+		}
+		return conts[i].ID < conts[j].ID
+	})
+	return conts
+}
+
+func (m *memoryDatabase) ListContributions() ([]*Contribution, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.listContributions(false), nil
+}
+
+// contribution returns the contribution not in the trash, or nil.
+func (m *memoryDatabase) contribution(id int64) *Contribution {
+	if c, ok := m.contributions[id]; ok && c.DeletedAt.IsZero() {
+		return c
+	}
+	return nil
+}
+
+func (m *memoryDatabase) GetContribution(id int64) (*Contribution, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.contribution(id)
+	if c == nil {
+		return nil, fmt.Errorf("%w: contribution id %d", ErrNotFound, id)
+	}
+	cc := *c
+	return &cc, nil
+}
+
+func (m *memoryDatabase) AddContribution(c *Contribution) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[c.User]; !ok {
+		return 0, errNoReference("users", c.User)
+	}
+	if _, ok := m.beers[c.Beer]; !ok {
+		return 0, errNoReference("beers", c.Beer)
+	}
+	var highest int64
+	for id := range m.contributions {
+		if id > highest {
+			highest = id
+		}
+	}
+	cc := &Contribution{
+		ID:        rowID(highest),
+		User:      c.User,
+		Beer:      c.Beer,
+		Quantity:  c.Quantity,
+		Date:      unixTime(c.Date),
+		UnitPrice: c.UnitPrice,
+		Comment:   c.Comment,
+	}
+	m.contributions[cc.ID] = cc
+	m.enqueue([]*Event{{Type: EventContribution, From: c.User, Record: cc.ID}})
+	if err := m.audit().added(AuditInsert, TableContributions, cc.ID); err != nil {
+		return 0, err
+	}
+	return cc.ID, nil
+}
+
+func (m *memoryDatabase) EditContribution(c *Contribution) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	remaining, err := m.remaining(c.ID)
+	if err != nil {
+		return err
+	}
+	cc := m.contribution(c.ID)
+	if taken := cc.Quantity*12 - remaining; c.Quantity*12 < taken {
+		return &InsufficientStockError{
+			Contribution: c.ID,
+			Requested:    taken,
+			Remaining:    c.Quantity * 12,
+		}
+	}
+	done, err := m.audit().change(AuditEdit, TableContributions, c.ID)
+	if err != nil {
+		return err
+	}
+	cc.Quantity, cc.UnitPrice, cc.Comment = c.Quantity, c.UnitPrice, c.Comment
+	return done()
+}
+
+func (m *memoryDatabase) DeleteContribution(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.contribution(id)
+	if c == nil {
+		return fmt.Errorf("%w: contribution id %d", ErrNotFound, id)
+	}
+	done, err := m.audit().change(AuditDelete, TableContributions, id)
+	if err != nil {
+		return err
+	}
+	now := deletionTime()
+	c.DeletedAt = now
+	for _, co := range m.checkouts {
+		if co.Contribution == id && co.DeletedAt.IsZero() {
+			co.DeletedAt = now
+		}
+	}
+	return done()
+}
+
+func (m *memoryDatabase) ListDeletedContributions() ([]*Contribution, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.listContributions(true), nil
+}
+
+// deletedContribution returns the contribution in the trash, or ErrNotFound.
+func (m *memoryDatabase) deletedContribution(id int64) (*Contribution, error) {
+	c, ok := m.contributions[id]
+	if !ok || c.DeletedAt.IsZero() {
+		return nil, fmt.Errorf("%w: deleted contributions id %d", ErrNotFound, id)
+	}
+	return c, nil
+}
+
+func (m *memoryDatabase) UndeleteContribution(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, err := m.deletedContribution(id)
+	if err != nil {
+		return err
+	}
+	for _, co := range m.checkouts {
+		if co.Contribution == id && co.DeletedAt.Equal(c.DeletedAt) {
+			co.DeletedAt = time.Time{}
+		}
+	}
+	c.DeletedAt = time.Time{}
+	return m.audit().added(AuditRestore, TableContributions, id)
+}
+
+func (m *memoryDatabase) PurgeContribution(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.deletedContribution(id); err != nil {
+		return err
+	}
+	done, err := m.audit().change(AuditPurge, TableContributions, id)
+	if err != nil {
+		return err
+	}
+	for cid, co := range m.checkouts {
+		if co.Contribution == id {
+			m.removeCheckout(cid)
+		}
+	}
+	delete(m.contributions, id)
+	return done()
+}
+
+// listCheckouts returns copies of the checkouts in or out of the trash, in
+// the order the SQLite database lists them.
+func (m *memoryDatabase) listCheckouts(deleted bool) []*Checkout {
+	var couts []*Checkout
+	for _, c := range m.checkouts {
+		if c.DeletedAt.IsZero() != deleted {
+			cc := *c
+			couts = append(couts, &cc)
+		}
+	}
+	sort.Slice(couts, func(i, j int) bool {
+		if deleted && !couts[i].DeletedAt.Equal(couts[j].DeletedAt) {
+			return couts[i].DeletedAt.After(couts[j].DeletedAt)
+		}
+		if !deleted && !couts[i].Date.Equal(couts[j].Date) {
+			return couts[i].Date.Before(couts[j].Date)
+		}
+		return couts[i].ID < couts[j].ID
+	})
+	return couts
+}
+
+func (m *memoryDatabase) ListCheckouts() ([]*Checkout, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.listCheckouts(false), nil
+}
+
+// checkout returns the checkout not in the trash, or nil.
+func (m *memoryDatabase) checkout(id int64) *Checkout {
+	if c, ok := m.checkouts[id]; ok && c.DeletedAt.IsZero() {
+		return c
+	}
+	return nil
+}
+
+func (m *memoryDatabase) GetCheckout(id int64) (*Checkout, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.checkout(id)
+	if c == nil {
+		return nil, fmt.Errorf("%w: checkout id %d", ErrNotFound, id)
+	}
+	cc := *c
+	return &cc, nil
+}
+
+func (m *memoryDatabase) AddCheckout(c *Checkout) (int64, error) {
+	ids, err := m.AddCheckouts([]*Checkout{c})
+	if err != nil {
+		return 0, err
+	}
+	return ids[0], nil
+}
+
+// remaining returns the twelfths left in a contribution not in the trash,
+// or ErrNotFound.
+func (m *memoryDatabase) remaining(id int64) (int64, error) {
+	c := m.contribution(id)
+	if c == nil {
+		return 0, fmt.Errorf("%w: contribution id %d", ErrNotFound, id)
+	}
+	remaining := c.Quantity * 12
+	for _, co := range m.checkouts {
+		if co.Contribution == id && co.DeletedAt.IsZero() {
+			remaining -= co.Twelfths
+		}
+	}
+	return remaining, nil
+}
+
+func (m *memoryDatabase) AddCheckouts(cs []*Checkout) ([]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.addCheckouts(cs)
+}
+
+// addCheckouts adds checkouts, checking them all before adding any, and
+// enqueues the events they cause.
+func (m *memoryDatabase) addCheckouts(cs []*Checkout) ([]int64, error) {
+	requested := map[int64]int64{}
+	var conts, users []int64
+	for _, c := range cs {
+		if c.Twelfths <= 0 {
+			return nil, fmt.Errorf("invalid checkout quantity: %d twelfths", c.Twelfths)
+		}
+		if _, ok := requested[c.Contribution]; !ok {
+			conts = append(conts, c.Contribution)
+		}
+		requested[c.Contribution] += c.Twelfths
+		users = append(users, c.User)
+	}
+	for _, cont := range conts {
+		remaining, err := m.remaining(cont)
+		if err != nil {
+			return nil, err
+		}
+		if want := requested[cont]; want > remaining {
+			return nil, &InsufficientStockError{
+				Contribution: cont,
+				Requested:    want,
+				Remaining:    remaining,
+			}
+		}
+	}
+
+	before, err := m.balances(users)
+	if err != nil {
+		return nil, err
+	}
+	var highest int64
+	for id := range m.checkouts {
+		if id > highest {
+			highest = id
+		}
+	}
+	ids := make([]int64, 0, len(cs))
+	for _, c := range cs {
+		cc := &Checkout{
+			ID:           m.autoID("checkouts", highest),
+			User:         c.User,
+			Contribution: c.Contribution,
+			Date:         unixTime(c.Date),
+			Twelfths:     c.Twelfths,
+		}
+		m.checkouts[cc.ID] = cc
+		ids = append(ids, cc.ID)
+	}
+	if err := m.audit().added(AuditInsert, TableCheckouts, ids...); err != nil {
+		return nil, err
+	}
+	events := m.checkoutEvents(cs, ids)
+	after, err := m.balances(users)
+	if err != nil {
+		return nil, err
+	}
+	events = append(events, negativeBalanceEvents(users, before, after)...)
+	m.enqueue(events)
+	return ids, nil
+}
+
+// checkoutEvents returns the events caused by the checkouts with the ids:
+// contributions being tapped and beers running out.
+func (m *memoryDatabase) checkoutEvents(cs []*Checkout, ids []int64) []*Event {
+	var events []*Event
+	for i, c := range cs {
+		if cont := m.contributions[c.Contribution]; c.User != cont.User {
+			events = append(events, &Event{Type: EventTapped, User: cont.User, Record: ids[i]})
+		}
+	}
+	beers := map[int64]bool{}
+	for _, c := range cs {
+		beer := m.contributions[c.Contribution].Beer
+		if beers[beer] {
+			continue
+		}
+		beers[beer] = true
+		if m.beerRemaining(beer) == 0 {
+			events = append(events, &Event{Type: EventOutOfStock, Record: beer})
+		}
+	}
+	return events
+}
+
+func (m *memoryDatabase) EditCheckout(c *Checkout) error {
+	if c.Twelfths <= 0 {
+		return fmt.Errorf("invalid checkout quantity: %d twelfths", c.Twelfths)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old := m.checkout(c.ID)
+	if old == nil {
+		return fmt.Errorf("%w: checkout id %d", ErrNotFound, c.ID)
+	}
+	remaining, err := m.remaining(old.Contribution)
+	if err != nil {
+		return err
+	}
+	if available := remaining + old.Twelfths; c.Twelfths > available {
+		return &InsufficientStockError{
+			Contribution: old.Contribution,
+			Requested:    c.Twelfths,
+			Remaining:    available,
+		}
+	}
+	if _, ok := m.users[c.User]; !ok {
+		return errNoReference("users", c.User)
+	}
+	done, err := m.audit().change(AuditEdit, TableCheckouts, c.ID)
+	if err != nil {
+		return err
+	}
+	old.User, old.Twelfths = c.User, c.Twelfths
+	return done()
+}
+
+func (m *memoryDatabase) DeleteCheckout(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.checkout(id)
+	if c == nil {
+		return fmt.Errorf("%w: checkout id %d", ErrNotFound, id)
+	}
+	done, err := m.audit().change(AuditDelete, TableCheckouts, id)
+	if err != nil {
+		return err
+	}
+	c.DeletedAt = deletionTime()
+	return done()
+}
+
+func (m *memoryDatabase) ListDeletedCheckouts() ([]*Checkout, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.listCheckouts(true), nil
+}
+
+// deletedCheckout returns the checkout in the trash, or ErrNotFound.
+func (m *memoryDatabase) deletedCheckout(id int64) (*Checkout, error) {
+	c, ok := m.checkouts[id]
+	if !ok || c.DeletedAt.IsZero() {
+		return nil, fmt.Errorf("%w: deleted checkouts id %d", ErrNotFound, id)
+	}
+	return c, nil
+}
+
+func (m *memoryDatabase) UndeleteCheckout(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, err := m.deletedCheckout(id)
+	if err != nil {
+		return err
+	}
+	remaining, err := m.remaining(c.Contribution)
+	if err != nil {
+		return err
+	}
+	if c.Twelfths > remaining {
+		return &InsufficientStockError{
+			Contribution: c.Contribution,
+			Requested:    c.Twelfths,
+			Remaining:    remaining,
+		}
+	}
+	c.DeletedAt = time.Time{}
+	return m.audit().added(AuditRestore, TableCheckouts, id)
+}
+
+// removeCheckout removes a checkout, unlinking suggestions confirmed by it.
+func (m *memoryDatabase) removeCheckout(id int64) {
+	delete(m.checkouts, id)
+	for _, sg := range m.suggestions {
+		if sg.Checkout == id {
+			sg.Checkout = 0
+		}
+	}
+}
+
+func (m *memoryDatabase) PurgeCheckout(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.deletedCheckout(id); err != nil {
+		return err
+	}
+	done, err := m.audit().change(AuditPurge, TableCheckouts, id)
+	if err != nil {
+		return err
+	}
+	m.removeCheckout(id)
+	return done()
+}
+
+func (m *memoryDatabase) ContributionRemaining(id int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.remaining(id)
+}
+
+// beerRemaining returns the twelfths left of a beer.
+func (m *memoryDatabase) beerRemaining(id int64) int64 {
+	var remaining int64
+	for cid, c := range m.contributions {
+		if c.Beer == id && c.DeletedAt.IsZero() {
+			r, _ := m.remaining(cid)
+			remaining += r
+		}
+	}
+	return remaining
+}
+
+func (m *memoryDatabase) BeerRemaining(id int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.beerRemaining(id), nil
+}
+
+func (m *memoryDatabase) ListContributionsRemaining() (map[int64]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	remaining := map[int64]int64{}
+	for id, c := range m.contributions {
+		if c.DeletedAt.IsZero() {
+			remaining[id], _ = m.remaining(id)
+		}
+	}
+	return remaining, nil
+}
+
+func (m *memoryDatabase) ListBeersRemaining() (map[int64]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	remaining := map[int64]int64{}
+	for id, c := range m.contributions {
+		if c.DeletedAt.IsZero() {
+			r, _ := m.remaining(id)
+			remaining[c.Beer] += r
+		}
+	}
+	return remaining, nil
+}
+
+// balance returns the balance of a user, or ErrNotFound.
+func (m *memoryDatabase) balance(user int64) (*Balance, error) {
+	u, ok := m.users[user]
+	if !ok {
+		return nil, fmt.Errorf("%w: user id %d", ErrNotFound, user)
+	}
+	b := &Balance{User: user, SeedFund: u.SeedFund}
+	for _, c := range m.contributions {
+		if c.User == user && c.DeletedAt.IsZero() {
+			b.Added += c.UnitPrice * Money(c.Quantity)
+		}
+	}
+	for _, co := range m.checkouts {
+		if co.User != user || !co.DeletedAt.IsZero() {
+			continue
+		}
+		if c := m.contribution(co.Contribution); c != nil {
+			b.Taken += c.UnitPrice.Twelfths(co.Twelfths)
+		}
+	}
+	for _, dc := range m.debitCredits {
+		if dc.User == user && dc.DeletedAt.IsZero() {
+			b.DebitCredit += dc.Amount
+		}
+	}
+	return b, nil
+}
+
+// balances returns the net positions of the users.
+func (m *memoryDatabase) balances(users []int64) (map[int64]Money, error) {
+	positions := map[int64]Money{}
+	for _, u := range users {
+		b, err := m.balance(u)
+		if err != nil {
+			return nil, err
+		}
+		positions[u] = b.NetPosition()
+	}
+	return positions, nil
+}
+
+func (m *memoryDatabase) ListBalances() ([]*Balance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var bals []*Balance
+	for _, u := range m.listUsers() {
+		b, err := m.balance(u.ID)
+		if err != nil {
+			return nil, err
+		}
+		bals = append(bals, b)
+	}
+	return bals, nil
+}
+
+func (m *memoryDatabase) GetBalance(user int64) (*Balance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.balance(user)
+}
+
+// subscription returns a copy of the stored subscription.
+func subscription(s *Subscription) *Subscription {
+	c := *s
+	c.Muted = splitEvents(joinEvents(s.Muted))
+	return &c
+}
+
+// listSubscriptions returns copies of the subscriptions in the order they
+// were added.
+func (m *memoryDatabase) listSubscriptions() []*Subscription {
+	var subs []*Subscription
+	for _, s := range m.subscriptions {
+		subs = append(subs, subscription(s))
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].ID < subs[j].ID })
+	return subs
+}
+
+func (m *memoryDatabase) ListSubscriptions() ([]*Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.listSubscriptions(), nil
+}
+
+func (m *memoryDatabase) AddSubscription(s *Subscription) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[s.User]; s.User != 0 && !ok {
+		return 0, errNoReference("users", s.User)
+	}
+	var highest int64
+	for id := range m.subscriptions {
+		if id > highest {
+			highest = id
+		}
+	}
+	c := subscription(s)
+	c.ID = m.autoID("subscriptions", highest)
+	m.subscriptions[c.ID] = c
+	return c.ID, nil
+}
+
+func (m *memoryDatabase) DeleteSubscription(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.subscriptions[id]; !ok {
+		return errNotChanged("subscriptions", id)
+	}
+	delete(m.subscriptions, id)
+	for did, dl := range m.deliveries {
+		if dl.Subscription == id {
+			delete(m.deliveries, did)
+		}
+	}
+	return nil
+}
+
+func (m *memoryDatabase) ClaimSubscriptions(cookie string, user int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var claimed []*Subscription
+	for _, s := range m.subscriptions {
+		if s.Cookie == cookie {
+			claimed = append(claimed, s)
+		}
+	}
+	if _, ok := m.users[user]; len(claimed) > 0 && user != 0 && !ok {
+		return 0, errNoReference("users", user)
+	}
+	for _, s := range claimed {
+		s.User = user
+	}
+	return int64(len(claimed)), nil
+}
+
+func (m *memoryDatabase) SetSubscriptionMuted(id int64, muted []EventType) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.subscriptions[id]
+	if !ok {
+		return fmt.Errorf("%w: subscription id %d", ErrNotFound, id)
+	}
+	s.Muted = splitEvents(joinEvents(muted))
+	return nil
+}
+
+// enqueue adds deliveries of the events to the outbox for every
+// subscription wanting them.
+func (m *memoryDatabase) enqueue(events []*Event) {
+	if len(events) == 0 {
+		return
+	}
+	subs := m.listSubscriptions()
+	var highest int64
+	for id := range m.deliveries {
+		if id > highest {
+			highest = id
+		}
+	}
+	now := unixTime(time.Now())
+	for _, e := range events {
+		if e.Cookie == "" && m.actor != nil {
+			e.Cookie = m.actor.Cookie
+		}
+		for _, sub := range subs {
+			if !sub.Wants(e) {
+				continue
+			}
+			dl := &Delivery{
+				ID:           m.autoID("outbox", highest),
+				Subscription: sub.ID,
+				Event:        Event{Type: e.Type, User: e.User, Record: e.Record},
+				Created:      now,
+				NextAttempt:  now,
+			}
+			m.deliveries[dl.ID] = dl
+		}
+	}
+}
+
+// listDeliveries returns copies of the deliveries for which keep returns
+// true, oldest first, up to limit if it is not negative.
+func (m *memoryDatabase) listDeliveries(keep func(*Delivery) bool, limit int) []*Delivery {
+	var dls []*Delivery
+	for _, dl := range m.deliveries {
+		if keep(dl) {
+			c := *dl
+			dls = append(dls, &c)
+		}
+	}
+	sort.Slice(dls, func(i, j int) bool { return dls[i].ID < dls[j].ID })
+	if limit >= 0 && len(dls) > limit {
+		dls = dls[:limit]
+	}
+	return dls
+}
+
+func (m *memoryDatabase) ListDeliveries() ([]*Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.listDeliveries(func(*Delivery) bool { return true }, -1), nil
+}
+
+func (m *memoryDatabase) DueDeliveries(by time.Time, limit int) ([]*Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.listDeliveries(func(dl *Delivery) bool {
+		return !dl.Failed && dl.NextAttempt.Unix() <= by.Unix()
+	}, limit), nil
+}
+
+// delivery returns the delivery, or ErrNotFound.
+func (m *memoryDatabase) delivery(id int64) (*Delivery, error) {
+	dl, ok := m.deliveries[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: delivery id %d", ErrNotFound, id)
+	}
+	return dl, nil
+}
+
+func (m *memoryDatabase) FailDelivery(id int64, reason string, retry time.Time, dead bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dl, err := m.delivery(id)
+	if err != nil {
+		return err
+	}
+	dl.Attempts++
+	dl.LastError, dl.NextAttempt, dl.Failed = reason, unixTime(retry), dead
+	return nil
+}
+
+func (m *memoryDatabase) RetryDelivery(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dl, err := m.delivery(id)
+	if err != nil {
+		return err
+	}
+	dl.Failed, dl.NextAttempt = false, unixTime(time.Now())
+	return nil
+}
+
+func (m *memoryDatabase) DeleteDelivery(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.delivery(id); err != nil {
+		return err
+	}
+	delete(m.deliveries, id)
+	return nil
+}
+
+func (m *memoryDatabase) AddSuggestion(sg *Suggestion) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[sg.User]; !ok {
+		return 0, errNoReference("users", sg.User)
+	}
+	if _, ok := m.beers[sg.Beer]; !ok {
+		return 0, errNoReference("beers", sg.Beer)
+	}
+	var highest int64
+	for id, s := range m.suggestions {
+		if s.User == sg.User && s.Checkin == sg.Checkin {
+			return 0, fmt.Errorf("%w: check-in %d of user id %d", ErrExists, sg.Checkin, sg.User)
+		}
+		if id > highest {
+			highest = id
+		}
+	}
+	c := &Suggestion{
+		ID:      m.autoID("suggestions", highest),
+		User:    sg.User,
+		Checkin: sg.Checkin,
+		Beer:    sg.Beer,
+		Date:    unixTime(sg.Date),
+		State:   SuggestionPending,
+	}
+	m.suggestions[c.ID] = c
+	return c.ID, nil
+}
+
+func (m *memoryDatabase) GetSuggestion(id int64) (*Suggestion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sg, ok := m.suggestions[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: suggestion id %d", ErrNotFound, id)
+	}
+	c := *sg
+	return &c, nil
+}
+
+func (m *memoryDatabase) ListSuggestions(user int64, state SuggestionState) ([]*Suggestion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var sgs []*Suggestion
+	for _, sg := range m.suggestions {
+		if (user == 0 || sg.User == user) && sg.State == state {
+			c := *sg
+			sgs = append(sgs, &c)
+		}
+	}
+	sort.Slice(sgs, func(i, j int) bool {
+		if !sgs[i].Date.Equal(sgs[j].Date) {
+			return sgs[i].Date.After(sgs[j].Date)
+		}
+		return sgs[i].ID > sgs[j].ID
+	})
+	return sgs, nil
+}
+
+// pendingSuggestion returns the pending suggestion, or ErrNotFound.
+func (m *memoryDatabase) pendingSuggestion(id int64) (*Suggestion, error) {
+	sg, ok := m.suggestions[id]
+	if !ok || sg.State != SuggestionPending {
+		return nil, fmt.Errorf("%w: pending suggestion id %d", ErrNotFound, id)
+	}
+	return sg, nil
+}
+
+func (m *memoryDatabase) ConfirmSuggestion(id, twelfths int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sg, err := m.pendingSuggestion(id)
+	if err != nil {
+		return 0, err
+	}
+	var conts []*Contribution
+	for _, c := range m.contributions {
+		if c.Beer == sg.Beer && c.DeletedAt.IsZero() {
+			conts = append(conts, c)
+		}
+	}
+	sort.Slice(conts, func(i, j int) bool {
+		if !conts[i].Date.Equal(conts[j].Date) {
+			return conts[i].Date.Before(conts[j].Date)
+		}
+		return conts[i].ID < conts[j].ID
+	})
+	var cont, most int64
+	for _, c := range conts {
+		remaining, _ := m.remaining(c.ID)
+		if remaining <= 0 {
+			continue
+		}
+		if remaining >= twelfths {
+			cont = c.ID
+			break
+		}
+		if remaining > most {
+			most = remaining
+		}
+	}
+	if cont == 0 {
+		return 0, &InsufficientStockError{Beer: sg.Beer, Requested: twelfths, Remaining: most}
+	}
+	ids, err := m.addCheckouts([]*Checkout{{
+		User:         sg.User,
+		Contribution: cont,
+		Twelfths:     twelfths,
+		Date:         sg.Date,
+	}})
+	if err != nil {
+		return 0, err
+	}
+	sg.State, sg.Checkout = SuggestionConfirmed, ids[0]
+	return ids[0], nil
+}
+
+func (m *memoryDatabase) DismissSuggestion(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sg, err := m.pendingSuggestion(id)
+	if err != nil {
+		return err
+	}
+	sg.State = SuggestionDismissed
+	return nil
+}
+
+// listDebitCredits returns copies of the debits/credits in or out of the
+// trash, in the order the SQLite database lists them.
+func (m *memoryDatabase) listDebitCredits(deleted bool) []*DebitCredit {
+	var dcs []*DebitCredit
+	for _, dc := range m.debitCredits {
+		if dc.DeletedAt.IsZero() != deleted {
+			c := *dc
+			dcs = append(dcs, &c)
+		}
+	}
+	sort.Slice(dcs, func(i, j int) bool {
+		if deleted && !dcs[i].DeletedAt.Equal(dcs[j].DeletedAt) {
+			return dcs[i].DeletedAt.After(dcs[j].DeletedAt)
+		}
+		return dcs[i].ID < dcs[j].ID
+	})
+	return dcs
+}
+
+func (m *memoryDatabase) ListDebitCredits() ([]*DebitCredit, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.listDebitCredits(false), nil
+}
+
+// debitCredit returns the debit/credit not in the trash, or nil.
+func (m *memoryDatabase) debitCredit(id int64) *DebitCredit {
+	if dc, ok := m.debitCredits[id]; ok && dc.DeletedAt.IsZero() {
+		return dc
+	}
+	return nil
+}
+
+func (m *memoryDatabase) GetDebitCredit(id int64) (*DebitCredit, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dc := m.debitCredit(id)
+	if dc == nil {
+		return nil, fmt.Errorf("%w: debit/credit id %d", ErrNotFound, id)
+	}
+	c := *dc
+	return &c, nil
+}
+
+func (m *memoryDatabase) AddDebitCredit(dc *DebitCredit) (int64, error) {
+	ids, err := m.AddDebitCredits([]*DebitCredit{dc})
+	if err != nil {
+		return 0, err
+	}
+	return ids[0], nil
+}
+
+func (m *memoryDatabase) AddDebitCredits(dcs []*DebitCredit) ([]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var users []int64
+	for _, dc := range dcs {
+		users = append(users, dc.User)
+	}
+	before, err := m.balances(users)
+	if err != nil {
+		return nil, err
+	}
+	var highest int64
+	for id := range m.debitCredits {
+		if id > highest {
+			highest = id
+		}
+	}
+	ids := make([]int64, 0, len(dcs))
+	var events []*Event
+	for _, dc := range dcs {
+		c := &DebitCredit{
+			ID:      m.autoID("debitsCredits", highest),
+			User:    dc.User,
+			Amount:  dc.Amount,
+			Date:    unixTime(dc.Date),
+			Comment: dc.Comment,
+		}
+		m.debitCredits[c.ID] = c
+		ids = append(ids, c.ID)
+		events = append(events, &Event{Type: EventDebitCredit, User: dc.User, Record: c.ID})
+	}
+	if err := m.audit().added(AuditInsert, TableDebitCredits, ids...); err != nil {
+		return nil, err
+	}
+	after, err := m.balances(users)
+	if err != nil {
+		return nil, err
+	}
+	events = append(events, negativeBalanceEvents(users, before, after)...)
+	m.enqueue(events)
+	return ids, nil
+}
+
+func (m *memoryDatabase) EditDebitCredit(dc *DebitCredit) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.debitCredit(dc.ID)
+	if c == nil {
+		return errNotChanged("debitsCredits", dc.ID)
+	}
+	done, err := m.audit().change(AuditEdit, TableDebitCredits, dc.ID)
+	if err != nil {
+		return err
+	}
+	c.Amount, c.Comment = dc.Amount, dc.Comment
+	return done()
+}
+
+func (m *memoryDatabase) DeleteDebitCredit(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dc := m.debitCredit(id)
+	if dc == nil {
+		return fmt.Errorf("%w: debit/credit id %d", ErrNotFound, id)
+	}
+	done, err := m.audit().change(AuditDelete, TableDebitCredits, id)
+	if err != nil {
+		return err
+	}
+	dc.DeletedAt = deletionTime()
+	return done()
+}
+
+func (m *memoryDatabase) ListDeletedDebitCredits() ([]*DebitCredit, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.listDebitCredits(true), nil
+}
+
+// deletedDebitCredit returns the debit/credit in the trash, or ErrNotFound.
+func (m *memoryDatabase) deletedDebitCredit(id int64) (*DebitCredit, error) {
+	dc, ok := m.debitCredits[id]
+	if !ok || dc.DeletedAt.IsZero() {
+		return nil, fmt.Errorf("%w: deleted debitsCredits id %d", ErrNotFound, id)
+	}
+	return dc, nil
+}
+
+func (m *memoryDatabase) UndeleteDebitCredit(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dc, err := m.deletedDebitCredit(id)
+	if err != nil {
+		return err
+	}
+	dc.DeletedAt = time.Time{}
+	return m.audit().added(AuditRestore, TableDebitCredits, id)
+}
+
+func (m *memoryDatabase) PurgeDebitCredit(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.deletedDebitCredit(id); err != nil {
+		return err
+	}
+	done, err := m.audit().change(AuditPurge, TableDebitCredits, id)
+	if err != nil {
+		return err
+	}
+	delete(m.debitCredits, id)
+	return done()
+}
+
+func (m *memoryDatabase) RestoreBeer(b *Beer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.beers[b.ID]; ok {
+		return fmt.Errorf("%w: beers id %d", ErrExists, b.ID)
+	}
+	c := &Beer{ID: b.ID}
+	setBeer(c, b)
+	m.beers[c.ID] = c
+	return m.audit().added(AuditRestore, TableBeers, c.ID)
+}
+
+func (m *memoryDatabase) RestoreUser(u *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[u.ID]; ok {
+		return fmt.Errorf("%w: users id %d", ErrExists, u.ID)
+	}
+	c := &User{ID: u.ID}
+	setUser(c, u)
+	m.users[c.ID] = c
+	return m.audit().added(AuditRestore, TableUsers, c.ID)
+}
+
+func (m *memoryDatabase) GetPasswordHash(user int64) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[user]; !ok {
+		return "", fmt.Errorf("%w: user id %d", ErrNotFound, user)
+	}
+	return m.passwordHash[user], nil
+}
+
+func (m *memoryDatabase) SetPasswordHash(user int64, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.setPasswordHash(user, hash)
+}
+
+func (m *memoryDatabase) setPasswordHash(user int64, hash string) error {
+	if _, ok := m.users[user]; !ok {
+		return fmt.Errorf("%w: user id %d", ErrNotFound, user)
+	}
+	if hash == "" {
+		delete(m.passwordHash, user)
+	} else {
+		m.passwordHash[user] = hash
+	}
+	for token, s := range m.sessions {
+		if s.User == user {
+			delete(m.sessions, token)
+		}
+	}
+	return m.audit().record(AuditPassword, TableUsers, user, nil, nil)
+}
+
+func (m *memoryDatabase) AddLoginSession(s *LoginSession) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[s.User]; !ok {
+		return errNoReference("users", s.User)
+	}
+	if _, ok := m.sessions[s.TokenHash]; ok {
+		return fmt.Errorf("memory: login session already exists")
+	}
+	m.sessions[s.TokenHash] = &LoginSession{TokenHash: s.TokenHash, User: s.User, Expires: unixTime(s.Expires)}
+	return nil
+}
+
+func (m *memoryDatabase) GetLoginSession(tokenHash string) (*LoginSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[tokenHash]
+	if !ok {
+		return nil, fmt.Errorf("%w: login session", ErrNotFound)
+	}
+	c := *s
+	return &c, nil
+}
+
+func (m *memoryDatabase) DeleteLoginSession(tokenHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, tokenHash)
+	return nil
+}
+
+func (m *memoryDatabase) AddAuditEntry(e *AuditEntry) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.addAuditEntry(e), nil
+}
+
+func (m *memoryDatabase) addAuditEntry(e *AuditEntry) int64 {
+	c := *e
+	c.ID = m.autoID("audit", 0)
+	c.Time = unixTime(e.Time)
+	m.auditEntries = append(m.auditEntries, &c)
+	return c.ID
+}
+
+// audited returns a copy of the database which records the changes made
+// through it in the audit log, attributed to the actor.
+func (m *memoryDatabase) audited(actor Actor) BeerDatabase {
+	return &memoryDatabase{memoryStore: m.memoryStore, actor: &actor}
+}
+
+// audit returns the audit log of the changes being made with the lock held,
+// or nil if the database is not audited.
+func (m *memoryDatabase) audit() *auditLog {
+	return newAuditLog(m.actor, memoryAuditTx{m})
+}
+
+// memoryAuditTx reads and records audited records with the lock held.
+type memoryAuditTx struct {
+	m *memoryDatabase
+}
+
+func (a memoryAuditTx) getRecord(table string, id int64) (interface{}, error) {
+	m := a.m
+	switch table {
+	case TableUsers:
+		if u, ok := m.users[id]; ok {
+			return m.user(u), nil
+		}
+	case TableBeers:
+		if b, ok := m.beers[id]; ok {
+			c := *b
+			return &c, nil
+		}
+	case TableContributions:
+		if c := m.contribution(id); c != nil {
+			cc := *c
+			return &cc, nil
+		}
+	case TableCheckouts:
+		if c := m.checkout(id); c != nil {
+			cc := *c
+			return &cc, nil
+		}
+	case TableDebitCredits:
+		if dc := m.debitCredit(id); dc != nil {
+			c := *dc
+			return &c, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown table %q", table)
+	}
+	return nil, fmt.Errorf("%w: %s id %d", ErrNotFound, table, id)
+}
+
+func (a memoryAuditTx) getDeleted(table string, id int64) (interface{}, error) {
+	m := a.m
+	switch table {
+	case TableContributions:
+		if c, err := m.deletedContribution(id); err == nil {
+			cc := *c
+			return &cc, nil
+		}
+	case TableCheckouts:
+		if c, err := m.deletedCheckout(id); err == nil {
+			cc := *c
+			return &cc, nil
+		}
+	case TableDebitCredits:
+		if dc, err := m.deletedDebitCredit(id); err == nil {
+			c := *dc
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+func (a memoryAuditTx) addAuditEntry(e *AuditEntry) error {
+	a.m.addAuditEntry(e)
+	return nil
+}
+
+func (m *memoryDatabase) ListAuditEntries(before int64, limit int) ([]*AuditEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var entries []*AuditEntry
+	for i := len(m.auditEntries) - 1; i >= 0 && (limit < 0 || len(entries) < limit); i-- {
+		if e := m.auditEntries[i]; before == 0 || e.ID < before {
+			c := *e
+			entries = append(entries, &c)
+		}
+	}
+	return entries, nil
+}
+
+func (m *memoryDatabase) GetAuditEntry(id int64) (*AuditEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.auditEntries {
+		if e.ID == id {
+			c := *e
+			return &c, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: audit entry id %d", ErrNotFound, id)
+}
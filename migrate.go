@@ -0,0 +1,357 @@
+package syndicate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrSchemaTooNew is returned when opening a database that has been migrated
+// by a newer version of the syndicate than this one.
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+
+// migration is a numbered change to the database schema.
+type migration struct {
+	version     int
+	description string
+	stmt        string
+}
+
+// migrations are applied in order to bring a database up to the current
+// schema. New migrations must be appended with the next version number;
+// never edit or reorder one that has already been released.
+var migrations = []migration{
+	{1, "initial schema", initialSchemaStmt},
+	{2, "balance indexes", balanceIndexesStmt},
+	{3, "retired users", retiredUsersStmt},
+	{4, "audit log", auditLogStmt},
+	{5, "soft delete", softDeleteStmt},
+	{6, "foreign keys", foreignKeysStmt},
+	{7, "user login", userLoginStmt},
+	{8, "subscription users", subscriptionUsersStmt},
+	{9, "notification preferences", notificationPrefsStmt},
+	{10, "notification outbox", outboxStmt},
+	{11, "checkin suggestions", suggestionsStmt},
+	{12, "beer refresh", beerRefreshStmt},
+	{13, "audit user", auditUserStmt},
+}
+
+// Databases created before schema versioning already contain these tables,
+// so they must be created only if they do not exist.
+const initialSchemaStmt = `
+CREATE TABLE IF NOT EXISTS users(
+  id INTEGER PRIMARY KEY,
+  name TEXT,
+  untappdid TEXT,
+  seedfund INTEGER
+);
+CREATE TABLE IF NOT EXISTS beers(
+  id INTEGER PRIMARY KEY,
+  brewery TEXT,
+  name TEXT,
+  untappdid INTEGER,
+  untappdrating INTEGER,
+  breweryid INTEGER,
+  labelURL TEXT
+);
+CREATE TABLE IF NOT EXISTS contributions(
+  id INTEGER PRIMARY KEY,
+  user INTEGER,
+  beer INTEGER,
+  quantity INTEGER,
+  date INTEGER,
+  unitprice INTEGER,
+  comment TEXT
+);
+CREATE TABLE IF NOT EXISTS checkouts(
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user INTEGER,
+  contribution INTEGER,
+  quantity REAL,
+  twelfths INTEGER,
+  date INTEGER
+);
+CREATE TABLE IF NOT EXISTS subscriptions(
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  endpoint TEXT,
+  key TEXT,
+  auth TEXT,
+  userAgent TEXT,
+  host TEXT,
+  cookie TEXT
+);
+CREATE TABLE IF NOT EXISTS debitsCredits(
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user INTEGER,
+  amount INTEGER,
+  date INTEGER,
+  comment TEXT
+);
+`
+
+const balanceIndexesStmt = `
+CREATE INDEX contributions_user ON contributions(user);
+CREATE INDEX contributions_beer ON contributions(beer);
+CREATE INDEX checkouts_user ON checkouts(user);
+CREATE INDEX checkouts_contribution ON checkouts(contribution);
+CREATE INDEX debitsCredits_user ON debitsCredits(user);
+`
+
+const retiredUsersStmt = `
+ALTER TABLE users ADD COLUMN retired INTEGER NOT NULL DEFAULT 0;
+`
+
+// The audit log is append-only, which the triggers enforce.
+const auditLogStmt = `
+CREATE TABLE audit(
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  time INTEGER,
+  action TEXT,
+  tablename TEXT,
+  record INTEGER,
+  beforejson TEXT,
+  afterjson TEXT,
+  remoteaddr TEXT,
+  cookie TEXT
+);
+CREATE INDEX audit_record ON audit(tablename, record);
+CREATE TRIGGER audit_no_update BEFORE UPDATE ON audit
+BEGIN
+  SELECT RAISE(ABORT, 'audit log is append-only');
+END;
+CREATE TRIGGER audit_no_delete BEFORE DELETE ON audit
+BEGIN
+  SELECT RAISE(ABORT, 'audit log is append-only');
+END;
+`
+
+// Deleted contributions, checkouts and debits/credits are kept in the trash
+// until purged, with the unix time in nanoseconds they were deleted. The
+// checkouts deleted along with a contribution share its deleted_at, so it
+// must be fine enough not to match checkouts deleted on their own.
+const softDeleteStmt = `
+ALTER TABLE contributions ADD COLUMN deleted_at INTEGER;
+ALTER TABLE checkouts ADD COLUMN deleted_at INTEGER;
+ALTER TABLE debitsCredits ADD COLUMN deleted_at INTEGER;
+`
+
+// SQLite can only add foreign keys by rebuilding the tables. Existing rows
+// are copied as they are, so a database with orphans still migrates and
+// CheckIntegrity can then report and repair them.
+const foreignKeysStmt = `
+CREATE TABLE new_contributions(
+  id INTEGER PRIMARY KEY,
+  user INTEGER REFERENCES users(id),
+  beer INTEGER REFERENCES beers(id),
+  quantity INTEGER,
+  date INTEGER,
+  unitprice INTEGER,
+  comment TEXT,
+  deleted_at INTEGER
+);
+INSERT INTO new_contributions
+  SELECT id, user, beer, quantity, date, unitprice, comment, deleted_at FROM contributions;
+DROP TABLE contributions;
+ALTER TABLE new_contributions RENAME TO contributions;
+CREATE INDEX contributions_user ON contributions(user);
+CREATE INDEX contributions_beer ON contributions(beer);
+
+CREATE TABLE new_checkouts(
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user INTEGER REFERENCES users(id),
+  contribution INTEGER REFERENCES contributions(id),
+  quantity REAL,
+  twelfths INTEGER,
+  date INTEGER,
+  deleted_at INTEGER
+);
+INSERT INTO new_checkouts
+  SELECT id, user, contribution, quantity, twelfths, date, deleted_at FROM checkouts;
+DROP TABLE checkouts;
+ALTER TABLE new_checkouts RENAME TO checkouts;
+CREATE INDEX checkouts_user ON checkouts(user);
+CREATE INDEX checkouts_contribution ON checkouts(contribution);
+
+CREATE TABLE new_debitsCredits(
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user INTEGER REFERENCES users(id),
+  amount INTEGER,
+  date INTEGER,
+  comment TEXT,
+  deleted_at INTEGER
+);
+INSERT INTO new_debitsCredits
+  SELECT id, user, amount, date, comment, deleted_at FROM debitsCredits;
+DROP TABLE debitsCredits;
+ALTER TABLE new_debitsCredits RENAME TO debitsCredits;
+CREATE INDEX debitsCredits_user ON debitsCredits(user);
+`
+
+// Users who can log in have a bcrypt hash of their PIN or password. Login
+// sessions are keyed by a hash of the token in the browser's cookie.
+const userLoginStmt = `
+ALTER TABLE users ADD COLUMN passwordhash TEXT;
+CREATE TABLE sessions(
+  tokenhash TEXT PRIMARY KEY,
+  user INTEGER NOT NULL REFERENCES users(id),
+  expires INTEGER
+);
+CREATE INDEX sessions_user ON sessions(user);
+`
+
+const subscriptionUsersStmt = `
+ALTER TABLE subscriptions ADD COLUMN user INTEGER REFERENCES users(id);
+CREATE INDEX subscriptions_cookie ON subscriptions(cookie);
+`
+
+const notificationPrefsStmt = `
+ALTER TABLE subscriptions ADD COLUMN muted TEXT;
+`
+
+const outboxStmt = `
+CREATE TABLE outbox(
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  subscription INTEGER NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+  event TEXT,
+  user INTEGER,
+  record INTEGER,
+  created INTEGER,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  nextattempt INTEGER,
+  lasterror TEXT,
+  failed INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX outbox_due ON outbox(failed, nextattempt);
+CREATE INDEX outbox_subscription ON outbox(subscription);
+`
+
+// Suggestions are Untappd check-ins of beers in the syndicate, offered to
+// the user to confirm as checkouts. A check-in is only suggested once.
+const suggestionsStmt = `
+CREATE TABLE suggestions(
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  checkin INTEGER NOT NULL,
+  beer INTEGER NOT NULL REFERENCES beers(id) ON DELETE CASCADE,
+  date INTEGER,
+  state TEXT NOT NULL DEFAULT 'pending',
+  checkout INTEGER REFERENCES checkouts(id) ON DELETE SET NULL,
+  UNIQUE(user, checkin)
+);
+CREATE INDEX suggestions_beer ON suggestions(beer);
+CREATE INDEX suggestions_checkout ON suggestions(checkout);
+`
+
+// Beers remember when their details were last refreshed from the catalog,
+// and the ratings seen, in hundredths like beers.untappdrating.
+const beerRefreshStmt = `
+ALTER TABLE beers ADD COLUMN refreshed INTEGER;
+CREATE TABLE ratings(
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  beer INTEGER NOT NULL REFERENCES beers(id) ON DELETE CASCADE,
+  date INTEGER,
+  rating INTEGER
+);
+CREATE INDEX ratings_beer ON ratings(beer);
+`
+
+// The user logged in when a change was made is recorded in the audit log.
+const auditUserStmt = `
+ALTER TABLE audit ADD COLUMN user INTEGER;
+`
+
+const createSchemaVersionStmt = `
+CREATE TABLE IF NOT EXISTS schema_version(
+  version INTEGER PRIMARY KEY,
+  description TEXT,
+  applied INTEGER
+)`
+
+const schemaVersionStmt = `SELECT IFNULL(MAX(version), 0) FROM schema_version`
+
+const addSchemaVersionStmt = `
+INSERT INTO schema_version(version, description, applied) VALUES (?, ?, ?)`
+
+// rowQuerier is implemented by *sql.DB, *sql.Conn and *sql.Tx.
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// schemaVersion returns the version of the current database schema.
+func schemaVersion(q rowQuerier) (int, error) {
+	var version int
+	if err := q.QueryRowContext(context.Background(), schemaVersionStmt).Scan(&version); err != nil {
+		return 0, fmt.Errorf("sql: could not read schema version: %v", err)
+	}
+	return version, nil
+}
+
+// migrate applies any pending migrations to the database, each in its own
+// transaction.
+//
+// Foreign keys are not enforced while migrating, as tables must be dropped
+// and rebuilt to change their constraints. The pragma has no effect inside a
+// transaction, so it is set on a connection kept for the migrations.
+func migrate(db *sql.DB) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("sql: could not get connection: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF`); err != nil {
+		return fmt.Errorf("sql: could not disable foreign keys: %v", err)
+	}
+	defer conn.ExecContext(ctx, `PRAGMA foreign_keys = ON`)
+
+	if _, err := conn.ExecContext(ctx, createSchemaVersionStmt); err != nil {
+		return fmt.Errorf("sql: could not create schema_version: %v", err)
+	}
+	current, err := schemaVersion(conn)
+	if err != nil {
+		return err
+	}
+	latest := migrations[len(migrations)-1].version
+	if current > latest {
+		return fmt.Errorf("%w: database is version %d, latest known is %d", ErrSchemaTooNew, current, latest)
+	}
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := applyMigration(conn, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyMigration applies a single migration and records it in schema_version.
+func applyMigration(conn *sql.Conn, m migration) error {
+	tx, err := conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("sql: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Another process may have migrated the database since it was checked.
+	current, err := schemaVersion(tx)
+	if err != nil {
+		return err
+	}
+	if m.version <= current {
+		return nil
+	}
+	if _, err := tx.Exec(m.stmt); err != nil {
+		return fmt.Errorf("sql: migration %d (%s) failed: %v", m.version, m.description, err)
+	}
+	if _, err := tx.Exec(addSchemaVersionStmt, m.version, m.description, time.Now().Unix()); err != nil {
+		return fmt.Errorf("sql: could not record migration %d: %v", m.version, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sql: could not commit migration %d: %v", m.version, err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package syndicate
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestMigrateFresh(t *testing.T) {
+	d := openTestDB(t)
+	version, err := schemaVersion(d.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := migrations[len(migrations)-1].version; version != want {
+		t.Errorf("got schema version %d, want %d", version, want)
+	}
+}
+
+func TestMigrationsOrdered(t *testing.T) {
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Errorf("migration %q has version %d, want %d", m.description, m.version, i+1)
+		}
+	}
+}
+
+func TestMigrateUnversioned(t *testing.T) {
+	path := tempDBPath(t)
+
+	// Databases from before schema versioning have tables and data but no
+	// schema_version table.
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(initialSchemaStmt); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO users(name, untappdid) VALUES ('alice', 'al')`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	d := &database{}
+	if err := d.Open(path); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer d.Close()
+	users, err := d.ListUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].Name != "alice" {
+		t.Errorf("got users %+v after migration, want alice", users)
+	}
+}
+
+func TestMigrateTooNew(t *testing.T) {
+	path := tempDBPath(t)
+	d := &database{}
+	if err := d.Open(path); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	future := migrations[len(migrations)-1].version + 1
+	if _, err := d.db.Exec(addSchemaVersionStmt, future, "from the future", 0); err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+
+	d = &database{}
+	err := d.Open(path)
+	if !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Open: got error %v, want ErrSchemaTooNew", err)
+	}
+}
@@ -0,0 +1,115 @@
+package syndicate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount of money, in cents.
+//
+// Wherever money is divided, such as pricing a twelfth of a beer or
+// splitting a total price across a quantity, the result is rounded to the
+// nearest cent with exact halves rounded away from zero.
+type Money int64
+
+// ParseMoney parses a dollar amount as entered in a form, such as "4.99",
+// "$12" or "-3.5". Amounts with more than two decimal places are rounded to
+// the nearest cent, with halves rounded away from zero.
+func ParseMoney(s string) (Money, error) {
+	v := strings.TrimSpace(s)
+	neg := false
+	if strings.HasPrefix(v, "-") {
+		neg = true
+		v = v[1:]
+	} else if strings.HasPrefix(v, "+") {
+		v = v[1:]
+	}
+	v = strings.TrimPrefix(v, "$")
+	v = strings.Replace(v, ",", "", -1)
+
+	whole, frac := v, ""
+	if i := strings.IndexByte(v, '.'); i >= 0 {
+		whole, frac = v[:i], v[i+1:]
+	}
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	for _, r := range whole + frac {
+		if r < '0' || r > '9' {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+	}
+
+	var dollars int64
+	if whole != "" {
+		var err error
+		if dollars, err = strconv.ParseInt(whole, 10, 64); err != nil {
+			return 0, fmt.Errorf("invalid amount %q: %v", s, err)
+		}
+	}
+	// Pad or truncate the fraction to three digits; the third is only used
+	// for rounding.
+	frac = (frac + "000")[:3]
+	milli, _ := strconv.ParseInt(frac, 10, 64)
+	cents := dollars*100 + milli/10
+	if milli%10 >= 5 {
+		cents++
+	}
+	if neg {
+		cents = -cents
+	}
+	return Money(cents), nil
+}
+
+// Cents returns the amount in cents.
+func (m Money) Cents() int64 {
+	return int64(m)
+}
+
+// Negative returns true if the amount is less than zero.
+func (m Money) Negative() bool {
+	return m < 0
+}
+
+// Decimal returns the amount as a plain decimal number of dollars, such as
+// "-4.99", suitable for form inputs.
+func (m Money) Decimal() string {
+	sign := ""
+	c := int64(m)
+	if c < 0 {
+		sign = "-"
+		c = -c
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, c/100, c%100)
+}
+
+// String returns the amount formatted for display, such as "-$4.99".
+func (m Money) String() string {
+	if m < 0 {
+		return "-$" + (-m).Decimal()
+	}
+	return "$" + m.Decimal()
+}
+
+// Div returns the amount divided by n, rounded to the nearest cent.
+func (m Money) Div(n int64) Money {
+	return Money(divRound(int64(m), n))
+}
+
+// Twelfths returns the value of the given number of twelfths, where m is
+// the price of a whole unit, rounded to the nearest cent.
+func (m Money) Twelfths(twelfths int64) Money {
+	return Money(divRound(int64(m)*twelfths, 12))
+}
+
+// divRound divides a by b, rounding halves away from zero.
+func divRound(a, b int64) int64 {
+	if b < 0 {
+		a, b = -a, -b
+	}
+	if a < 0 {
+		return -((-a*2 + b) / (b * 2))
+	}
+	return (a*2 + b) / (b * 2)
+}
@@ -0,0 +1,88 @@
+package syndicate
+
+import "testing"
+
+func TestParseMoney(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want Money
+	}{
+		{"4.99", 499},
+		{"$4.99", 499},
+		{" 12 ", 1200},
+		{"0.5", 50},
+		{".05", 5},
+		{"-3.5", -350},
+		{"-$3.50", -350},
+		{"1,234.56", 123456},
+		{"4.994", 499},
+		{"4.995", 500},
+		{"-4.995", -500},
+	} {
+		got, err := ParseMoney(tc.in)
+		if err != nil {
+			t.Errorf("ParseMoney(%q): %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseMoney(%q) = %d, want %d", tc.in, got, tc.want)
+		}
+	}
+	for _, in := range []string{"", "$", ".", "abc", "1.2.3", "4-5", "--1"} {
+		if got, err := ParseMoney(in); err == nil {
+			t.Errorf("ParseMoney(%q) = %d, want error", in, got)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	for _, tc := range []struct {
+		in           Money
+		str, decimal string
+	}{
+		{0, "$0.00", "0.00"},
+		{5, "$0.05", "0.05"},
+		{499, "$4.99", "4.99"},
+		{-1250, "-$12.50", "-12.50"},
+	} {
+		if got := tc.in.String(); got != tc.str {
+			t.Errorf("Money(%d).String() = %q, want %q", tc.in, got, tc.str)
+		}
+		if got := tc.in.Decimal(); got != tc.decimal {
+			t.Errorf("Money(%d).Decimal() = %q, want %q", tc.in, got, tc.decimal)
+		}
+	}
+}
+
+func TestMoneyDivision(t *testing.T) {
+	for _, tc := range []struct {
+		price    Money
+		twelfths int64
+		want     Money
+	}{
+		{1200, 6, 600},
+		{499, 6, 250},  // 249.5 rounds up.
+		{499, 4, 166},  // 166.33 rounds down.
+		{1000, 3, 250}, // Exact.
+		{100, 1, 8},    // 8.33 rounds down.
+		{-499, 6, -250},
+	} {
+		if got := tc.price.Twelfths(tc.twelfths); got != tc.want {
+			t.Errorf("Money(%d).Twelfths(%d) = %d, want %d", tc.price, tc.twelfths, got, tc.want)
+		}
+	}
+	for _, tc := range []struct {
+		total Money
+		n     int64
+		want  Money
+	}{
+		{2000, 4, 500},
+		{1000, 3, 333},
+		{500, 3, 167},
+		{-500, 3, -167},
+	} {
+		if got := tc.total.Div(tc.n); got != tc.want {
+			t.Errorf("Money(%d).Div(%d) = %d, want %d", tc.total, tc.n, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package syndicate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EventType is a kind of change that subscribers can be notified of.
+type EventType string
+
+// Notification event types.
+const (
+	// EventContribution is a new contribution, sent to everyone.
+	EventContribution EventType = "contribution"
+	// EventTapped is a checkout from a contribution, sent to its
+	// contributor.
+	EventTapped EventType = "tapped"
+	// EventNegativeBalance is a user's net position going below zero, sent
+	// to the user.
+	EventNegativeBalance EventType = "negative-balance"
+	// EventOutOfStock is the last of a beer being checked out, sent to
+	// everyone.
+	EventOutOfStock EventType = "out-of-stock"
+	// EventDebitCredit is a debit or credit added for a user, sent to the
+	// user.
+	EventDebitCredit EventType = "debit-credit"
+)
+
+// EventTypes are all the event types, in the order they are offered to
+// subscribers.
+var EventTypes = []EventType{
+	EventContribution,
+	EventTapped,
+	EventOutOfStock,
+	EventNegativeBalance,
+	EventDebitCredit,
+}
+
+// Description describes the event type for subscribers choosing which they
+// receive.
+func (t EventType) Description() string {
+	switch t {
+	case EventContribution:
+		return "New contributions"
+	case EventTapped:
+		return "Others check out beer you contributed"
+	case EventNegativeBalance:
+		return "Your balance goes negative"
+	case EventOutOfStock:
+		return "A beer runs out"
+	case EventDebitCredit:
+		return "A debit or credit is added for you"
+	}
+	return string(t)
+}
+
+// ForUser returns true if events of the type are addressed to a single user.
+func (t EventType) ForUser() bool {
+	return t == EventTapped || t == EventNegativeBalance || t == EventDebitCredit
+}
+
+// Event is a change that subscribers are notified of.
+type Event struct {
+	// Type is the kind of change.
+	Type EventType
+	// User is the user the event is addressed to, or 0 for everyone.
+	User int64
+	// From is the user who caused the event, who need not be told of it, or
+	// 0. It is not kept in the outbox.
+	From int64
+	// Cookie is the cookie of the browser which caused the event, or empty.
+	// It stands in for From with subscriptions not claimed by a user. It is
+	// not kept in the outbox.
+	Cookie string
+	// Record is the id of the record the event is about: the contribution,
+	// checkout, user, beer or debit/credit, depending on the type.
+	Record int64
+}
+
+// Notification returns the message and link to notify subscribers of the
+// event, or ErrNotFound if its record has since been deleted.
+func (e *Event) Notification(db BeerDatabase) (message, uri string, err error) {
+	switch e.Type {
+	case EventContribution:
+		cont, err := db.GetContribution(e.Record)
+		if err != nil {
+			return "", "", err
+		}
+		user, err := db.GetUser(cont.User)
+		if err != nil {
+			return "", "", err
+		}
+		beer, err := db.GetBeer(cont.Beer)
+		if err != nil {
+			return "", "", err
+		}
+		return fmt.Sprintf("%s just added %d of %s (%s)", user.Name, cont.Quantity, beer.Name, beer.Brewery),
+			fmt.Sprintf("/contribute/detail/%d", cont.ID), nil
+	case EventTapped:
+		co, err := db.GetCheckout(e.Record)
+		if err != nil {
+			return "", "", err
+		}
+		cont, err := db.GetContribution(co.Contribution)
+		if err != nil {
+			return "", "", err
+		}
+		user, err := db.GetUser(co.User)
+		if err != nil {
+			return "", "", err
+		}
+		beer, err := db.GetBeer(cont.Beer)
+		if err != nil {
+			return "", "", err
+		}
+		return fmt.Sprintf("%s checked out %s of the %s you contributed", user.Name, bottles(co.Twelfths), beer.Name),
+			fmt.Sprintf("/contribute/detail/%d", cont.ID), nil
+	case EventNegativeBalance:
+		b, err := db.GetBalance(e.Record)
+		if err != nil {
+			return "", "", err
+		}
+		return fmt.Sprintf("Your balance is now %s", b.NetPosition()), "/users", nil
+	case EventOutOfStock:
+		beer, err := db.GetBeer(e.Record)
+		if err != nil {
+			return "", "", err
+		}
+		return fmt.Sprintf("The last of %s (%s) has been checked out", beer.Name, beer.Brewery), "/beers", nil
+	case EventDebitCredit:
+		dc, err := db.GetDebitCredit(e.Record)
+		if err != nil {
+			return "", "", err
+		}
+		kind := "credit"
+		if dc.Amount < 0 {
+			kind = "debit"
+		}
+		message = fmt.Sprintf("A %s of %s was added for you", kind, dc.Amount)
+		if dc.Comment != "" {
+			message += ": " + dc.Comment
+		}
+		return message, fmt.Sprintf("/debitcredit/%d", dc.User), nil
+	}
+	return "", "", fmt.Errorf("unknown event type %q", e.Type)
+}
+
+// bottles describes a quantity in twelfths of a bottle in words.
+func bottles(twelfths int64) string {
+	switch twelfths {
+	case 3:
+		return "a quarter of a bottle"
+	case 4:
+		return "a third of a bottle"
+	case 6:
+		return "half a bottle"
+	case 12:
+		return "a bottle"
+	}
+	if twelfths < 12 {
+		return twelfthsStr(twelfths) + " of a bottle"
+	}
+	return twelfthsStr(twelfths) + " bottles"
+}
+
+// Mutes returns true if the subscriber has chosen not to receive events of
+// the type.
+func (s *Subscription) Mutes(t EventType) bool {
+	for _, m := range s.Muted {
+		if m == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Wants returns true if the event should be sent to the subscriber.
+func (s *Subscription) Wants(e *Event) bool {
+	if s.Mutes(e.Type) {
+		return false
+	}
+	// Subscribers need not be told of what they did themselves.
+	switch {
+	case s.User != 0 && e.From == s.User:
+		return false
+	case s.User == 0 && e.Cookie != "" && e.Cookie == s.Cookie:
+		return false
+	}
+	return e.User == 0 || e.User == s.User
+}
+
+// joinEvents encodes event types for storing in the database.
+func joinEvents(types []EventType) string {
+	s := make([]string, len(types))
+	for i, t := range types {
+		s[i] = string(t)
+	}
+	return strings.Join(s, ",")
+}
+
+// splitEvents decodes event types stored by joinEvents.
+func splitEvents(s string) []EventType {
+	if s == "" {
+		return nil
+	}
+	var types []EventType
+	for _, t := range strings.Split(s, ",") {
+		types = append(types, EventType(t))
+	}
+	return types
+}
+
+// negativeBalanceEvents returns events for the users whose net position
+// has gone below zero, given their positions before and after a change.
+func negativeBalanceEvents(users []int64, before, after map[int64]Money) []*Event {
+	var events []*Event
+	seen := map[int64]bool{}
+	for _, u := range users {
+		if seen[u] {
+			continue
+		}
+		seen[u] = true
+		if before[u] >= 0 && after[u] < 0 {
+			events = append(events, &Event{Type: EventNegativeBalance, User: u, Record: u})
+		}
+	}
+	return events
+}
@@ -0,0 +1,187 @@
+package syndicate
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutbox(t *testing.T) {
+	d := openTestDB(t)
+	alice, err := d.AddUser(&User{Name: "alice"})
+	if err != nil {
+		t.Fatalf("AddUser: %v", err)
+	}
+	bob, err := d.AddUser(&User{Name: "bob"})
+	if err != nil {
+		t.Fatalf("AddUser: %v", err)
+	}
+	beer, err := d.AddBeer(&Beer{Name: "Pale Ale", Brewery: "Brewery"})
+	if err != nil {
+		t.Fatalf("AddBeer: %v", err)
+	}
+	subs := map[int64]string{}
+	for _, sub := range []*Subscription{
+		{Endpoint: "https://push/alice", User: alice},
+		{Endpoint: "https://push/bob", User: bob},
+		{Endpoint: "https://push/anon", Cookie: "anon"},
+	} {
+		id, err := d.AddSubscription(sub)
+		if err != nil {
+			t.Fatalf("AddSubscription: %v", err)
+		}
+		subs[id] = sub.Endpoint[len("https://push/"):]
+	}
+	// expect checks the outbox holds the events for the subscribers, given
+	// as "event subscriber", then empties it.
+	expect := func(want ...string) {
+		t.Helper()
+		dls, err := d.DueDeliveries(time.Now(), 100)
+		if err != nil {
+			t.Fatalf("DueDeliveries: %v", err)
+		}
+		var got []string
+		for _, dl := range dls {
+			got = append(got, fmt.Sprintf("%s %s", dl.Event.Type, subs[dl.Subscription]))
+			if err := d.DeleteDelivery(dl.ID); err != nil {
+				t.Fatalf("DeleteDelivery: %v", err)
+			}
+		}
+		if strings.Join(got, ", ") != strings.Join(want, ", ") {
+			t.Errorf("outbox = %q, want %q", got, want)
+		}
+	}
+
+	// The contributor is not told of their own contribution.
+	cont, err := d.AddContribution(&Contribution{User: alice, Beer: beer, Quantity: 1, UnitPrice: 1200, Date: time.Now()})
+	if err != nil {
+		t.Fatalf("AddContribution: %v", err)
+	}
+	expect("contribution bob", "contribution anon")
+
+	ids, err := d.AddCheckouts([]*Checkout{
+		{User: alice, Contribution: cont, Twelfths: 6, Date: time.Now()},
+		{User: bob, Contribution: cont, Twelfths: 6, Date: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("AddCheckouts: %v", err)
+	}
+	expect("tapped alice",
+		"out-of-stock alice", "out-of-stock bob", "out-of-stock anon",
+		"negative-balance bob")
+	msg, uri, err := (&Event{Type: EventTapped, User: alice, Record: ids[1]}).Notification(d)
+	if want := "bob checked out half a bottle of the Pale Ale you contributed"; err != nil || msg != want {
+		t.Errorf("Notification = %q, %v; want %q", msg, err, want)
+	}
+	if want := fmt.Sprintf("/contribute/detail/%d", cont); uri != want {
+		t.Errorf("Notification URI = %q, want %q", uri, want)
+	}
+
+	// Failed changes add nothing to the outbox.
+	if _, err := d.AddCheckouts([]*Checkout{{User: bob, Contribution: cont, Twelfths: 1, Date: time.Now()}}); err == nil {
+		t.Errorf("AddCheckouts from an empty contribution succeeded")
+	}
+	expect()
+
+	// Nor is the browser which made a change, when nobody claimed it.
+	if _, err := Audited(d, Actor{Cookie: "anon"}).AddContribution(&Contribution{User: alice, Beer: beer, Quantity: 1, UnitPrice: 1200, Date: time.Now()}); err != nil {
+		t.Fatalf("AddContribution: %v", err)
+	}
+	expect("contribution bob")
+
+	// A credit leaving bob still negative notifies only of the credit.
+	if _, err := d.AddDebitCredit(&DebitCredit{User: bob, Amount: 100, Date: time.Now()}); err != nil {
+		t.Fatalf("AddDebitCredit: %v", err)
+	}
+	dls, err := d.DueDeliveries(time.Now(), 100)
+	if err != nil || len(dls) != 1 || dls[0].Event.Type != EventDebitCredit || subs[dls[0].Subscription] != "bob" {
+		t.Fatalf("DueDeliveries = %+v, %v; want debit-credit to bob", dls, err)
+	}
+
+	// Failed deliveries wait until retried, and dead ones until retried
+	// by hand.
+	dl := dls[0].ID
+	if err := d.FailDelivery(dl, "unreachable", time.Now().Add(time.Hour), false); err != nil {
+		t.Fatalf("FailDelivery: %v", err)
+	}
+	if dls, err := d.DueDeliveries(time.Now(), 100); err != nil || len(dls) != 0 {
+		t.Errorf("DueDeliveries after failure = %+v, %v; want none", dls, err)
+	}
+	if err := d.FailDelivery(dl, "unreachable", time.Now(), true); err != nil {
+		t.Fatalf("FailDelivery: %v", err)
+	}
+	if dls, err := d.DueDeliveries(time.Now(), 100); err != nil || len(dls) != 0 {
+		t.Errorf("DueDeliveries after giving up = %+v, %v; want none", dls, err)
+	}
+	if all, err := d.ListDeliveries(); err != nil || len(all) != 1 || !all[0].Failed || all[0].Attempts != 2 || all[0].LastError != "unreachable" {
+		t.Errorf("ListDeliveries = %+v, %v; want one failed after 2 attempts", all, err)
+	}
+	if err := d.RetryDelivery(dl); err != nil {
+		t.Fatalf("RetryDelivery: %v", err)
+	}
+	if dls, err := d.DueDeliveries(time.Now(), 100); err != nil || len(dls) != 1 {
+		t.Errorf("DueDeliveries after retry = %+v, %v; want 1", dls, err)
+	}
+
+	// Removing a subscription removes its deliveries.
+	if err := d.DeleteSubscription(dls[0].Subscription); err != nil {
+		t.Fatalf("DeleteSubscription: %v", err)
+	}
+	if all, err := d.ListDeliveries(); err != nil || len(all) != 0 {
+		t.Errorf("ListDeliveries after DeleteSubscription = %+v, %v; want none", all, err)
+	}
+}
+
+func TestSubscriptionWants(t *testing.T) {
+	d := openTestDB(t)
+	alice, err := d.AddUser(&User{Name: "alice"})
+	if err != nil {
+		t.Fatalf("AddUser: %v", err)
+	}
+	id, err := d.AddSubscription(&Subscription{Endpoint: "https://push/1", Cookie: "phone", User: alice})
+	if err != nil {
+		t.Fatalf("AddSubscription: %v", err)
+	}
+	if err := d.SetSubscriptionMuted(id, []EventType{EventContribution, EventOutOfStock}); err != nil {
+		t.Fatalf("SetSubscriptionMuted: %v", err)
+	}
+	subs, err := d.ListSubscriptions()
+	if err != nil || len(subs) != 1 {
+		t.Fatalf("ListSubscriptions = %v, %v; want 1 subscription", subs, err)
+	}
+	sub := subs[0]
+	for _, tc := range []struct {
+		event Event
+		want  bool
+	}{
+		{Event{Type: EventContribution}, false},
+		{Event{Type: EventOutOfStock}, false},
+		{Event{Type: EventTapped, User: alice}, true},
+		{Event{Type: EventTapped, User: alice + 1}, false},
+		{Event{Type: EventDebitCredit, User: alice}, true},
+		{Event{Type: EventTapped, From: alice}, false},
+		{Event{Type: EventTapped, From: alice + 1, Cookie: "phone"}, true},
+	} {
+		if got := sub.Wants(&tc.event); got != tc.want {
+			t.Errorf("Wants(%+v) = %v, want %v", tc.event, got, tc.want)
+		}
+	}
+
+	// Subscriptions without a user are not told of their browser's changes.
+	unclaimed := &Subscription{Cookie: "laptop"}
+	for _, tc := range []struct {
+		event Event
+		want  bool
+	}{
+		{Event{Type: EventTapped}, true},
+		{Event{Type: EventTapped, Cookie: "laptop"}, false},
+		{Event{Type: EventTapped, Cookie: "phone"}, true},
+		{Event{Type: EventContribution, From: alice, Cookie: "laptop"}, false},
+		{Event{Type: EventContribution, From: alice, Cookie: "phone"}, true},
+	} {
+		if got := unclaimed.Wants(&tc.event); got != tc.want {
+			t.Errorf("unclaimed Wants(%+v) = %v, want %v", tc.event, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package syndicate
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// The PostgreSQL conformance tests run against the server whose data source
+// name is in $SYNDICATE_TEST_POSTGRES, or else a throwaway server started
+// with the initdb and pg_ctl on the path. They are skipped if there is
+// neither, unless $SYNDICATE_REQUIRE_POSTGRES is set, as it is in CI, when
+// they fail instead.
+var (
+	testPostgresOnce sync.Once
+	testPostgresDSN  string
+	testPostgresErr  error
+	testPostgresStop func()
+	testPostgresDBs  int32
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if testPostgresStop != nil {
+		testPostgresStop()
+	}
+	os.Exit(code)
+}
+
+// startPostgres starts a PostgreSQL server in a temporary directory,
+// listening only on a socket there, and returns its data source name.
+func startPostgres() (dsn string, stop func(), err error) {
+	initdb, err := exec.LookPath("initdb")
+	if err != nil {
+		return "", nil, err
+	}
+	pgCtl, err := exec.LookPath("pg_ctl")
+	if err != nil {
+		return "", nil, err
+	}
+	dir, err := ioutil.TempDir("", "syndicate-postgres")
+	if err != nil {
+		return "", nil, err
+	}
+	data := filepath.Join(dir, "data")
+	if out, err := exec.Command(initdb, "-D", data, "-U", "postgres", "-A", "trust", "--no-sync").CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("initdb: %v: %s", err, out)
+	}
+	opts := fmt.Sprintf("-k %s -c listen_addresses='' -c fsync=off", dir)
+	if out, err := exec.Command(pgCtl, "-D", data, "-o", opts, "-l", filepath.Join(dir, "log"), "-w", "start").CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("pg_ctl start: %v: %s", err, out)
+	}
+	stop = func() {
+		exec.Command(pgCtl, "-D", data, "-m", "immediate", "-w", "stop").Run()
+		os.RemoveAll(dir)
+	}
+	return fmt.Sprintf("host=%s user=postgres dbname=postgres sslmode=disable", dir), stop, nil
+}
+
+// withDBName returns the data source name with the database name replaced.
+func withDBName(dsn, name string) string {
+	if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		u.Path = "/" + name
+		return u.String()
+	}
+	return dsn + " dbname=" + name
+}
+
+// openTestPostgres opens a fresh PostgreSQL database, dropped at the end of
+// the test.
+func openTestPostgres(t testing.TB) *pgDatabase {
+	t.Helper()
+	testPostgresOnce.Do(func() {
+		if testPostgresDSN = os.Getenv("SYNDICATE_TEST_POSTGRES"); testPostgresDSN == "" {
+			testPostgresDSN, testPostgresStop, testPostgresErr = startPostgres()
+		}
+	})
+	if testPostgresErr != nil {
+		if os.Getenv("SYNDICATE_REQUIRE_POSTGRES") != "" {
+			t.Fatalf("no PostgreSQL server: %v", testPostgresErr)
+		}
+		t.Skipf("no PostgreSQL server: %v", testPostgresErr)
+	}
+	admin, err := sql.Open("postgres", testPostgresDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+	name := fmt.Sprintf("syndicate_test_%d_%d", os.Getpid(), atomic.AddInt32(&testPostgresDBs, 1))
+	if _, err := admin.Exec(`CREATE DATABASE ` + name); err != nil {
+		t.Fatalf("CREATE DATABASE: %v", err)
+	}
+	d := &pgDatabase{}
+	t.Cleanup(func() {
+		if d.db != nil {
+			d.db.Close()
+		}
+		if _, err := admin.Exec(`DROP DATABASE ` + name); err != nil {
+			t.Errorf("DROP DATABASE: %v", err)
+		}
+	})
+	if err := d.Open(withDBName(testPostgresDSN, name)); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	return d
+}
+
+func TestPostgresMigrationsMatch(t *testing.T) {
+	if len(pgMigrations) != len(migrations) {
+		t.Fatalf("%d PostgreSQL migrations, want %d", len(pgMigrations), len(migrations))
+	}
+	for i, m := range migrations {
+		if pg := pgMigrations[i]; pg.version != m.version || pg.description != m.description {
+			t.Errorf("PostgreSQL migration %d (%s), want %d (%s)", pg.version, pg.description, m.version, m.description)
+		}
+	}
+}
+
+func TestPostgresMigrateTwice(t *testing.T) {
+	d := openTestPostgres(t)
+	if err := migratePostgres(d.db); err != nil {
+		t.Fatalf("migrating again: %v", err)
+	}
+	var version int
+	if err := d.db.QueryRow(pgSchemaVersionStmt).Scan(&version); err != nil || version != len(pgMigrations) {
+		t.Errorf("schema version = %d, %v; want %d", version, err, len(pgMigrations))
+	}
+	if _, err := d.AddAuditEntry(&AuditEntry{Action: "add", Table: "users", Record: 1}); err != nil {
+		t.Fatalf("AddAuditEntry: %v", err)
+	}
+	if _, err := d.db.Exec(`DELETE FROM audit`); err == nil || !strings.Contains(err.Error(), "append-only") {
+		t.Errorf("DELETE FROM audit = %v, want append-only error", err)
+	}
+}
@@ -0,0 +1,272 @@
+package syndicate
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// pgMigrations are the migrations for PostgreSQL, with the same versions
+// and descriptions as the SQLite ones so that both schemas move in step.
+// Each must leave the schema equivalent to its SQLite counterpart.
+var pgMigrations = []migration{
+	{1, "initial schema", pgInitialSchemaStmt},
+	{2, "balance indexes", pgBalanceIndexesStmt},
+	{3, "retired users", pgRetiredUsersStmt},
+	{4, "audit log", pgAuditLogStmt},
+	{5, "soft delete", pgSoftDeleteStmt},
+	{6, "foreign keys", pgForeignKeysStmt},
+	{7, "user login", pgUserLoginStmt},
+	{8, "subscription users", pgSubscriptionUsersStmt},
+	{9, "notification preferences", pgNotificationPrefsStmt},
+	{10, "notification outbox", pgOutboxStmt},
+	{11, "checkin suggestions", pgSuggestionsStmt},
+	{12, "beer refresh", pgBeerRefreshStmt},
+	{13, "audit user", pgAuditUserStmt},
+}
+
+// Ids are given out by identity columns. They are BY DEFAULT so that
+// restored records keep their ids.
+const pgInitialSchemaStmt = `
+CREATE TABLE users(
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  name TEXT,
+  untappdid TEXT,
+  seedfund BIGINT
+);
+CREATE TABLE beers(
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  brewery TEXT,
+  name TEXT,
+  untappdid BIGINT,
+  untappdrating BIGINT,
+  breweryid BIGINT,
+  labelurl TEXT
+);
+CREATE TABLE contributions(
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  "user" BIGINT,
+  beer BIGINT,
+  quantity BIGINT,
+  date BIGINT,
+  unitprice BIGINT,
+  comment TEXT
+);
+CREATE TABLE checkouts(
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  "user" BIGINT,
+  contribution BIGINT,
+  quantity DOUBLE PRECISION,
+  twelfths BIGINT,
+  date BIGINT
+);
+CREATE TABLE subscriptions(
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  endpoint TEXT,
+  key TEXT,
+  auth TEXT,
+  useragent TEXT,
+  host TEXT,
+  cookie TEXT
+);
+CREATE TABLE debitscredits(
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  "user" BIGINT,
+  amount BIGINT,
+  date BIGINT,
+  comment TEXT
+);
+`
+
+const pgBalanceIndexesStmt = `
+CREATE INDEX contributions_user ON contributions("user");
+CREATE INDEX contributions_beer ON contributions(beer);
+CREATE INDEX checkouts_user ON checkouts("user");
+CREATE INDEX checkouts_contribution ON checkouts(contribution);
+CREATE INDEX debitscredits_user ON debitscredits("user");
+`
+
+const pgRetiredUsersStmt = `
+ALTER TABLE users ADD COLUMN retired BOOLEAN NOT NULL DEFAULT false;
+`
+
+// The audit log is append-only, which the triggers enforce.
+const pgAuditLogStmt = `
+CREATE TABLE audit(
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  time BIGINT,
+  action TEXT,
+  tablename TEXT,
+  record BIGINT,
+  beforejson TEXT,
+  afterjson TEXT,
+  remoteaddr TEXT,
+  cookie TEXT
+);
+CREATE INDEX audit_record ON audit(tablename, record);
+CREATE FUNCTION audit_append_only() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'audit log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER audit_no_update BEFORE UPDATE ON audit
+  FOR EACH ROW EXECUTE PROCEDURE audit_append_only();
+CREATE TRIGGER audit_no_delete BEFORE DELETE ON audit
+  FOR EACH ROW EXECUTE PROCEDURE audit_append_only();
+`
+
+// deleted_at is the unix time in nanoseconds, as in SQLite.
+const pgSoftDeleteStmt = `
+ALTER TABLE contributions ADD COLUMN deleted_at BIGINT;
+ALTER TABLE checkouts ADD COLUMN deleted_at BIGINT;
+ALTER TABLE debitscredits ADD COLUMN deleted_at BIGINT;
+`
+
+// The foreign keys are not validated against existing rows, so that a
+// database with orphans still migrates, as SQLite's rebuilt tables do.
+const pgForeignKeysStmt = `
+ALTER TABLE contributions
+  ADD FOREIGN KEY ("user") REFERENCES users(id) NOT VALID,
+  ADD FOREIGN KEY (beer) REFERENCES beers(id) NOT VALID;
+ALTER TABLE checkouts
+  ADD FOREIGN KEY ("user") REFERENCES users(id) NOT VALID,
+  ADD FOREIGN KEY (contribution) REFERENCES contributions(id) NOT VALID;
+ALTER TABLE debitscredits
+  ADD FOREIGN KEY ("user") REFERENCES users(id) NOT VALID;
+`
+
+const pgUserLoginStmt = `
+ALTER TABLE users ADD COLUMN passwordhash TEXT;
+CREATE TABLE sessions(
+  tokenhash TEXT PRIMARY KEY,
+  "user" BIGINT NOT NULL REFERENCES users(id),
+  expires BIGINT
+);
+CREATE INDEX sessions_user ON sessions("user");
+`
+
+const pgSubscriptionUsersStmt = `
+ALTER TABLE subscriptions ADD COLUMN "user" BIGINT REFERENCES users(id);
+CREATE INDEX subscriptions_cookie ON subscriptions(cookie);
+`
+
+const pgNotificationPrefsStmt = `
+ALTER TABLE subscriptions ADD COLUMN muted TEXT;
+`
+
+const pgOutboxStmt = `
+CREATE TABLE outbox(
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  subscription BIGINT NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+  event TEXT,
+  "user" BIGINT,
+  record BIGINT,
+  created BIGINT,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  nextattempt BIGINT,
+  lasterror TEXT,
+  failed BOOLEAN NOT NULL DEFAULT false
+);
+CREATE INDEX outbox_due ON outbox(failed, nextattempt);
+CREATE INDEX outbox_subscription ON outbox(subscription);
+`
+
+const pgSuggestionsStmt = `
+CREATE TABLE suggestions(
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  "user" BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  checkin BIGINT NOT NULL,
+  beer BIGINT NOT NULL REFERENCES beers(id) ON DELETE CASCADE,
+  date BIGINT,
+  state TEXT NOT NULL DEFAULT 'pending',
+  checkout BIGINT REFERENCES checkouts(id) ON DELETE SET NULL,
+  UNIQUE("user", checkin)
+);
+CREATE INDEX suggestions_beer ON suggestions(beer);
+CREATE INDEX suggestions_checkout ON suggestions(checkout);
+`
+
+const pgBeerRefreshStmt = `
+ALTER TABLE beers ADD COLUMN refreshed BIGINT;
+CREATE TABLE ratings(
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  beer BIGINT NOT NULL REFERENCES beers(id) ON DELETE CASCADE,
+  date BIGINT,
+  rating BIGINT
+);
+CREATE INDEX ratings_beer ON ratings(beer);
+`
+
+const pgAuditUserStmt = `
+ALTER TABLE audit ADD COLUMN "user" BIGINT;
+`
+
+const pgCreateSchemaVersionStmt = `
+CREATE TABLE IF NOT EXISTS schema_version(
+  version INTEGER PRIMARY KEY,
+  description TEXT,
+  applied BIGINT
+)`
+
+const pgSchemaVersionStmt = `SELECT COALESCE(MAX(version), 0) FROM schema_version`
+
+const pgAddSchemaVersionStmt = `
+INSERT INTO schema_version(version, description, applied) VALUES ($1, $2, $3)`
+
+// migratePostgres applies any pending migrations to the PostgreSQL
+// database, each in its own transaction.
+func migratePostgres(db *sql.DB) error {
+	if _, err := db.Exec(pgCreateSchemaVersionStmt); err != nil {
+		return fmt.Errorf("sql: could not create schema_version: %v", err)
+	}
+	var current int
+	if err := db.QueryRow(pgSchemaVersionStmt).Scan(&current); err != nil {
+		return fmt.Errorf("sql: could not read schema version: %v", err)
+	}
+	latest := pgMigrations[len(pgMigrations)-1].version
+	if current > latest {
+		return fmt.Errorf("%w: database is version %d, latest known is %d", ErrSchemaTooNew, current, latest)
+	}
+	for _, m := range pgMigrations {
+		if m.version <= current {
+			continue
+		}
+		if err := applyPostgresMigration(db, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyPostgresMigration applies a single migration and records it in
+// schema_version.
+func applyPostgresMigration(db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("sql: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Another process may be migrating the database too, so wait for it
+	// and check again.
+	if _, err := tx.Exec(`LOCK TABLE schema_version IN EXCLUSIVE MODE`); err != nil {
+		return fmt.Errorf("sql: could not lock schema_version: %v", err)
+	}
+	var current int
+	if err := tx.QueryRow(pgSchemaVersionStmt).Scan(&current); err != nil {
+		return fmt.Errorf("sql: could not read schema version: %v", err)
+	}
+	if m.version <= current {
+		return nil
+	}
+	if _, err := tx.Exec(m.stmt); err != nil {
+		return fmt.Errorf("sql: migration %d (%s) failed: %v", m.version, m.description, err)
+	}
+	if _, err := tx.Exec(pgAddSchemaVersionStmt, m.version, m.description, time.Now().Unix()); err != nil {
+		return fmt.Errorf("sql: could not record migration %d: %v", m.version, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sql: could not commit migration %d: %v", m.version, err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package syndicate
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+// RefreshStalestBeer refreshes the details of the beer refreshed longest ago
+// from the catalog, if that was before the given time. Beers without a
+// catalog ID are skipped, and one no longer in the catalog is logged and
+// marked refreshed unchanged. It returns the beer refreshed, or nil if none
+// was due.
+func RefreshStalestBeer(db BeerDatabase, catalog BeerCatalog, before time.Time) (*Beer, error) {
+	beers, err := db.ListBeers()
+	if err != nil {
+		return nil, err
+	}
+	var stalest *Beer
+	for _, b := range beers {
+		if b.UntappdID == 0 || !b.Refreshed.Before(before) {
+			continue
+		}
+		if stalest == nil || b.Refreshed.Before(stalest.Refreshed) {
+			stalest = b
+		}
+	}
+	if stalest == nil {
+		return nil, nil
+	}
+	b, err := RefreshFromCatalog(db, catalog, stalest)
+	if errors.Is(err, ErrNotFound) {
+		log.Printf("Beer %d is no longer in the catalog: %v", stalest.ID, err)
+		return stalest, nil
+	}
+	return b, err
+}
+
+// RefreshFromCatalog refreshes a beer's details from the catalog, returning
+// the beer as refreshed. A beer no longer in the catalog is marked refreshed
+// unchanged, and ErrNotFound returned.
+func RefreshFromCatalog(db BeerDatabase, catalog BeerCatalog, beer *Beer) (*Beer, error) {
+	info, err := catalog.Lookup(beer.UntappdID)
+	if errors.Is(err, ErrNotFound) {
+		if err := db.RefreshBeer(beer); err != nil {
+			return nil, err
+		}
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+	b := info.Beer()
+	b.ID = beer.ID
+	if err := db.RefreshBeer(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,66 @@
+package syndicate
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRefreshStalestBeer(t *testing.T) {
+	d := openTestDB(t)
+	catalog, err := OpenLocalCatalog(filepath.Join(filepath.Dir(tempDBPath(t)), "catalog.db"))
+	if err != nil {
+		t.Fatalf("OpenLocalCatalog: %v", err)
+	}
+	defer catalog.Close()
+	if err := catalog.Put([]*CatalogBeer{{ID: 100, Name: "Pale Ale", Brewery: "Brewery", Rating: 3.5}}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	ale, err := d.AddBeer(&Beer{Name: "Old name", UntappdID: 100, UntappdRating: 3})
+	if err != nil {
+		t.Fatalf("AddBeer: %v", err)
+	}
+	gone, err := d.AddBeer(&Beer{Name: "Gone", UntappdID: 200, UntappdRating: 4})
+	if err != nil {
+		t.Fatalf("AddBeer: %v", err)
+	}
+	if _, err := d.AddBeer(&Beer{Name: "Homebrew"}); err != nil {
+		t.Fatalf("AddBeer: %v", err)
+	}
+
+	// Each beer with a catalog ID is refreshed once, newest first, then
+	// none are due until later.
+	start := time.Now().Truncate(time.Second)
+	for _, want := range []int64{gone, ale, 0} {
+		b, err := RefreshStalestBeer(d, catalog, start)
+		if err != nil {
+			t.Fatalf("RefreshStalestBeer: %v", err)
+		}
+		if (b == nil && want != 0) || (b != nil && b.ID != want) {
+			t.Errorf("RefreshStalestBeer = %+v, want beer %d", b, want)
+		}
+	}
+	b, err := d.GetBeer(ale)
+	if err != nil || b.Name != "Pale Ale" || b.UntappdRating != 3.5 || b.Refreshed.Before(start) {
+		t.Errorf("GetBeer after refresh = %+v, %v", b, err)
+	}
+	if b, err := d.GetBeer(gone); err != nil || b.Name != "Gone" || b.Refreshed.IsZero() {
+		t.Errorf("GetBeer of beer not in catalog = %+v, %v; want unchanged but refreshed", b, err)
+	}
+
+	// Ratings are recorded when they change.
+	for _, rating := range []float64{3.5, 4.25, 4.25} {
+		b.UntappdRating = rating
+		if err := d.RefreshBeer(b); err != nil {
+			t.Fatalf("RefreshBeer: %v", err)
+		}
+	}
+	ratings, err := d.ListRatings(ale)
+	if err != nil || len(ratings) != 2 || ratings[0].Rating != 3.5 || ratings[1].Rating != 4.25 {
+		t.Errorf("ListRatings = %+v, %v; want 3.5 then 4.25", ratings, err)
+	}
+	if err := d.RefreshBeer(&Beer{ID: 999}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("RefreshBeer of a missing beer = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,167 @@
+package syndicate
+
+import "sort"
+
+// maxExactSettle is the largest number of users with a non-zero position for
+// which Settle searches for the minimum number of payments. Beyond this, the
+// search is too expensive and payments are matched greedily.
+const maxExactSettle = 20
+
+// Payment is a transfer of money from one user to another.
+type Payment struct {
+	// From is the user paying.
+	From int64
+	// To is the user being paid.
+	To int64
+	// Amount is the amount paid.
+	Amount Money
+}
+
+// Settle returns a set of payments which bring the given net positions, keyed
+// by user, to zero using as few payments as possible.
+//
+// The smallest number of payments is found by splitting the users into as many
+// groups as possible that each sum to zero, since a group of n users can
+// always be settled with n-1 payments. Each group is then settled by repeatedly
+// having the largest debtor pay the largest creditor.
+//
+// Positions normally sum to the value of beer not yet checked out, which
+// belongs to its contributors. That surplus cannot be settled by payments
+// between users, so it is left owing to creditors.
+func Settle(positions map[int64]Money) []*Payment {
+	var (
+		users []int64
+		total Money
+	)
+	for u, p := range positions {
+		if p != 0 {
+			users = append(users, u)
+			total += p
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i] < users[j] })
+
+	// Balance the positions with a stand-in for the unsettled surplus,
+	// whose payments are then dropped.
+	const surplus = -1
+	amounts := make([]Money, len(users), len(users)+1)
+	for i, u := range users {
+		amounts[i] = positions[u]
+	}
+	if total != 0 {
+		users = append(users, surplus)
+		amounts = append(amounts, -total)
+	}
+
+	var payments []*Payment
+	for _, group := range zeroSumGroups(amounts) {
+		for _, p := range settleGroup(group, users, amounts) {
+			if p.From != surplus && p.To != surplus {
+				payments = append(payments, p)
+			}
+		}
+	}
+	return payments
+}
+
+// zeroSumGroups partitions the indexes of amounts, which must sum to zero,
+// into as many groups summing to zero as possible.
+func zeroSumGroups(amounts []Money) [][]int {
+	n := len(amounts)
+	if n == 0 {
+		return nil
+	}
+	all := make([]int, n)
+	for i := range all {
+		all[i] = i
+	}
+	if n > maxExactSettle {
+		return [][]int{all}
+	}
+
+	// best[mask] is the most zero-sum groups that the users in mask can be
+	// split into, found by removing one user at a time and counting each
+	// zero-sum subset passed through on the way.
+	size := 1 << uint(n)
+	sum := make([]Money, size)
+	best := make([]int, size)
+	for mask := 1; mask < size; mask++ {
+		low := mask & -mask
+		i := 0
+		for 1<<uint(i) != low {
+			i++
+		}
+		sum[mask] = sum[mask^low] + amounts[i]
+		for j := 0; j < n; j++ {
+			if bit := 1 << uint(j); mask&bit != 0 && best[mask^bit] > best[mask] {
+				best[mask] = best[mask^bit]
+			}
+		}
+		if sum[mask] == 0 {
+			best[mask]++
+		}
+	}
+
+	// Walk back down the best path, splitting it at each zero-sum subset.
+	var groups [][]int
+	mask, prev := size-1, size-1
+	for mask != 0 {
+		want := best[mask]
+		if sum[mask] == 0 {
+			want--
+		}
+		for j := 0; j < n; j++ {
+			if bit := 1 << uint(j); mask&bit != 0 && best[mask^bit] == want {
+				mask ^= bit
+				break
+			}
+		}
+		if sum[mask] == 0 {
+			var group []int
+			for j := 0; j < n; j++ {
+				if (prev^mask)&(1<<uint(j)) != 0 {
+					group = append(group, j)
+				}
+			}
+			groups = append(groups, group)
+			prev = mask
+		}
+	}
+	return groups
+}
+
+// settleGroup returns payments settling a group of indexes into users and
+// amounts that sum to zero.
+func settleGroup(group []int, users []int64, amounts []Money) []*Payment {
+	var debtors, creditors []int
+	left := map[int]Money{}
+	for _, i := range group {
+		left[i] = amounts[i]
+		if amounts[i] < 0 {
+			debtors = append(debtors, i)
+		} else {
+			creditors = append(creditors, i)
+		}
+	}
+	var payments []*Payment
+	for len(debtors) > 0 && len(creditors) > 0 {
+		// Largest debtor and creditor first, lowest index on ties.
+		sort.SliceStable(debtors, func(a, b int) bool { return left[debtors[a]] < left[debtors[b]] })
+		sort.SliceStable(creditors, func(a, b int) bool { return left[creditors[a]] > left[creditors[b]] })
+		d, c := debtors[0], creditors[0]
+		amount := -left[d]
+		if left[c] < amount {
+			amount = left[c]
+		}
+		payments = append(payments, &Payment{From: users[d], To: users[c], Amount: amount})
+		left[d] += amount
+		left[c] -= amount
+		if left[d] == 0 {
+			debtors = debtors[1:]
+		}
+		if left[c] == 0 {
+			creditors = creditors[1:]
+		}
+	}
+	return payments
+}
@@ -0,0 +1,89 @@
+package syndicate
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// applyPayments returns the positions left after making the payments.
+func applyPayments(positions map[int64]Money, payments []*Payment) map[int64]Money {
+	left := map[int64]Money{}
+	for u, p := range positions {
+		left[u] = p
+	}
+	for _, p := range payments {
+		left[p.From] += p.Amount
+		left[p.To] -= p.Amount
+	}
+	return left
+}
+
+func TestSettle(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		positions map[int64]Money
+		payments  int
+	}{
+		{"empty", map[int64]Money{}, 0},
+		{"settled", map[int64]Money{1: 0, 2: 0}, 0},
+		{"pair", map[int64]Money{1: -500, 2: 500}, 1},
+		{"one to many", map[int64]Money{1: -900, 2: 300, 3: 600}, 2},
+		{"two pairs", map[int64]Money{1: -500, 2: -300, 3: 300, 4: 500}, 2},
+		// Greedy matching of largest debtor to largest creditor takes
+		// four payments here; {2,3} and {1,4,5} settle separately in three.
+		{"split groups", map[int64]Money{1: -500, 2: -400, 3: 400, 4: 300, 5: 200}, 3},
+	} {
+		payments := Settle(tc.positions)
+		if len(payments) != tc.payments {
+			t.Errorf("%s: got %d payments, want %d", tc.name, len(payments), tc.payments)
+		}
+		for u, p := range applyPayments(tc.positions, payments) {
+			if p != 0 {
+				t.Errorf("%s: user %d left with %v", tc.name, u, p)
+			}
+		}
+	}
+}
+
+func TestSettleSurplus(t *testing.T) {
+	// Users 3 and 4 are owed $2 more than is owing, for beer still in stock.
+	positions := map[int64]Money{1: -300, 2: -100, 3: 400, 4: 200}
+	payments := Settle(positions)
+	var owed Money
+	for u, p := range applyPayments(positions, payments) {
+		if p < 0 {
+			t.Errorf("user %d still owes %v", u, p)
+		}
+		owed += p
+	}
+	if owed != 200 {
+		t.Errorf("got %v left owing, want $2.00", owed)
+	}
+	for _, p := range payments {
+		if p.Amount <= 0 {
+			t.Errorf("payment of %v from %d to %d", p.Amount, p.From, p.To)
+		}
+	}
+}
+
+func TestSettleRandom(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, n := range []int{5, 12, 30} {
+		positions := map[int64]Money{}
+		var total Money
+		for u := int64(1); u < int64(n); u++ {
+			positions[u] = Money(rnd.Intn(20000) - 10000)
+			total += positions[u]
+		}
+		positions[int64(n)] = -total
+		payments := Settle(positions)
+		if len(payments) >= n {
+			t.Errorf("%d users: got %d payments, want fewer than %d", n, len(payments), n)
+		}
+		for u, p := range applyPayments(positions, payments) {
+			if p != 0 {
+				t.Errorf("%d users: user %d left with %v", n, u, p)
+			}
+		}
+	}
+}
@@ -117,22 +117,29 @@ $('.btn-type').click(function() {
 });
 
 
-const applicationServerPublicKey = 'BHVIXApfzS25EkHw0YvpE9rHK31lL57eEyZlFGDlaca7A8LYF9hsqZh8GyB1MBq1CCx8VzeHbjjj6RN9KYo9jSU';
+var applicationServerPublicKey;
 
 var isSubscribed = false;
 
 if ('serviceWorker' in navigator && 'PushManager' in window) {
       console.log('Service Worker and Push is supported');
 
-      navigator.serviceWorker.register('/static/sw.js')
-      .then(function(swReg) {
-              console.log('Service Worker is registered', swReg);
+      $.get('/vapid/public')
+      .done(function(key) {
+              applicationServerPublicKey = key;
+              navigator.serviceWorker.register('/static/sw.js')
+              .then(function(swReg) {
+                      console.log('Service Worker is registered', swReg);
 
-              swRegistration = swReg;
-              initializeUI();
+                      swRegistration = swReg;
+                      initializeUI();
+                    })
+              .catch(function(error) {
+                      console.error('Service Worker Error', error);
+                    });
             })
-      .catch(function(error) {
-              console.error('Service Worker Error', error);
+      .fail(function() {
+              console.warn('Push notifications are not set up on the server');
             });
 } else {
       console.warn('Push messaging is not supported');
@@ -152,7 +159,11 @@ function initializeUI() {
     .then(function(subscription) {
         isSubscribed = !(subscription === null);
 
-        if (isSubscribed) {
+        if (isSubscribed && !sameServerKey(subscription)) {
+            // The server's keys have been replaced, so subscribe again.
+            console.log('Server key changed, resubscribing');
+            subscription.unsubscribe().then(subscribeUser);
+        } else if (isSubscribed) {
             console.log('User is subscribed');
         } else {
             console.log('User not subscribed');
@@ -201,6 +212,24 @@ function urlBase64ToUint8Array(base64String) {
         return outputArray;
 }
 
+function sameServerKey(subscription) {
+    var key = subscription.options && subscription.options.applicationServerKey;
+    if (!key) {
+        return true;
+    }
+    var current = urlBase64ToUint8Array(applicationServerPublicKey);
+    var subKey = new Uint8Array(key);
+    if (subKey.length != current.length) {
+        return false;
+    }
+    for (var i = 0; i < subKey.length; ++i) {
+        if (subKey[i] != current[i]) {
+            return false;
+        }
+    }
+    return true;
+}
+
 function subscribeUser() {
     const applicationServerKey = urlBase64ToUint8Array(applicationServerPublicKey);
 
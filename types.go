@@ -1,6 +1,7 @@
 package syndicate
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -9,6 +10,21 @@ import (
 
 var fractions = []string{"", "¹⁄₁₂", "⅙", "¼", "⅓", "⁵⁄₁₂", "½", "⁷⁄₁₂", "⅔", "¾", "⅚", "¹¹⁄₁₂"}
 
+// twelfthsStr formats a quantity in twelfths as a whole number and fraction.
+func twelfthsStr(twelfths int64) string {
+	sign := ""
+	if twelfths < 0 {
+		sign = "-"
+		twelfths = -twelfths
+	}
+	whole := twelfths / 12
+	remainder := twelfths % 12
+	if whole < 1 {
+		return sign + fractions[remainder]
+	}
+	return fmt.Sprintf("%s%d%s", sign, whole, fractions[remainder])
+}
+
 // User represents a Syndicate user.
 type User struct {
 	// ID is the unique user id.
@@ -17,83 +33,56 @@ type User struct {
 	Name string
 	// UntappdID is their username on Untappd.
 	UntappdID string
-	// SeedFund is a cost to shift the user for net position, cents.
-	SeedFund float64
+	// SeedFund is an amount to shift the user's net position by.
+	SeedFund Money
+	// Retired users have left the syndicate. They are not offered for new
+	// contributions or checkouts, but their history and balance remain.
+	Retired bool
+	// HasPassword is true if the user has a PIN or password to log in
+	// with. It is set with SetPassword rather than EditUser.
+	HasPassword bool
 }
 
 // TotalAdded returns the total beer value added to the syndicate.
-func (u *User) TotalAdded() (float64, error) {
-	conts, err := DB.ListContributions()
+func (u *User) TotalAdded() (Money, error) {
+	b, err := DB.GetBalance(u.ID)
 	if err != nil {
 		return 0, err
 	}
-	var total float64
-	for _, c := range conts {
-		if c.User == u.ID {
-			total += c.UnitPrice * float64(c.Quantity)
-		}
-	}
-	return total, nil
+	return b.Added, nil
 }
 
-// TotalAdded returns the total beer value taken from the syndicate.
-func (u *User) TotalTaken() (float64, error) {
-	takes, err := DB.ListCheckouts()
+// TotalTaken returns the total beer value taken from the syndicate.
+func (u *User) TotalTaken() (Money, error) {
+	b, err := DB.GetBalance(u.ID)
 	if err != nil {
 		return 0, err
 	}
-	cs, err := DB.ListContributions()
-	if err != nil {
-		return 0, err
-	}
-	conts := map[int64]*Contribution{}
-	for _, c := range cs {
-		conts[c.ID] = c
-	}
-	var total float64
-	for _, t := range takes {
-		if t.User == u.ID {
-			total += (float64(t.Twelfths) / 12) * conts[t.Contribution].UnitPrice
-		}
-	}
-	return total, nil
+	return b.Taken, nil
 }
 
 // TotalDebitCredit returns the total debits/credits for the user.
-func (u *User) TotalDebitCredit() (float64, error) {
-	dcs, err := DB.ListDebitCredits()
+func (u *User) TotalDebitCredit() (Money, error) {
+	b, err := DB.GetBalance(u.ID)
 	if err != nil {
 		return 0, err
 	}
-	var total float64
-	for _, dc := range dcs {
-		if dc.User == u.ID {
-			total += dc.Amount
-		}
-	}
-	return total, nil
+	return b.DebitCredit, nil
 }
 
 // NetPosition returns the users's net financial position in the syndicate.
-func (u *User) NetPosition() (float64, error) {
-	added, err := u.TotalAdded()
+func (u *User) NetPosition() (Money, error) {
+	b, err := DB.GetBalance(u.ID)
 	if err != nil {
 		return 0, err
 	}
-	taken, err := u.TotalTaken()
-	if err != nil {
-		return 0, err
-	}
-	dc, err := u.TotalDebitCredit()
-	if err != nil {
-		return 0, err
-	}
-	return added - taken + u.SeedFund + dc, nil
+	return b.NetPosition(), nil
 }
 
-// LastCheckins returns the users last 'count' checkins on Untappd.
+// LastCheckins returns the users last 'count' checkins on Untappd, or none
+// if the Untappd API is not set up.
 func (u *User) LastCheckins(count int) ([]*untappd.Checkin, error) {
-	if u.UntappdID == "" {
+	if u.UntappdID == "" || Untappd == nil {
 		return nil, nil
 	}
 	checkins, err := Untappd.GetUserCheckins(u.UntappdID, count)
@@ -119,20 +108,18 @@ type Beer struct {
 	BreweryID int64
 	// LabelURL is the URL of the label.
 	LabelURL string
+	// Refreshed is when the details were last refreshed from the beer
+	// catalog, or zero if they have not been since it was added. It is set
+	// with RefreshBeer rather than EditBeer.
+	Refreshed time.Time
 }
 
-// GetBeer gets the given beer.
-func GetBeer(id int64) (*Beer, error) {
-	beers, err := DB.ListBeers()
-	if err != nil {
-		return nil, err
-	}
-	for _, b := range beers {
-		if b.ID == id {
-			return b, nil
-		}
-	}
-	return nil, fmt.Errorf("no such beer id: %d", id)
+// Rating is a beer's catalog rating seen when refreshing it.
+type Rating struct {
+	// Date is when the rating was seen.
+	Date time.Time
+	// Rating is the rating out of 5.
+	Rating float64
 }
 
 // RatingWidth returns the width of the beer's rating stars.
@@ -142,45 +129,13 @@ func (b *Beer) RatingWidth() int {
 
 // Available returns the number of units available of the beer.
 func (b *Beer) Available() (float64, error) {
-	var available int64 // In twelfths.
-	contr, err := DB.ListContributions()
-	if err != nil {
-		return 0, err
-	}
-	contributions := map[int64]*Contribution{}
-	for _, c := range contr {
-		contributions[c.ID] = c
-		if c.Beer == b.ID {
-			available += c.Quantity * int64(12)
-		}
-	}
-
-	taken, err := DB.ListCheckouts()
+	available, err := DB.BeerRemaining(b.ID)
 	if err != nil {
 		return 0, err
 	}
-	for _, w := range taken {
-		if contributions[w.Contribution].Beer == b.ID {
-			available -= w.Twelfths
-		}
-	}
 	return float64(available) / 12, nil
 }
 
-// GetContribution returns the given contribution.
-func GetContribution(id int64) (*Contribution, error) {
-	conts, err := DB.ListContributions()
-	if err != nil {
-		return nil, err
-	}
-	for _, c := range conts {
-		if c.ID == id {
-			return c, nil
-		}
-	}
-	return nil, fmt.Errorf("no such contribution id: %d", id)
-}
-
 // Contribution represents a contribution to the beer pool.
 type Contribution struct {
 	// ID is the primary key.
@@ -194,80 +149,48 @@ type Contribution struct {
 	// Date is the date contributed.
 	Date time.Time
 	// UnitPrice is the unit price of the beers.
-	UnitPrice float64
+	UnitPrice Money
 	// Comment is a freeform comment for the contribution.
 	Comment string
+	// DeletedAt is when the contribution was moved to the trash, or zero.
+	DeletedAt time.Time
 }
 
 // GetBeer gets the beer associated with a contribution.
 func (c *Contribution) GetBeer() (*Beer, error) {
-	beers, err := DB.ListBeers()
-	if err != nil {
-		return nil, err
-	}
-	for _, b := range beers {
-		if b.ID == c.Beer {
-			return b, nil
-		}
-	}
-	return nil, fmt.Errorf("did not find beer with id %d", c.Beer)
+	return DB.GetBeer(c.Beer)
 }
 
 // GetUser gets the user associated with a contribution.
 func (c *Contribution) GetUser() (*User, error) {
-	users, err := DB.ListUsers()
-	if err != nil {
-		return nil, err
-	}
-	for _, u := range users {
-		if u.ID == c.User {
-			return u, nil
-		}
-	}
-	return nil, fmt.Errorf("did not find user with id %d", c.User)
+	return DB.GetUser(c.User)
 }
 
 // Remaining is the remaining beer from that contribution.
 func (c *Contribution) Remaining() (float64, error) {
-	takes, err := DB.ListCheckouts()
+	remaining, err := DB.ContributionRemaining(c.ID)
 	if err != nil {
 		return 0, err
 	}
-	remaining := c.Quantity * 12 // In twelfths
-	for _, take := range takes {
-		if take.Contribution == c.ID {
-			remaining -= take.Twelfths
-		}
-	}
 	return float64(remaining) / 12, nil
 }
 
+// RemainingStr is the remaining beer from that contribution as a string.
 func (c *Contribution) RemainingStr() (string, error) {
-	takes, err := DB.ListCheckouts()
+	remaining, err := DB.ContributionRemaining(c.ID)
 	if err != nil {
 		return "", err
 	}
-	remaining := c.Quantity * 12 // In twelfths
-	for _, take := range takes {
-		if take.Contribution == c.ID {
-			remaining -= take.Twelfths
-		}
-	}
-	whole := remaining/12
-	remainder := remaining % 12
-	if whole < 1 {
-		return fmt.Sprintf("%s", fractions[remainder]), nil
-	}
-	return fmt.Sprintf("%d%s", whole, fractions[remainder]), nil
+	return twelfthsStr(remaining), nil
 }
 
 // Untouched returns true if none of the contribution has been claimed.
 func (c *Contribution) Untouched() (bool, error) {
-	rem, err := c.Remaining()
+	remaining, err := DB.ContributionRemaining(c.ID)
 	if err != nil {
 		return false, err
 	}
-	return  float64(c.Quantity) - rem < 0.05, nil // float uncertainty.
+	return remaining == c.Quantity*12, nil
 }
 
 // GetCheckouts returns all the checkouts of that contribution.
@@ -300,35 +223,111 @@ type Checkout struct {
 	// Twelfths is the quantity, in twelfths of a beer. This
 	// allows for splitting by half, quarter, thirds.
 	Twelfths int64
+	// DeletedAt is when the checkout was moved to the trash, or zero.
+	DeletedAt time.Time
 }
 
 // QuantityStr returns the quantity checked out as a string.
 func (c *Checkout) QuantityStr() string {
-	whole := c.Twelfths/12
-	remainder := c.Twelfths % 12
-	if whole < 1 {
-		return fmt.Sprintf("%s", fractions[remainder])
-	}
-	return fmt.Sprintf("%d%s", whole, fractions[remainder])
+	return twelfthsStr(c.Twelfths)
 }
 
 // GetUser gets the user associated with a checkout.
 func (c *Checkout) GetUser() (*User, error) {
-	users, err := DB.ListUsers()
-	if err != nil {
-		return nil, err
-	}
-	for _, u := range users {
-		if u.ID == c.User {
-			return u, nil
-		}
-	}
-	return nil, fmt.Errorf("did not find user with id %d", c.User)
+	return DB.GetUser(c.User)
 }
 
 // GetContribution gets the contribution.
 func (c *Checkout) GetContribution() (*Contribution, error) {
-	return GetContribution(c.Contribution)
+	return DB.GetContribution(c.Contribution)
+}
+
+// SuggestionState is whether a suggestion has been answered.
+type SuggestionState string
+
+// Suggestion states.
+const (
+	SuggestionPending   SuggestionState = "pending"
+	SuggestionConfirmed SuggestionState = "confirmed"
+	SuggestionDismissed SuggestionState = "dismissed"
+)
+
+// Suggestion is an Untappd check-in of a beer in the syndicate, offered to
+// the user to confirm as a checkout.
+type Suggestion struct {
+	// ID is the primary key.
+	ID int64
+	// User is the user who checked in the beer.
+	User int64
+	// Checkin is the Untappd check-in id.
+	Checkin int64
+	// Beer is the beer checked in.
+	Beer int64
+	// Date is when the beer was checked in.
+	Date time.Time
+	// State is whether the user has confirmed or dismissed it.
+	State SuggestionState
+	// Checkout is the checkout made when it was confirmed, or 0.
+	Checkout int64
+}
+
+// GetBeer gets the beer checked in.
+func (s *Suggestion) GetBeer() (*Beer, error) {
+	return DB.GetBeer(s.Beer)
+}
+
+// GetUser gets the user who checked in the beer.
+func (s *Suggestion) GetUser() (*User, error) {
+	return DB.GetUser(s.User)
+}
+
+// Balance is a user's financial position in the syndicate.
+type Balance struct {
+	// User is the user the balance is for.
+	User int64
+	// SeedFund is the user's seed fund.
+	SeedFund Money
+	// Added is the total value of beer contributed.
+	Added Money
+	// Taken is the total value of beer checked out.
+	Taken Money
+	// DebitCredit is the total of misc debits and credits.
+	DebitCredit Money
+}
+
+// NetPosition returns the user's net position from the balance.
+func (b *Balance) NetPosition() Money {
+	return b.Added - b.Taken + b.SeedFund + b.DebitCredit
+}
+
+// InsufficientStockError is returned when checkouts would take more beer
+// than remains in a contribution.
+type InsufficientStockError struct {
+	// Contribution is the contribution that would be over-drawn.
+	Contribution int64
+	// Beer is set instead of Contribution when no contribution of the beer
+	// has enough left.
+	Beer int64
+	// Requested is the total quantity requested, in twelfths.
+	Requested int64
+	// Remaining is the quantity remaining, in twelfths.
+	Remaining int64
+}
+
+func (e *InsufficientStockError) Error() string {
+	if e.Contribution == 0 {
+		if e.Remaining == 0 {
+			return fmt.Sprintf("cannot checkout %s of beer %d, none left", twelfthsStr(e.Requested), e.Beer)
+		}
+		return fmt.Sprintf("cannot checkout %s of beer %d, at most %s left in any one contribution",
+			twelfthsStr(e.Requested), e.Beer, twelfthsStr(e.Remaining))
+	}
+	remaining := twelfthsStr(e.Remaining)
+	if e.Remaining == 0 {
+		remaining = "none"
+	}
+	return fmt.Sprintf("cannot checkout %s from contribution %d, only %s left",
+		twelfthsStr(e.Requested), e.Contribution, remaining)
 }
 
 // Subscription is a web push subscription.
@@ -347,6 +346,40 @@ type Subscription struct {
 	Host string
 	// Cookie is the cookie of the browser.
 	Cookie string
+	// User is the user who claimed the browser, or 0 if nobody has.
+	User int64
+	// Muted are the event types the subscriber has chosen not to receive.
+	Muted []EventType
+}
+
+// Delivery is an event waiting in the outbox to be sent to a subscription.
+type Delivery struct {
+	// ID is the ID of the delivery.
+	ID int64
+	// Subscription is the subscription to send the event to.
+	Subscription int64
+	// Event is the event to send.
+	Event Event
+	// Created is when the change causing the event was made.
+	Created time.Time
+	// Attempts is the number of failed attempts to send it.
+	Attempts int
+	// NextAttempt is when it is next due to be sent.
+	NextAttempt time.Time
+	// LastError is why the last attempt failed.
+	LastError string
+	// Failed is true if it has been given up on after too many attempts.
+	Failed bool
+}
+
+// LoginSession is a user logged in to a browser.
+type LoginSession struct {
+	// TokenHash is the hash of the session token kept in the browser.
+	TokenHash string
+	// User is the logged in user.
+	User int64
+	// Expires is when the session ends.
+	Expires time.Time
 }
 
 // DebitCredit represents a misc non-beer debit or credit for a user.
@@ -355,33 +388,40 @@ type DebitCredit struct {
 	ID int64
 	// User is the user to whom this applies.
 	User int64
-	// Amount is the amount of debit or credit, in cents.
-	Amount float64
+	// Amount is the amount of debit or credit; debits are negative.
+	Amount Money
 	// Date is the date the debit or credit was applied.
 	Date time.Time
 	// Comment is a freeform comment or description of the debit or credit.
 	Comment string
+	// DeletedAt is when the debit or credit was moved to the trash, or zero.
+	DeletedAt time.Time
 }
 
-// GetUser gets the user associated with a contribution.
+// GetUser gets the user associated with a debit or credit.
 func (dc *DebitCredit) GetUser() (*User, error) {
-	users, err := DB.ListUsers()
-	if err != nil {
-		return nil, err
-	}
-	for _, u := range users {
-		if u.ID == dc.User {
-			return u, nil
-		}
-	}
-	return nil, fmt.Errorf("did not find user with id %d", dc.User)
+	return DB.GetUser(dc.User)
 }
 
+// ErrNotFound is returned when looking up a record that does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrInUse is returned when deleting a record that others still refer to.
+var ErrInUse = errors.New("in use")
+
+// ErrExists is returned when restoring a record whose id is already taken.
+var ErrExists = errors.New("already exists")
+
 // DB is the database handler.
 var DB BeerDatabase
 
-// OpenDatabase opens the database handler.
+// OpenDatabase opens the database handler. The filename ":memory:" opens an
+// empty database kept in memory.
 func OpenDatabase(filename string) error {
+	if filename == ":memory:" {
+		DB = NewMemoryDatabase()
+		return nil
+	}
 	db := &database{}
 	if err := db.Open(filename); err != nil {
 		return err
@@ -390,33 +430,108 @@ func OpenDatabase(filename string) error {
 	return nil
 }
 
+// OpenPostgresDatabase opens the database handler on the PostgreSQL database
+// with the data source name.
+func OpenPostgresDatabase(dsn string) error {
+	db := &pgDatabase{}
+	if err := db.Open(dsn); err != nil {
+		return err
+	}
+	DB = db
+	return nil
+}
+
 // BeerDatabase is the interface to the database implementation.
 type BeerDatabase interface {
 	// ListUsers returns all users.
 	ListUsers() ([]*User, error)
+	// GetUser returns the given user, or ErrNotFound.
+	GetUser(id int64) (*User, error)
 	// AddUser adds the given user to the syndicate.
 	AddUser(*User) (id int64, err error)
+	// EditUser edits the name, Untappd ID, seed fund and retired state of a
+	// user, or returns ErrNotFound.
+	EditUser(*User) error
 
 	// ListBeers returns all beers.
 	ListBeers() ([]*Beer, error)
+	// GetBeer returns the given beer, or ErrNotFound.
+	GetBeer(id int64) (*Beer, error)
 	// AddBeer adds a new beer.
 	AddBeer(*Beer) (id int64, err error)
+	// EditBeer edits the details of a beer, or returns ErrNotFound.
+	EditBeer(*Beer) error
+	// RefreshBeer sets the name, brewery, rating, brewery ID and label of a
+	// beer from the catalog, marking it refreshed now, and adds the rating
+	// to its history if it changed. It returns ErrNotFound if there is no
+	// such beer.
+	RefreshBeer(*Beer) error
+	// ListRatings returns the history of a beer's rating, oldest first.
+	ListRatings(beer int64) ([]*Rating, error)
+	// DeleteBeer deletes a beer, returning ErrInUse if it has contributions.
+	DeleteBeer(id int64) error
+	// MergeBeers atomically moves all contributions of a duplicate beer
+	// onto the canonical one and deletes the duplicate.
+	MergeBeers(duplicate, canonical int64) error
 
 	// ListContributions returns all contributions.
 	ListContributions() ([]*Contribution, error)
+	// GetContribution returns the given contribution, or ErrNotFound.
+	GetContribution(id int64) (*Contribution, error)
 	// AddContribution adds a new contribution.
 	AddContribution(*Contribution) (id int64, err error)
-	// DeleteContribution deletes the given contribution.
+	// DeleteContribution moves the given contribution and its checkouts to
+	// the trash.
 	DeleteContribution(int64) error
-	// EditContribution edits the given contribution.
+	// EditContribution edits the given contribution, or returns
+	// ErrNotFound. An *InsufficientStockError is returned if more than the
+	// new quantity has already been checked out.
 	EditContribution(*Contribution) error
+	// ListDeletedContributions returns the contributions in the trash.
+	ListDeletedContributions() ([]*Contribution, error)
+	// UndeleteContribution restores a contribution from the trash, with
+	// the checkouts deleted along with it.
+	UndeleteContribution(int64) error
+	// PurgeContribution permanently removes a contribution in the trash,
+	// and all its checkouts.
+	PurgeContribution(int64) error
 
 	// ListCheckouts lists all checkouts.
 	ListCheckouts() ([]*Checkout, error)
+	// GetCheckout returns the given checkout, or ErrNotFound.
+	GetCheckout(id int64) (*Checkout, error)
 	// AddCheckout adds a checkout.
 	AddCheckout(*Checkout) (id int64, err error)
-	// DeleteCheckout deletes a checkout.
+	// AddCheckouts atomically adds several checkouts, returning an
+	// *InsufficientStockError if any contribution would be over-drawn.
+	AddCheckouts([]*Checkout) (ids []int64, err error)
+	// EditCheckout edits the user and quantity of a checkout, returning an
+	// *InsufficientStockError if the contribution would be over-drawn.
+	EditCheckout(*Checkout) error
+	// DeleteCheckout moves a checkout to the trash.
 	DeleteCheckout(int64) error
+	// ListDeletedCheckouts returns the checkouts in the trash.
+	ListDeletedCheckouts() ([]*Checkout, error)
+	// UndeleteCheckout restores a checkout from the trash, returning an
+	// *InsufficientStockError if the contribution would be over-drawn.
+	UndeleteCheckout(int64) error
+	// PurgeCheckout permanently removes a checkout in the trash.
+	PurgeCheckout(int64) error
+
+	// ContributionRemaining returns the twelfths left in a contribution.
+	ContributionRemaining(id int64) (twelfths int64, err error)
+	// BeerRemaining returns the twelfths left of a beer.
+	BeerRemaining(id int64) (twelfths int64, err error)
+	// ListContributionsRemaining returns the twelfths left in every
+	// contribution not in the trash, by contribution id.
+	ListContributionsRemaining() (map[int64]int64, error)
+	// ListBeersRemaining returns the twelfths left of every beer with
+	// contributions, by beer id.
+	ListBeersRemaining() (map[int64]int64, error)
+	// ListBalances returns the balances of all users.
+	ListBalances() ([]*Balance, error)
+	// GetBalance returns the balance of a user.
+	GetBalance(user int64) (*Balance, error)
 
 	// ListSubscriptions lists all subscriptions.
 	ListSubscriptions() ([]*Subscription, error)
@@ -424,11 +539,101 @@ type BeerDatabase interface {
 	AddSubscription(*Subscription) (id int64, err error)
 	// DeleteSubscription removes a subscription.
 	DeleteSubscription(int64) error
+	// ClaimSubscriptions sets the user of every subscription of the browser
+	// with the cookie, or unclaims them if user is 0. It returns the number
+	// of subscriptions claimed.
+	ClaimSubscriptions(cookie string, user int64) (n int64, err error)
+	// SetSubscriptionMuted sets the event types a subscription does not
+	// receive.
+	SetSubscriptionMuted(id int64, muted []EventType) error
+
+	// Contributions, checkouts and debits/credits add deliveries of the
+	// events they cause to the outbox in the same transaction.
+
+	// ListDeliveries lists the deliveries in the outbox, both pending and
+	// failed, oldest first.
+	ListDeliveries() ([]*Delivery, error)
+	// DueDeliveries returns up to limit pending deliveries due to be sent by
+	// the given time, oldest first.
+	DueDeliveries(by time.Time, limit int) ([]*Delivery, error)
+	// FailDelivery records a failed attempt to send a delivery, which is
+	// retried at the given time, or given up on if dead is true.
+	FailDelivery(id int64, reason string, retry time.Time, dead bool) error
+	// RetryDelivery makes a delivery due to be sent now, even if it was
+	// given up on, keeping its count of failed attempts.
+	RetryDelivery(id int64) error
+	// DeleteDelivery removes a delivery from the outbox, once it is sent or
+	// no longer wanted.
+	DeleteDelivery(id int64) error
+
+	// AddSuggestion adds a pending suggestion, returning ErrExists if the
+	// check-in has already been suggested to the user.
+	AddSuggestion(*Suggestion) (id int64, err error)
+	// GetSuggestion returns the given suggestion, or ErrNotFound.
+	GetSuggestion(id int64) (*Suggestion, error)
+	// ListSuggestions returns the suggestions to the user, or to all users
+	// if user is 0, in the given state, newest first.
+	ListSuggestions(user int64, state SuggestionState) ([]*Suggestion, error)
+	// ConfirmSuggestion atomically checks out the quantity of the beer for
+	// the user from the oldest contribution with enough left, and marks
+	// the suggestion confirmed. It returns an *InsufficientStockError if
+	// no contribution has enough, or ErrNotFound if the suggestion is not
+	// pending.
+	ConfirmSuggestion(id, twelfths int64) (checkout int64, err error)
+	// DismissSuggestion marks a pending suggestion dismissed, or returns
+	// ErrNotFound.
+	DismissSuggestion(id int64) error
 
 	// ListDebitCredits lists all debits or credits.
 	ListDebitCredits() ([]*DebitCredit, error)
+	// GetDebitCredit returns the given debit or credit, or ErrNotFound.
+	GetDebitCredit(id int64) (*DebitCredit, error)
 	// AddDebitCredit adds a debit or credit.
 	AddDebitCredit(*DebitCredit) (id int64, err error)
-	// DeleteDebitCredit deletes a debit or credit.
+	// AddDebitCredits atomically adds several debits/credits, returning
+	// their ids in order.
+	AddDebitCredits([]*DebitCredit) (ids []int64, err error)
+	// EditDebitCredit edits the amount and comment of a debit or credit.
+	EditDebitCredit(*DebitCredit) error
+	// DeleteDebitCredit moves a debit or credit to the trash.
 	DeleteDebitCredit(int64) error
+	// ListDeletedDebitCredits returns the debits or credits in the trash.
+	ListDeletedDebitCredits() ([]*DebitCredit, error)
+	// UndeleteDebitCredit restores a debit or credit from the trash.
+	UndeleteDebitCredit(int64) error
+	// PurgeDebitCredit permanently removes a debit or credit in the trash.
+	PurgeDebitCredit(int64) error
+
+	// RestoreBeer puts back a deleted beer with its original id, or
+	// returns ErrExists.
+	RestoreBeer(*Beer) error
+	// RestoreUser puts back a missing user with its original id, or
+	// returns ErrExists.
+	RestoreUser(*User) error
+
+	// GetPasswordHash returns the hash of a user's PIN or password, which
+	// is empty if they have none, or ErrNotFound.
+	GetPasswordHash(user int64) (string, error)
+	// SetPasswordHash sets the hash of a user's PIN or password, or
+	// removes it if hash is empty. The user's login sessions are ended.
+	SetPasswordHash(user int64, hash string) error
+	// EditUserPasswordHash edits a user as EditUser does and sets their
+	// password hash as SetPasswordHash does, making both changes or
+	// neither.
+	EditUserPasswordHash(u *User, hash string) error
+	// AddLoginSession starts a login session.
+	AddLoginSession(*LoginSession) error
+	// GetLoginSession returns the session with the token hash, or
+	// ErrNotFound.
+	GetLoginSession(tokenHash string) (*LoginSession, error)
+	// DeleteLoginSession ends a login session.
+	DeleteLoginSession(tokenHash string) error
+
+	// AddAuditEntry appends an entry to the audit log.
+	AddAuditEntry(*AuditEntry) (id int64, err error)
+	// ListAuditEntries returns up to limit audit entries older than the
+	// entry before, or the newest if before is 0, newest first.
+	ListAuditEntries(before int64, limit int) ([]*AuditEntry, error)
+	// GetAuditEntry returns the given audit entry, or ErrNotFound.
+	GetAuditEntry(id int64) (*AuditEntry, error)
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -20,10 +21,38 @@ var (
 type UntappdClient struct {
 	utc          *untappd.Client
 	checkinCache *gocache.Cache
+	infoCache    *gocache.Cache
+	searchCache  *gocache.Cache
+	limit        rateLimit
+
+	// InfoTTL is how long beer details are cached for.
+	InfoTTL time.Duration
+	// SearchTTL is how long search results are cached for.
+	SearchTTL time.Duration
+	// Reserve is how many API calls to keep in hand. Once Untappd reports
+	// no more than this remaining, calls are held back for the rest of
+	// the hour and cached results served instead.
+	Reserve int
 }
 
-func NewUntappdClient(untappdID, untappdSecret string) error {
-	utc, err := untappd.NewClient(untappdID, untappdSecret, &http.Client{})
+// UntappdAPIBase is the root of the Untappd API.
+const UntappdAPIBase = "https://api.untappd.com/v4"
+
+// UntappdShortURLBase is where untp.beer short links are resolved.
+const UntappdShortURLBase = "https://untp.beer"
+
+// NewUntappdClient sets Untappd to a client of the API at baseURL, such as
+// UntappdAPIBase or a FakeUntappd.
+func NewUntappdClient(untappdID, untappdSecret, baseURL string) error {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("untappd base url: %v", err)
+	}
+	client := &http.Client{}
+	if baseURL != UntappdAPIBase {
+		client.Transport = &rebaseTransport{base: base}
+	}
+	utc, err := untappd.NewClient(untappdID, untappdSecret, client)
 	if err != nil {
 		return err
 	}
@@ -33,18 +62,51 @@ func NewUntappdClient(untappdID, untappdSecret string) error {
 			10*time.Minute,
 			10*time.Minute,
 		),
+		infoCache:   gocache.New(gocache.NoExpiration, time.Hour),
+		searchCache: gocache.New(gocache.NoExpiration, time.Hour),
+		InfoTTL:     6 * time.Hour,
+		SearchTTL:   time.Hour,
+		Reserve:     10,
 	}
 	return nil
 }
 
-// GetBeerInfo returns untappd info, given an untappd beer id.
+// rebaseTransport sends requests for the Untappd API to another base URL.
+type rebaseTransport struct {
+	base *url.URL
+}
+
+func (t *rebaseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.URL.Scheme, r.URL.Host = t.base.Scheme, t.base.Host
+	r.URL.Path = strings.TrimSuffix(t.base.Path, "/") + strings.TrimPrefix(req.URL.Path, "/v4")
+	r.Host = ""
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// GetBeerInfo returns untappd info, given an untappd beer id. Info is
+// cached for InfoTTL, and the response is nil when it comes from the cache.
 func (u *UntappdClient) GetBeerInfo(id int64) (*untappd.Beer, *http.Response, error) {
-	return u.utc.Beer.Info(int(id), true)
+	v, resp, err := u.fetch(u.infoCache, strconv.FormatInt(id, 10), u.InfoTTL, func() (interface{}, *http.Response, error) {
+		return u.utc.Beer.Info(int(id), true)
+	})
+	if err != nil {
+		return nil, resp, err
+	}
+	return v.(*untappd.Beer), resp, nil
 }
 
-// SearchBeer returns a list of beers matching the search query.
+// SearchBeer returns a list of beers matching the search query. Results are
+// cached for SearchTTL, and the response is nil when they come from the
+// cache.
 func (u *UntappdClient) SearchBeer(query string) ([]*untappd.Beer, *http.Response, error) {
-	return u.utc.Beer.Search(query)
+	v, resp, err := u.fetch(u.searchCache, strings.ToLower(strings.TrimSpace(query)), u.SearchTTL, func() (interface{}, *http.Response, error) {
+		return u.utc.Beer.Search(query)
+	})
+	if err != nil {
+		return nil, resp, err
+	}
+	return v.([]*untappd.Beer), resp, nil
 }
 
 
@@ -54,7 +116,11 @@ func (u *UntappdClient) GetUserCheckins(id string, count int) ([]*untappd.Checki
 	if found {
 		return checkins.([]*untappd.Checkin), nil
 	}
-	newCheckins, _, err := u.utc.User.CheckinsMinMaxIDLimit(id, 0, math.MaxInt32, count)
+	if err := u.limit.allow(u.Reserve); err != nil {
+		return nil, err
+	}
+	newCheckins, resp, err := u.utc.User.CheckinsMinMaxIDLimit(id, 0, math.MaxInt32, count)
+	u.limit.update(resp)
 	if err != nil {
 		return nil, err
 	}
@@ -65,10 +131,11 @@ func (u *UntappdClient) GetUserCheckins(id string, count int) ([]*untappd.Checki
 }
 
 // Takes a shortcut URL, typically of the form https://untp.beer/0rqOe and
-// queries it to fetch the beer ID.
-func ResolveShortURL(uri string) (int64, error) {
+// queries it at base, such as UntappdShortURLBase, to fetch the beer ID.
+func ResolveShortURL(base, uri string) (int64, error) {
 	var number string
-	if strings.Contains(uri, "untp.beer") {
+	if i := strings.Index(uri, "untp.beer"); i >= 0 {
+		uri = strings.TrimSuffix(base, "/") + uri[i+len("untp.beer"):]
 		// Create a new http client.
 		client := &http.Client{
 			CheckRedirect: func(req *http.Request, via []*http.Request) error {
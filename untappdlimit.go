@@ -0,0 +1,137 @@
+package syndicate
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+)
+
+// ErrRateLimited is returned when an Untappd API call is held back to stay
+// within its rate limit.
+var ErrRateLimited = errors.New("untappd rate limit nearly reached")
+
+// untappdLimitWindow is how long Untappd takes to restore its API quota.
+const untappdLimitWindow = time.Hour
+
+// staleCacheAge is how long cached Untappd results are kept past their TTL,
+// to be served while calls are held back.
+const staleCacheAge = 24 * time.Hour
+
+// rateLimit tracks the Untappd API quota from its response headers.
+type rateLimit struct {
+	mu        sync.Mutex
+	limit     int
+	remaining int
+	seen      time.Time
+}
+
+// update records the quota in an API response, if it has one.
+func (l *rateLimit) update(resp *http.Response) {
+	if resp == nil {
+		return
+	}
+	remaining, err := strconv.Atoi(resp.Header.Get("X-Ratelimit-Remaining"))
+	if err != nil {
+		if resp.StatusCode != http.StatusTooManyRequests {
+			return
+		}
+		remaining = 0
+	}
+	limit, _ := strconv.Atoi(resp.Header.Get("X-Ratelimit-Limit"))
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit, l.remaining, l.seen = limit, remaining, time.Now()
+}
+
+// backoffUntil returns when calls may resume if no more than reserve calls
+// remain, or zero if they need not wait.
+func (l *rateLimit) backoffUntil(reserve int) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.seen.IsZero() || l.remaining > reserve {
+		return time.Time{}
+	}
+	if until := l.seen.Add(untappdLimitWindow); time.Now().Before(until) {
+		return until
+	}
+	return time.Time{}
+}
+
+// allow returns ErrRateLimited if calls must wait to keep reserve calls
+// in hand.
+func (l *rateLimit) allow(reserve int) error {
+	if until := l.backoffUntil(reserve); !until.IsZero() {
+		return fmt.Errorf("%w: waiting until %s", ErrRateLimited, until.Format("15:04"))
+	}
+	return nil
+}
+
+// cachedResult is an Untappd API result and when it was fetched.
+type cachedResult struct {
+	value   interface{}
+	fetched time.Time
+}
+
+// fetch returns the result cached under key if it is younger than ttl, and
+// otherwise calls get and caches what it returns. An older cached result is
+// served if the call is held back by the rate limit. The response is nil
+// when the result comes from the cache.
+func (u *UntappdClient) fetch(cache *gocache.Cache, key string, ttl time.Duration, get func() (interface{}, *http.Response, error)) (interface{}, *http.Response, error) {
+	var stale *cachedResult
+	if v, ok := cache.Get(key); ok {
+		c := v.(*cachedResult)
+		if time.Since(c.fetched) < ttl {
+			return c.value, nil, nil
+		}
+		stale = c
+	}
+	if err := u.limit.allow(u.Reserve); err != nil {
+		if stale != nil {
+			return stale.value, nil, nil
+		}
+		return nil, nil, err
+	}
+	v, resp, err := get()
+	u.limit.update(resp)
+	if err != nil {
+		return nil, resp, err
+	}
+	cache.Set(key, &cachedResult{value: v, fetched: time.Now()}, ttl+staleCacheAge)
+	return v, resp, nil
+}
+
+// UntappdQuota is the state of the Untappd API rate limit.
+type UntappdQuota struct {
+	// Limit and Remaining are the calls allowed an hour and those left, as
+	// last reported by Untappd.
+	Limit, Remaining int
+	// Seen is when Untappd last reported the quota, or zero if it has not.
+	Seen time.Time
+	// BackoffUntil is when held back calls resume, or zero if they are not
+	// held back.
+	BackoffUntil time.Time
+	// Reserve is how many calls are kept in hand.
+	Reserve int
+	// CachedBeers and CachedSearches count the cached beer details and
+	// search results.
+	CachedBeers, CachedSearches int
+}
+
+// Quota returns the state of the Untappd API rate limit.
+func (u *UntappdClient) Quota() UntappdQuota {
+	q := UntappdQuota{
+		BackoffUntil:   u.limit.backoffUntil(u.Reserve),
+		Reserve:        u.Reserve,
+		CachedBeers:    u.infoCache.ItemCount(),
+		CachedSearches: u.searchCache.ItemCount(),
+	}
+	u.limit.mu.Lock()
+	defer u.limit.mu.Unlock()
+	q.Limit, q.Remaining, q.Seen = u.limit.limit, u.limit.remaining, u.limit.seen
+	return q
+}
@@ -0,0 +1,85 @@
+package syndicate
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdlayher/untappd"
+	gocache "github.com/patrickmn/go-cache"
+)
+
+// fakeUntappdTransport answers beer info calls with the remaining quota
+// it is given, counting the calls.
+type fakeUntappdTransport struct {
+	calls     int
+	remaining int
+}
+
+func (f *fakeUntappdTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.calls++
+	body := fmt.Sprintf(`{"meta":{"code":200},"response":{"beer":{"bid":1,"beer_name":"Call %d","rating_score":3.5}}}`, f.calls)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header: http.Header{
+			"Content-Type":          {"application/json"},
+			"X-Ratelimit-Limit":     {"100"},
+			"X-Ratelimit-Remaining": {fmt.Sprint(f.remaining)},
+		},
+		Body:    ioutil.NopCloser(strings.NewReader(body)),
+		Request: req,
+	}, nil
+}
+
+func TestUntappdRateLimit(t *testing.T) {
+	ft := &fakeUntappdTransport{remaining: 50}
+	utc, err := untappd.NewClient("id", "secret", &http.Client{Transport: ft})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &UntappdClient{
+		utc:          utc,
+		checkinCache: gocache.New(time.Minute, time.Minute),
+		infoCache:    gocache.New(gocache.NoExpiration, time.Hour),
+		searchCache:  gocache.New(gocache.NoExpiration, time.Hour),
+		InfoTTL:      time.Hour,
+		Reserve:      10,
+	}
+
+	// Details are cached.
+	for i := 0; i < 2; i++ {
+		if b, err := u.Lookup(1); err != nil || b.Name != "Call 1" {
+			t.Fatalf("Lookup = %+v, %v; want the first call's beer", b, err)
+		}
+	}
+	if q := u.Quota(); ft.calls != 1 || q.Limit != 100 || q.Remaining != 50 || !q.BackoffUntil.IsZero() || q.CachedBeers != 1 {
+		t.Errorf("After cached lookups, %d calls and quota %+v", ft.calls, q)
+	}
+
+	// Once the quota is down to the reserve, stale details are served and
+	// uncached beers wait.
+	u.InfoTTL = 0
+	ft.remaining = 10
+	if b, err := u.Lookup(1); err != nil || b.Name != "Call 2" {
+		t.Fatalf("Lookup of stale beer = %+v, %v; want a new call", b, err)
+	}
+	if b, err := u.Lookup(1); err != nil || b.Name != "Call 2" {
+		t.Errorf("Lookup while held back = %+v, %v; want the stale beer", b, err)
+	}
+	if _, err := u.Lookup(2); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Lookup of uncached beer while held back = %v, want ErrRateLimited", err)
+	}
+	if q := u.Quota(); ft.calls != 2 || q.Remaining != 10 || q.BackoffUntil.Before(time.Now()) {
+		t.Errorf("While held back, %d calls and quota %+v", ft.calls, q)
+	}
+
+	// Calls resume once Untappd has had time to restore the quota.
+	u.limit.seen = u.limit.seen.Add(-untappdLimitWindow)
+	if _, err := u.Lookup(2); err != nil || ft.calls != 3 {
+		t.Errorf("Lookup after the window = %v after %d calls, want a new call", err, ft.calls)
+	}
+}